@@ -0,0 +1,46 @@
+// Package dbtest helps tests use a users.Store without a database server.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+// NewTestStore returns a Store for tb, a test or benchmark, backed by a
+// database from NewTestDB. The store is shut down when tb finishes.
+func NewTestStore(tb testing.TB) *users.Store {
+	tb.Helper()
+
+	s := users.NewStore(NewTestDB(tb), users.SQLite)
+	tb.Cleanup(func() { s.Shutdown(context.Background()) })
+	return s
+}
+
+// NewTestDB returns a fresh in-memory SQLite database for tb, with every
+// migration applied, such as for tests that need several databases. The
+// database is discarded when tb finishes. It fails tb if the database
+// can't be set up.
+func NewTestDB(tb testing.TB) *sql.DB {
+	tb.Helper()
+
+	db, err := sql.Open(users.SQLite.DriverName(), ":memory:")
+	if err != nil {
+		tb.Fatalf("open test database: %v", err)
+	}
+	// Every connection to :memory: gets a database of its own, so only
+	// one connection can be used, and it must never be closed.
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+
+	if err := users.Migrate(context.Background(), db, users.SQLite); err != nil {
+		db.Close()
+		tb.Fatalf("migrate test database: %v", err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	return db
+}
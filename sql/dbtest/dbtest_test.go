@@ -0,0 +1,43 @@
+package dbtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+func TestNewTestStore(t *testing.T) {
+	s := NewTestStore(t)
+	ctx := context.Background()
+
+	id, err := s.CreateUser(ctx, &users.User{Username: "alice", Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := s.GetUserByID(ctx, int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Username != "alice" {
+		t.Errorf("Username = %q, want %q", u.Username, "alice")
+	}
+}
+
+func TestNewTestStoreIsolated(t *testing.T) {
+	// Each store gets a database of its own, so the user created by one
+	// test can't be seen by another.
+	a, b := NewTestStore(t), NewTestStore(t)
+	ctx := context.Background()
+
+	if _, err := a.CreateUser(ctx, &users.User{Username: "alice", Password: "password123"}); err != nil {
+		t.Fatal(err)
+	}
+	n, err := b.CountUsers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("CountUsers = %d, want 0", n)
+	}
+}
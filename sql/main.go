@@ -1,33 +1,46 @@
 package main
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"time"
+
+	"github.com/gongweijun86/go-packages/sql/users"
 
 	// Import the mysql driver (go-sql-driver/mysql) with an underscore
 	// to just import the driver for it's initialization side effects.
 	_ "github.com/go-sql-driver/mysql"
+	// The postgres (lib/pq) and sqlite3 (mattn/go-sqlite3) drivers are
+	// imported the same way so that any of the supported dialects can
+	// be opened.
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 )
 
-// A User describes a user in the database.
-type User struct {
-	Id       int
-	Username string
-	Password string
-}
-
 func main() {
 	// Repace username, password and the mydb names.
-	dsn := "username:password@tcp(127.0.0.1:3306)/mydb"
+	dsn := users.DSN{
+		User:     "username",
+		Password: "password",
+		Host:     "127.0.0.1",
+		Port:     3306,
+		Database: "mydb",
+		// parseTime makes the mysql driver scan datetime columns into
+		// time.Time values.
+		Params: map[string]string{"parseTime": "true"},
+	}
 
-	// Open the database.
-	//
-	// Open opens a database specified by its database driver name and a
-	// driver-specific data source name, usually consisting of at least a
-	// database name and connection information.
-	db, err := sql.Open("mysql", dsn)
-	if err != nil {
+	// Open the database with the default connection pool settings. Open
+	// also pings the database to verify that the connection is valid.
+	db, err := users.Open(dsn.String(), users.Config{Dialect: users.MySQL})
+	switch {
+	case errors.Is(err, users.ErrCannotConnect):
+		log.Fatalf("%v (check the database's host and port)", err)
+	case errors.Is(err, users.ErrAuthFailed):
+		log.Fatalf("%v (check the database's user and password)", err)
+	case err != nil:
 		log.Fatalln(err)
 	}
 	// Close the db when it's no longer needed.
@@ -38,95 +51,98 @@ func main() {
 	// long-lived and shared between many goroutines.
 	defer db.Close()
 
-	// Ping the database to verify that the connection is valid.
-	//
-	// Ping verifies a connection to the database is still alive,
-	// establishing a connection if necessary.
-	if err := db.Ping(); err != nil {
+	// Create or update the database's tables by applying any schema
+	// migrations that haven't been applied yet.
+	if err := users.Migrate(context.Background(), db, users.MySQL); err != nil {
 		log.Fatalln(err)
 	}
 
-	// Create a new user to insert into the database.
-	u := &User{Username: "radovskyb", Password: "password123"}
+	// Create a new Store to query the users table with.
+	store := users.NewStore(db, users.MySQL)
 
-	// Insert the new user into the database.
-	//
-	// Exec executes a query without returning any rows.
-	// The args are for any placeholder parameters in the query.
-	query := "insert into users (username, password) values (?, ?)"
-	res, err := db.Exec(query, u.Username, u.Password)
-	if err != nil {
+	// Create a context for the store's queries. A real application would
+	// usually use a request's context here instead.
+	ctx := context.Background()
+
+	// Prepare the store's most frequently used queries.
+	if err := store.Prepare(ctx); err != nil {
 		log.Fatalln(err)
 	}
 
-	// Print out how many rows were affected by inserting a single user.
-	//
-	// RowsAffected returns the number of rows affected by an
-	// update, insert, or delete. Not every database or database
-	// driver may support this.
-	numAffected, err := res.RowsAffected()
+	// Shut the store down once it's no longer needed, which closes its
+	// prepared statements and the db. Any queries that are still running
+	// are given a few seconds to finish first.
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := store.Shutdown(ctx); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	// Create a new user to insert into the database. Email is a pointer
+	// since users don't have to have an email address.
+	email := "radovskyb@example.com"
+	u := &users.User{
+		Username: "radovskyb",
+		Email:    &email,
+		Password: "password123",
+	}
+
+	// Insert the new user into the database and print out the id
+	// that was generated for it.
+	id, err := store.CreateUser(ctx, u)
 	if err != nil {
 		log.Fatalln(err)
 	}
-	fmt.Println(numAffected)
-
-	// LastInsertId returns the integer generated by the database
-	// in response to a command. Typically this will be from an
-	// "auto increment" column when inserting a new row. Not all
-	// databases support this feature, and the syntax of such
-	// statements varies.
-	lastInsertId, err := res.LastInsertId()
+	fmt.Println(id)
+
+	// Fetch the user back out of the database by its id.
+	u, err = store.GetUserByID(ctx, int(id))
 	if err != nil {
 		log.Fatalln(err)
 	}
-	fmt.Println(lastInsertId)
+	fmt.Println(u)
 
-	// Use Query to retrieve all users from the database;
-	//
-	// Query executes a query that returns rows, typically a SELECT.
-	// The args are for any placeholder parameters in the query.
-	rows, err := db.Query("select * from users")
+	// Fetch the same user again, this time by its username.
+	u, err = store.GetUserByUsername(ctx, u.Username)
 	if err != nil {
 		log.Fatalln(err)
 	}
-	// Close the rows when they are no longer needed.
-	//
-	// Close closes the Rows, preventing further enumeration. If Next returns
-	// false, the Rows are closed automatically and it will suffice to check the
-	// result of Err. Close is idempotent and does not affect the result of Err.
-	defer rows.Close()
+	fmt.Println(u)
 
-	// Iterate over all of the rows returned from the database.
-	//
-	// Next prepares the next result row for reading with the Scan method. It
-	// returns true on success, or false if there is no next result row or an error
-	// happened while preparing it. Err should be consulted to distinguish between
-	// the two cases.
-	//
-	// Every call to Scan, even the first one, must be preceded by a call to Next.
-	for rows.Next() {
-		// Create a new user object.
-		u := new(User)
-
-		// Scan in the user's information from the row into u.
-		//
-		// Scan copies the columns in the current row into the values pointed
-		// at by dest. The number of values in dest must be the same as the
-		// number of columns in Rows.
-		if err := rows.Scan(&u.Id, &u.Username, &u.Password); err != nil {
-			log.Fatalln(err)
-		}
+	// Check that the stored password hash matches the password the
+	// user was created with.
+	fmt.Println(users.CheckPassword(u.Password, "password123"))
 
-		// Print out the user.
+	// Change the user's password and save the change. UpdateUser stores
+	// the password as is, so it must be hashed first.
+	u.Password, err = users.HashPassword("newpassword456")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err := store.UpdateUser(ctx, u); err != nil {
+		log.Fatalln(err)
+	}
+
+	// Retrieve the first page of users from the database, newest first,
+	// and print them out.
+	list, err := store.ListUsers(ctx, users.ListOptions{
+		Limit:  10,
+		SortBy: users.SortByCreatedAt,
+		Order:  users.Desc,
+	})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	for _, u := range list {
 		fmt.Println(u)
 	}
 
-	// Make sure there were no errors whilst scanning in the users
-	// from the database.
-	//
-	// Err returns the error, if any, that was encountered during iteration.
-	// Err may be called after an explicit or implicit Close.
-	if err := rows.Err(); err != nil {
+	// Finally, delete the user that was created above. DeleteUser only
+	// soft deletes the user, so it could still be restored with
+	// RestoreUser.
+	if err := store.DeleteUser(ctx, int(id)); err != nil {
 		log.Fatalln(err)
 	}
 }
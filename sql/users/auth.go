@@ -0,0 +1,203 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidCredentials is returned by Authenticate when the username or
+// password is wrong. The same error is returned in both cases so callers
+// can't reveal which usernames exist.
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// ErrNoPasswordSet is returned by Authenticate for users that don't have a
+// password, such as users that only sign in with SSO.
+var ErrNoPasswordSet = errors.New("user has no password set")
+
+// Authenticate returns the user with the given username if plain is their
+// password, or ErrInvalidCredentials if there's no such user or plain is
+// the wrong password. It returns ErrNoPasswordSet if the user exists but
+// doesn't have a password. The returned user's Password is cleared.
+//
+// If s.MaxFailedLogins is set, wrong passwords are counted, and once there
+// have been that many in a row the account is locked. Authenticate then
+// returns ErrAccountLocked for the user until the lock expires, even for
+// the right password. A successful login resets the count.
+//
+// Unless s.SkipRecordLogin is set, a successful login is recorded with
+// RecordLogin, and the returned user's LastLoginAt is set. Passwords
+// flagged by RehashWeakPasswords, and those hashed by a different built-in
+// Hasher than s.Hasher, are hashed again on a successful login.
+func (s *Store) Authenticate(ctx context.Context, username, plain string) (u *User, err error) {
+	ctx, op, err := s.startOp(ctx, "Authenticate")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { op.end(err, 1) }()
+
+	u, err = s.getUserByUsername(ctx, username)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			// Hash the password anyway, so that this takes about as long
+			// as checking a wrong password.
+			s.hashPassword(plain)
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("authenticate: %w", err)
+	}
+
+	if !u.HasPassword() {
+		return nil, ErrNoPasswordSet
+	}
+	now := time.Now().UTC()
+	if u.LockedUntil != nil && now.Before(*u.LockedUntil) {
+		return nil, ErrAccountLocked
+	}
+	ok, err := s.verifyPassword(u.Password, plain)
+	if err != nil {
+		return nil, fmt.Errorf("authenticate: %w", err)
+	}
+	if !ok {
+		if s.MaxFailedLogins > 0 {
+			if err := s.recordFailedLogin(ctx, u.Id, now); err != nil {
+				return nil, fmt.Errorf("authenticate: %w", err)
+			}
+		}
+		return nil, ErrInvalidCredentials
+	}
+	if u.NeedsRehash || s.hashOutdated(u.Password) {
+		if err := s.rehashPassword(ctx, u, plain); err != nil {
+			return nil, fmt.Errorf("authenticate: %w", err)
+		}
+	}
+	u.Password = ""
+
+	if u.FailedLoginCount > 0 || u.LockedUntil != nil {
+		if err := s.resetFailedLogins(ctx, u.Id); err != nil {
+			return nil, fmt.Errorf("authenticate: %w", err)
+		}
+		u.FailedLoginCount, u.LockedUntil = 0, nil
+	}
+
+	if !s.SkipRecordLogin {
+		if err := s.recordLogin(ctx, u.Id, now); err != nil {
+			return nil, fmt.Errorf("authenticate: %w", err)
+		}
+		u.LastLoginAt = &now
+	}
+
+	return u, nil
+}
+
+// ChangePassword changes the password of the user with the given id from
+// oldPlain to newPlain, and sets the user's updated_at time to the
+// current time. It returns ErrInvalidCredentials if oldPlain isn't the
+// user's current password, ErrNoPasswordSet if the user doesn't have a
+// password, and ErrUserNotFound if there's no such user. newPlain must
+// satisfy s.PasswordPolicy.
+func (s *Store) ChangePassword(ctx context.Context, id int, oldPlain, newPlain string) (err error) {
+	ctx, op, err := s.startOp(ctx, "ChangePassword")
+	if err != nil {
+		return err
+	}
+	defer func() { op.end(err, 1) }()
+
+	u, err := s.getUserByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("change password: %w", err)
+	}
+	if !u.HasPassword() {
+		return ErrNoPasswordSet
+	}
+	ok, err := s.verifyPassword(u.Password, oldPlain)
+	if err != nil {
+		return fmt.Errorf("change password: %w", err)
+	}
+	if !ok {
+		return ErrInvalidCredentials
+	}
+
+	if newPlain == "" {
+		return fmt.Errorf("change password: %w", ErrEmptyPassword)
+	}
+	if err := s.PasswordPolicy.Validate(newPlain); err != nil {
+		return fmt.Errorf("change password: %w", err)
+	}
+	hash, err := s.hashPassword(newPlain)
+	if err != nil {
+		return fmt.Errorf("change password: %w", err)
+	}
+
+	now := time.Now().UTC()
+	res, err := s.execRetry(ctx, updatePasswordQuery(s.dialect, s.table()), hash, now, id)
+	s.invalidate(id)
+	if err != nil {
+		return fmt.Errorf("change password: %w", err)
+	}
+	if err := checkUserAffected("change password", res); err != nil {
+		return err
+	}
+	u.UpdatedAt = now
+	u.Version++
+	return s.runHooks(ctx, hookUpdate, u)
+}
+
+// RemovePassword removes the password of the user with the given id, such
+// as when the user switches to signing in with SSO, and sets the user's
+// updated_at time to the current time. The user can't sign in with
+// Authenticate afterwards. It returns ErrUserNotFound if there's no such
+// user.
+func (s *Store) RemovePassword(ctx context.Context, id int) (err error) {
+	ctx, op, err := s.startOp(ctx, "RemovePassword")
+	if err != nil {
+		return err
+	}
+	defer func() { op.end(err, 1) }()
+
+	u, err := s.getUserByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("remove password: %w", err)
+	}
+
+	now := time.Now().UTC()
+	res, err := s.execRetry(ctx, updatePasswordQuery(s.dialect, s.table()), nullPassword(""), now, id)
+	s.invalidate(id)
+	if err != nil {
+		return fmt.Errorf("remove password: %w", err)
+	}
+	if err := checkUserAffected("remove password", res); err != nil {
+		return err
+	}
+	u.Password = ""
+	u.UpdatedAt = now
+	u.Version++
+	return s.runHooks(ctx, hookUpdate, u)
+}
+
+// RecordLogin sets the last login time of the user with the given id to
+// the current time. It returns ErrUserNotFound if no such user exists.
+// Unlike the store's other writes, it doesn't change the user's
+// updated_at time or version, so logging in doesn't conflict with
+// concurrent updates of the user.
+func (s *Store) RecordLogin(ctx context.Context, id int) (err error) {
+	ctx, op, err := s.startOp(ctx, "RecordLogin")
+	if err != nil {
+		return err
+	}
+	defer func() { op.end(err, 1) }()
+
+	return s.recordLogin(ctx, id, time.Now().UTC())
+}
+
+// recordLogin sets the last login time of the user with the given id to
+// now.
+func (s *Store) recordLogin(ctx context.Context, id int, now time.Time) error {
+	res, err := s.execRetry(ctx, updateLastLoginQuery(s.dialect, s.table()), now, id)
+	s.invalidate(id)
+	if err != nil {
+		return fmt.Errorf("record login: %w", err)
+	}
+	return checkUserAffected("record login", res)
+}
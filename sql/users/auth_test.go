@@ -0,0 +1,126 @@
+package users_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+func TestAuthenticate(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+	createUsers(t, s, "alice")
+
+	u, err := s.Authenticate(ctx, "alice", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Password != "" {
+		t.Error("Authenticate returned the password hash")
+	}
+	if u.LastLoginAt == nil {
+		t.Error("Authenticate didn't set LastLoginAt")
+	}
+
+	if _, err := s.Authenticate(ctx, "alice", "wrong"); !errors.Is(err, users.ErrInvalidCredentials) {
+		t.Errorf("wrong password: err = %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := s.Authenticate(ctx, "bob", "password123"); !errors.Is(err, users.ErrInvalidCredentials) {
+		t.Errorf("unknown user: err = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestAuthenticateLockout(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	s.MaxFailedLogins = 3
+	s.LockoutDuration = time.Hour
+	ctx := context.Background()
+	createUsers(t, s, "alice", "bob")
+
+	// A successful login resets the count.
+	for i := 0; i < 2; i++ {
+		s.Authenticate(ctx, "bob", "wrong")
+	}
+	if _, err := s.Authenticate(ctx, "bob", "password123"); err != nil {
+		t.Fatal(err)
+	}
+	s.Authenticate(ctx, "bob", "wrong")
+	if _, err := s.Authenticate(ctx, "bob", "password123"); err != nil {
+		t.Errorf("bob was locked out after failures that weren't in a row: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.Authenticate(ctx, "alice", "wrong"); !errors.Is(err, users.ErrInvalidCredentials) {
+			t.Fatalf("attempt %d: err = %v, want ErrInvalidCredentials", i+1, err)
+		}
+	}
+	if _, err := s.Authenticate(ctx, "alice", "password123"); !errors.Is(err, users.ErrAccountLocked) {
+		t.Errorf("locked account: err = %v, want ErrAccountLocked", err)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	s.PasswordPolicy = users.PasswordPolicy{MinLength: 8, RequireDigit: true}
+	ctx := context.Background()
+	id := createUsers(t, s, "alice")[0]
+
+	if err := s.ChangePassword(ctx, id, "wrong", "password456"); !errors.Is(err, users.ErrInvalidCredentials) {
+		t.Errorf("wrong old password: err = %v, want ErrInvalidCredentials", err)
+	}
+	if err := s.ChangePassword(ctx, id, "password123", "password"); !errors.Is(err, users.ErrPasswordNoDigit) {
+		t.Errorf("weak new password: err = %v, want ErrPasswordNoDigit", err)
+	}
+	if err := s.ChangePassword(ctx, 1000, "password123", "password456"); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("unknown user: err = %v, want ErrUserNotFound", err)
+	}
+	if err := s.ChangePassword(ctx, id, "password123", "password456"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Authenticate(ctx, "alice", "password456"); err != nil {
+		t.Errorf("new password: %v", err)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	s.PasswordPolicy = users.PasswordPolicy{MinLength: 8}
+	ctx := context.Background()
+	if _, err := s.CreateUser(ctx, &users.User{Username: "alice", Email: strptr("alice@example.com"), Password: "password123"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.IssueResetToken(ctx, "nobody@example.com"); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("unknown email: err = %v, want ErrUserNotFound", err)
+	}
+	token, err := s.IssueResetToken(ctx, "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := s.IssueResetToken(ctx, "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A password the policy rejects leaves the token usable.
+	if err := s.ResetPassword(ctx, token, "short"); !errors.Is(err, users.ErrPasswordTooShort) {
+		t.Errorf("short password: err = %v, want ErrPasswordTooShort", err)
+	}
+	if err := s.ResetPassword(ctx, token, "password456"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Authenticate(ctx, "alice", "password456"); err != nil {
+		t.Errorf("reset password: %v", err)
+	}
+
+	// Resetting the password uses up every token issued for the user.
+	for _, tok := range []string{token, other, "bogus"} {
+		if err := s.ResetPassword(ctx, tok, "password789"); !errors.Is(err, users.ErrInvalidResetToken) {
+			t.Errorf("used token: err = %v, want ErrInvalidResetToken", err)
+		}
+	}
+}
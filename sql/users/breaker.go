@@ -0,0 +1,112 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// ErrCircuitOpen is returned by a Store's methods, without running any
+// queries, while its circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// defaultBreakerFailures is the number of failures in a row that open a
+// circuit breaker given a failures count that isn't positive.
+const defaultBreakerFailures = 5
+
+// WithCircuitBreaker gives s a circuit breaker that opens after failures
+// calls of s's methods in a row have failed because the database is
+// unavailable, such as by failing to connect or losing the connection,
+// or after 5 if failures isn't positive. Timeouts don't count, since a
+// slow query times out just the same while the database is up. While
+// it's open, calls fail straight away with ErrCircuitOpen instead of
+// waiting on a database that's down. Once cooldown has passed, the next
+// call pings the database: if the ping succeeds the breaker closes and
+// the call goes ahead, and otherwise the breaker stays open for another
+// cooldown. Other errors, such as ErrUserNotFound, don't count as
+// failures. It returns s so that it can be chained onto NewStore.
+func (s *Store) WithCircuitBreaker(failures int, cooldown time.Duration) *Store {
+	if failures <= 0 {
+		failures = defaultBreakerFailures
+	}
+	s.breaker = &breaker{failures: failures, cooldown: cooldown}
+	return s
+}
+
+// A breaker is a circuit breaker set up by WithCircuitBreaker.
+type breaker struct {
+	failures int
+	cooldown time.Duration
+
+	mu        sync.Mutex
+	n         int       // failed calls in a row
+	openUntil time.Time // zero while the breaker is closed
+	probing   bool      // set while a call is pinging the database
+}
+
+// allow returns ErrCircuitOpen if b is open. Once b's cooldown has
+// passed, it pings db to find out whether b can close, and only lets a
+// single call do so at a time.
+func (b *breaker) allow(ctx context.Context, db *sql.DB) error {
+	b.mu.Lock()
+	if b.openUntil.IsZero() {
+		b.mu.Unlock()
+		return nil
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		b.mu.Unlock()
+		return ErrCircuitOpen
+	}
+	b.probing = true
+	b.mu.Unlock()
+
+	err := db.PingContext(ctx)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if err != nil {
+		b.openUntil = time.Now().Add(b.cooldown)
+		return ErrCircuitOpen
+	}
+	b.n, b.openUntil = 0, time.Time{}
+	return nil
+}
+
+// record counts a call that returned err, opening b once there have
+// been b.failures outages in a row.
+func (b *breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !isOutage(err) {
+		b.n = 0
+		return
+	}
+	b.n++
+	if b.n >= b.failures {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// isOutage reports whether err means that the connection to the database
+// failed, as opposed to the call having failed for a reason of its own,
+// including taking longer than its context allowed.
+func isOutage(err error) bool {
+	if err == nil {
+		return false
+	}
+	if isConnectFailure(err) || errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) {
+		return true
+	}
+	// Postgres reports connection failures with SQLSTATE class 08
+	// (connection_exception).
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code.Class() == "08"
+}
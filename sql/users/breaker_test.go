@@ -0,0 +1,71 @@
+package users
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+func TestIsOutage(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{ErrUserNotFound, false},
+		{context.DeadlineExceeded, false},
+		{fmt.Errorf("get user: %w", context.Canceled), false},
+		{driver.ErrBadConn, true},
+		{mysql.ErrInvalidConn, true},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{fmt.Errorf("get user: %w", &pq.Error{Code: "08006"}), true},
+		{&pq.Error{Code: "23505"}, false},
+	}
+	for _, tt := range tests {
+		if got := isOutage(tt.err); got != tt.want {
+			t.Errorf("isOutage(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestBreakerOpens(t *testing.T) {
+	b := &breaker{failures: 2, cooldown: time.Hour}
+	ctx := context.Background()
+
+	b.record(driver.ErrBadConn)
+	b.record(ErrUserNotFound) // resets the count
+	b.record(driver.ErrBadConn)
+	b.record(context.DeadlineExceeded)
+	if err := b.allow(ctx, nil); err != nil {
+		t.Fatalf("allow after one outage in a row = %v", err)
+	}
+
+	b.record(driver.ErrBadConn)
+	b.record(driver.ErrBadConn)
+	if err := b.allow(ctx, nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("allow after two outages in a row = %v, want ErrCircuitOpen", err)
+	}
+}
+
+func TestWithCircuitBreakerDefaultFailures(t *testing.T) {
+	for _, failures := range []int{0, -1} {
+		s := NewStore(nil, SQLite).WithCircuitBreaker(failures, time.Hour)
+		if s.breaker.failures != defaultBreakerFailures {
+			t.Errorf("WithCircuitBreaker(%d) opens after %d failures, want %d", failures, s.breaker.failures, defaultBreakerFailures)
+		}
+	}
+
+	// Without the default, the first outage would open the breaker.
+	b := NewStore(nil, SQLite).WithCircuitBreaker(0, time.Hour).breaker
+	b.record(driver.ErrBadConn)
+	if err := b.allow(context.Background(), nil); err != nil {
+		t.Errorf("allow after one outage = %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package users
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// builderColumns and builderOperators are the columns and comparison
+// operators that a Builder accepts. Only the SQL in these allow-lists is
+// ever put into a query, so a Builder can't be used to inject SQL.
+var (
+	builderColumns = map[string]bool{
+		"id":         true,
+		"username":   true,
+		"email":      true,
+		"role":       true,
+		"created_at": true,
+		"updated_at": true,
+	}
+	builderOperators = map[string]bool{
+		"=":    true,
+		"!=":   true,
+		"<":    true,
+		"<=":   true,
+		">":    true,
+		">=":   true,
+		"like": true,
+	}
+)
+
+// A Builder builds parameterized queries that select users matching a
+// set of conditions, for filters that aren't known until run time. Only
+// columns and operators in an allow-list can be used, while values are
+// always passed as arguments.
+//
+// A Builder's methods return the Builder so that calls can be chained.
+// The first invalid column or operator given to them is reported by Err,
+// and makes Build return an empty query.
+type Builder struct {
+	dialect Dialect
+	table   userTable
+	conds   []condition
+	orderBy string
+	limit   int
+	err     error
+}
+
+// A condition is a single where condition added with Builder.Where.
+type condition struct {
+	col, op string
+	val     interface{}
+}
+
+// NewBuilder returns a Builder for queries in dialect d on the default
+// users table. Store.NewBuilder returns one for a store's own table.
+func NewBuilder(d Dialect) *Builder {
+	return &Builder{dialect: d, table: userTable{name: defaultTableName}}
+}
+
+// NewBuilder returns a Builder for queries on s's table in s's dialect,
+// whose queries only select the users of s's tenant if it has one.
+func (s *Store) NewBuilder() *Builder {
+	return &Builder{dialect: s.dialect, table: s.table()}
+}
+
+// Where adds the condition "col op val" to the query. Conditions are
+// combined with and. The value of a like condition is a like pattern
+// that uses ! as its escape character.
+func (b *Builder) Where(col, op string, val interface{}) *Builder {
+	op = strings.ToLower(op)
+	switch {
+	case !builderColumns[col]:
+		b.setErr(fmt.Errorf("unknown column %q", col))
+	case !builderOperators[op]:
+		b.setErr(fmt.Errorf("unknown operator %q", op))
+	default:
+		b.conds = append(b.conds, condition{col: col, op: op, val: val})
+	}
+	return b
+}
+
+// OrderBy orders the query's results by col in the given order, with ties
+// broken by id.
+func (b *Builder) OrderBy(col string, order SortOrder) *Builder {
+	dir, ok := sortDirections[order]
+	switch {
+	case !builderColumns[col]:
+		b.setErr(fmt.Errorf("unknown column %q", col))
+	case !ok:
+		b.setErr(fmt.Errorf("unknown sort order %d", order))
+	case col == "id":
+		b.orderBy = "id " + dir
+	default:
+		b.orderBy = col + " " + dir + ", id " + dir
+	}
+	return b
+}
+
+// Limit limits the query to n results. A non-positive n means no limit.
+func (b *Builder) Limit(n int) *Builder {
+	b.limit = n
+	return b
+}
+
+// Err returns the first error caused by an invalid column, operator or
+// sort order given to b's methods.
+func (b *Builder) Err() error {
+	return b.err
+}
+
+func (b *Builder) setErr(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// Build returns the query built by b, which selects the users that aren't
+// soft deleted and match all of b's conditions, along with the query's
+// arguments. It returns an empty query if Err reports an error.
+func (b *Builder) Build() (string, []interface{}) {
+	if b.err != nil {
+		return "", nil
+	}
+
+	where, args := b.where(b.dialect, 1)
+	query := "select " + userColumns + " from " + b.table.name + b.table.where() + where
+	if b.orderBy != "" {
+		query += " order by " + b.orderBy
+	}
+	if b.limit > 0 {
+		query += " limit " + strconv.Itoa(b.limit)
+	}
+	return query, args
+}
+
+// where returns b's conditions as the body of a where clause for dialect
+// d, including the condition that skips soft deleted users, along with
+// their arguments. Placeholders are numbered from start.
+func (b *Builder) where(d Dialect, start int) (string, []interface{}) {
+	clauses := []string{"deleted_at is null"}
+	args := make([]interface{}, 0, len(b.conds))
+	for _, c := range b.conds {
+		clause := c.col + " " + c.op + " " + Placeholder(d, start+len(args))
+		if c.op == "like" {
+			clause += " escape '" + likeEscape + "'"
+		}
+		clauses = append(clauses, clause)
+		args = append(args, c.val)
+	}
+	return strings.Join(clauses, " and "), args
+}
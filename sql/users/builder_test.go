@@ -0,0 +1,67 @@
+package users_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+func TestBuilder(t *testing.T) {
+	query, args := users.NewBuilder(users.Postgres).
+		Where("username", "like", "a%").
+		Where("role", "=", users.RoleAdmin).
+		OrderBy("created_at", users.Desc).
+		Limit(10).
+		Build()
+	const want = " from users where deleted_at is null and username like $1 escape '!' and role = $2" +
+		" order by created_at desc, id desc limit 10"
+	if !strings.HasSuffix(query, want) {
+		t.Errorf("query = %q, want it to end with %q", query, want)
+	}
+	if len(args) != 2 || args[0] != "a%" || args[1] != users.RoleAdmin {
+		t.Errorf("args = %v", args)
+	}
+}
+
+func TestBuilderInvalid(t *testing.T) {
+	b := users.NewBuilder(users.MySQL).Where("password", "=", "x").Where("role", "or", "admin")
+	if b.Err() == nil {
+		t.Fatal("Err = nil for an unknown column")
+	}
+	if query, _ := b.Build(); query != "" {
+		t.Errorf("Build = %q, want an empty query", query)
+	}
+}
+
+func TestStoreBuilderScopedToTenant(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+	for _, tenant := range []int64{1, 2} {
+		ts := s.ForTenant(tenant)
+		username := "alice" + string(rune('0'+tenant))
+		if _, err := ts.CreateUser(ctx, &users.User{Username: username, Password: "password123"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query, args := s.ForTenant(1).NewBuilder().Where("username", "like", "alice%").Build()
+	rows, err := s.Query(ctx, query, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms, err := users.ScanMaps(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 1 || ms[0]["username"] != "alice1" {
+		t.Errorf("query %q returned %v, want only alice1", query, ms)
+	}
+
+	s.TableName = "accounts"
+	if query, _ := s.NewBuilder().Build(); !strings.Contains(query, " from accounts where ") {
+		t.Errorf("query %q doesn't select from the store's table", query)
+	}
+}
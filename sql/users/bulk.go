@@ -0,0 +1,405 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// bulkInsertBatchSize is the number of users inserted by each statement
+// run by CreateUsers. Every user takes numInsertUserColumns placeholders,
+// which keeps each statement well under the placeholder limits of the
+// supported databases.
+const bulkInsertBatchSize = 1000
+
+// CreateUsers inserts users using multi-row insert statements, which is
+// much faster than inserting them one at a time with CreateUser. All of
+// the users are inserted in a single transaction, so either all of them
+// are inserted or none of them are. It returns the number of users that
+// were inserted.
+//
+// Like CreateUser, each user is validated, and its password checked
+// against s.PasswordPolicy and hashed, before it's inserted. Unlike
+// CreateUser, the users' ids are not set, since not every database
+// reports the ids generated by a multi-row insert.
+//
+// Once the users have been committed, the hooks are told about each of
+// them, also without their ids.
+func (s *Store) CreateUsers(ctx context.Context, users []*User) (inserted int, err error) {
+	ctx, op, err := s.startOp(ctx, "CreateUsers")
+	if err != nil {
+		return 0, err
+	}
+	defer func() { op.end(err, inserted) }()
+
+	if len(users) == 0 {
+		return 0, nil
+	}
+
+	now := time.Now().UTC()
+	args := make([]interface{}, 0, len(users)*numInsertUserColumns)
+	for i, u := range users {
+		s.normalize(u)
+		if err := u.Validate(); err != nil {
+			return 0, fmt.Errorf("create users: user %d: %w", i, err)
+		}
+		if err := s.PasswordPolicy.Validate(u.Password); err != nil {
+			return 0, fmt.Errorf("create users: user %d: %w", i, err)
+		}
+		hash, err := s.hashPassword(u.Password)
+		if err != nil {
+			return 0, fmt.Errorf("create users: user %d: %w", i, err)
+		}
+		args = append(args, u.Username, u.Email, hash, u.Role, now, now, jsonMap(u.Metadata))
+	}
+
+	inserted, err = s.bulkInsertUsers(ctx, "create users", args)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, u := range users {
+		u.Password = args[i*numInsertUserColumns+2].(string)
+		u.CreatedAt = now
+		u.Version = 1
+		u.UpdatedAt = now
+	}
+
+	return inserted, s.runHooksForEach(ctx, hookCreate, users)
+}
+
+// bulkInsertUsers inserts the users whose insertUserColumns are given in
+// args, in batches of bulkInsertBatchSize users within a single
+// transaction, which is retried if it fails with a transient error. It
+// returns the number of users inserted. Errors are prefixed with op.
+func (s *Store) bulkInsertUsers(ctx context.Context, op string, args []interface{}) (int, error) {
+	var inserted int
+	err := s.withRetry(ctx, func() error {
+		inserted = 0
+		return s.withTx(ctx, func(tx *sql.Tx) error {
+			return s.insertBatches(ctx, tx, op, args, &inserted)
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	return inserted, nil
+}
+
+// insertBatches runs the inserts for bulkInsertUsers in tx, adding the
+// number of users inserted to inserted.
+func (s *Store) insertBatches(ctx context.Context, tx *sql.Tx, op string, args []interface{}, inserted *int) error {
+	numUsers := len(args) / numInsertUserColumns
+	for start := 0; start < numUsers; start += bulkInsertBatchSize {
+		n := numUsers - start
+		if n > bulkInsertBatchSize {
+			n = bulkInsertBatchSize
+		}
+
+		query := bulkInsertUsersQuery(s.dialect, s.table(), n)
+		batch := args[start*numInsertUserColumns : (start+n)*numInsertUserColumns]
+		res, err := tx.ExecContext(ctx, query, batch...)
+		if err != nil {
+			if dupErr := uniqueViolation(op, err); dupErr != nil {
+				return dupErr
+			}
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		numAffected, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		*inserted += int(numAffected)
+	}
+	return nil
+}
+
+// lookupBatchSize is the number of users looked up by each query run by
+// GetOrCreateUsers and GetUsersByIDs, which keeps it well under the
+// placeholder limits of the supported databases.
+const lookupBatchSize = 1000
+
+// GetOrCreateUsers returns a user for each distinct username in users,
+// in the order the usernames first appear, such as for syncing users
+// from another system. Users that already exist are read from the
+// database, while the others are created like CreateUser and returned
+// with their ids set. Only the first of several users with the same
+// username is used.
+//
+// The lookup and the inserts run in a single transaction, so either all
+// of the missing users are created or none of them are. A username that
+// belongs to a soft deleted user can't be created again, so the call
+// fails with ErrDuplicateUsername, as it does if another call creates
+// one of the users concurrently.
+func (s *Store) GetOrCreateUsers(ctx context.Context, users []*User) (result []*User, err error) {
+	ctx, op, err := s.startOp(ctx, "GetOrCreateUsers")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { op.end(err, len(result)) }()
+
+	var unique []*User
+	seen := make(map[string]bool, len(users))
+	for _, u := range users {
+		s.normalize(u)
+		if !seen[u.Username] {
+			seen[u.Username] = true
+			unique = append(unique, u)
+		}
+	}
+	if len(unique) == 0 {
+		return nil, nil
+	}
+
+	// Unlike CreateUsers, the transaction isn't retried, since creating
+	// a user replaces its plaintext password with the hash.
+	result = make([]*User, len(unique))
+	var created []*User
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		created, err = s.getOrCreateUsers(ctx, s.txStore(tx), unique, result)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, s.runHooksForEach(ctx, hookCreate, created)
+}
+
+// getOrCreateUsers fills result with the users for GetOrCreateUsers,
+// using ts, which runs its queries in the call's transaction, and returns
+// the users it created.
+func (s *Store) getOrCreateUsers(ctx context.Context, ts *Store, unique, result []*User) (created []*User, err error) {
+	existing := make(map[string]*User, len(unique))
+	for start := 0; start < len(unique); start += lookupBatchSize {
+		end := start + lookupBatchSize
+		if end > len(unique) {
+			end = len(unique)
+		}
+		args := make([]interface{}, 0, end-start)
+		for _, u := range unique[start:end] {
+			args = append(args, u.Username)
+		}
+		found, err := ts.queryUsers(ctx, selectUsersByUsernamesQuery(s.dialect, s.table(), len(args)), args...)
+		if err != nil {
+			return nil, fmt.Errorf("get or create users: %w", err)
+		}
+		for _, u := range found {
+			// Users created before usernames became case-insensitive
+			// may have upper case letters in theirs.
+			if s.CaseInsensitiveUsernames {
+				existing[strings.ToLower(u.Username)] = u
+			} else {
+				existing[u.Username] = u
+			}
+		}
+	}
+
+	for i, u := range unique {
+		if found, ok := existing[u.Username]; ok {
+			result[i] = found
+			continue
+		}
+		if _, err := ts.createUser(ctx, "get or create users", u); err != nil {
+			return nil, err
+		}
+		result[i] = u
+		created = append(created, u)
+	}
+	return created, nil
+}
+
+// deleteBatchSize is the number of ids in each statement run by
+// DeleteUsersByIDs, which keeps it well under the placeholder limits of
+// the supported databases.
+const deleteBatchSize = 1000
+
+// DeleteUsersByIDs soft deletes the users with the given ids, like
+// DeleteUser, and returns the number of users deleted. Ids that don't
+// belong to a user, or belong to one that's already deleted, are skipped.
+//
+// Up to deleteBatchSize users are deleted by each statement. The
+// statements aren't run in a transaction, so if one fails, the users
+// deleted by earlier ones stay deleted and are included in the returned
+// count, and the call can be safely repeated.
+//
+// The hooks are told about the users deleted by each statement once it
+// has run. For them to know which users those are, if s has any hooks,
+// each statement runs in a transaction that first selects and locks the
+// users it deletes.
+func (s *Store) DeleteUsersByIDs(ctx context.Context, ids []int) (deleted int, err error) {
+	ctx, op, err := s.startOp(ctx, "DeleteUsersByIDs")
+	if err != nil {
+		return 0, err
+	}
+	defer func() { op.end(err, deleted) }()
+
+	now := time.Now().UTC()
+	var hookErrs []error
+	for start := 0; start < len(ids); start += deleteBatchSize {
+		end := start + deleteBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batch := ids[start:end]
+		args := make([]interface{}, len(batch))
+		for i, id := range batch {
+			args[i] = id
+		}
+
+		if len(s.Hooks) > 0 && !s.DryRun {
+			deletedIDs, err := s.deleteLockedUsers(ctx, now, lockUserIDsQuery(s.dialect, s.table(), len(batch)), args...)
+			s.invalidate(batch...)
+			if err != nil {
+				return deleted, fmt.Errorf("delete users by ids: %w", err)
+			}
+			deleted += len(deletedIDs)
+			hookErrs = append(hookErrs, s.runDeleteHooks(ctx, deletedIDs))
+			continue
+		}
+
+		res, err := s.execDestructive(ctx, "DeleteUsersByIDs",
+			deleteUsersByIDsQuery(s.dialect, s.table(), len(batch)), append([]interface{}{now}, args...),
+			countUsersByIDsQuery(s.dialect, s.table(), len(batch)), args...)
+		s.invalidate(batch...)
+		if err != nil {
+			return deleted, fmt.Errorf("delete users by ids: %w", err)
+		}
+		numAffected, err := res.RowsAffected()
+		if err != nil {
+			return deleted, fmt.Errorf("delete users by ids: %w", err)
+		}
+		deleted += int(numAffected)
+	}
+	return deleted, errors.Join(hookErrs...)
+}
+
+// DeleteInactiveUsers soft deletes the users who last signed in before
+// before, like DeleteUser, and returns the number of users deleted. Users
+// who have never signed in aren't deleted. If maxRows is not positive,
+// deleteBatchSize is used instead.
+//
+// The users are deleted maxRows at a time, by statements that each run
+// on their own, until one deletes fewer than maxRows users, so that no
+// statement holds locks on many rows for long. If one fails, the users
+// deleted by earlier ones stay deleted and are included in the returned
+// count, and the call can be safely repeated.
+//
+// If s.DryRun is set, the single statement that would delete the first
+// batch is logged, and the number of users that would be deleted in all
+// is returned.
+//
+// The hooks are told about the users deleted by each statement once it
+// has run, like DeleteUsersByIDs.
+func (s *Store) DeleteInactiveUsers(ctx context.Context, before time.Time, maxRows int) (deleted int, err error) {
+	ctx, op, err := s.startOp(ctx, "DeleteInactiveUsers")
+	if err != nil {
+		return 0, err
+	}
+	defer func() { op.end(err, deleted) }()
+
+	if maxRows <= 0 {
+		maxRows = deleteBatchSize
+	}
+
+	// Any of the cached users may be deleted.
+	defer s.invalidateAll()
+
+	now := time.Now().UTC()
+	if len(s.Hooks) > 0 && !s.DryRun {
+		var hookErrs []error
+		for {
+			deletedIDs, err := s.deleteLockedUsers(ctx, now, lockInactiveUserIDsQuery(s.dialect, s.table()), before, maxRows)
+			if err != nil {
+				return deleted, fmt.Errorf("delete inactive users: %w", err)
+			}
+			deleted += len(deletedIDs)
+			hookErrs = append(hookErrs, s.runDeleteHooks(ctx, deletedIDs))
+			if len(deletedIDs) < maxRows {
+				return deleted, errors.Join(hookErrs...)
+			}
+		}
+	}
+
+	for {
+		res, err := s.execDestructive(ctx, "DeleteInactiveUsers",
+			deleteInactiveUsersQuery(s.dialect, s.table()), []interface{}{now, before, maxRows},
+			countInactiveUsersQuery(s.dialect, s.table()), before)
+		if err != nil {
+			return deleted, fmt.Errorf("delete inactive users: %w", err)
+		}
+		numAffected, err := res.RowsAffected()
+		if err != nil {
+			return deleted, fmt.Errorf("delete inactive users: %w", err)
+		}
+		deleted += int(numAffected)
+
+		// Nothing is deleted in dry run mode, so every statement would
+		// affect the same users, which the count has already covered.
+		if s.DryRun || int(numAffected) < maxRows {
+			return deleted, nil
+		}
+	}
+}
+
+// deleteLockedUsers soft deletes the users whose ids are selected by
+// lockQuery, one of the queries that lock the users they select, run with
+// args. Both statements run in a transaction, which is retried if it fails
+// with a transient error. It returns the ids of the deleted users.
+func (s *Store) deleteLockedUsers(ctx context.Context, now time.Time, lockQuery string, args ...interface{}) ([]int, error) {
+	var ids []int
+	err := s.withRetry(ctx, func() error {
+		return s.withTx(ctx, func(tx *sql.Tx) error {
+			var err error
+			ids, err = queryIDs(ctx, tx, lockQuery, args...)
+			if err != nil || len(ids) == 0 {
+				return err
+			}
+			delArgs := make([]interface{}, 0, 1+len(ids))
+			delArgs = append(delArgs, now)
+			for _, id := range ids {
+				delArgs = append(delArgs, id)
+			}
+			_, err = tx.ExecContext(ctx, deleteUsersByIDsQuery(s.dialect, s.table(), len(ids)), delArgs...)
+			return err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// runDeleteHooks tells the hooks about the deleted users with the given
+// ids.
+func (s *Store) runDeleteHooks(ctx context.Context, ids []int) error {
+	deleted := make([]*User, len(ids))
+	for i, id := range ids {
+		deleted[i] = &User{Id: id}
+	}
+	return s.runHooksForEach(ctx, hookDelete, deleted)
+}
+
+// queryIDs runs query, which selects a single id column, with args in q,
+// and returns the ids.
+func queryIDs(ctx context.Context, q querier, query string, args ...interface{}) ([]int, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,203 @@
+package users_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+// newUsers returns n users named user0 to user<n-1>, with prefix in front
+// of their names.
+func newUsers(prefix string, n int) []*users.User {
+	list := make([]*users.User, n)
+	for i := range list {
+		list[i] = &users.User{Username: prefix + strconv.Itoa(i), Password: "password123"}
+	}
+	return list
+}
+
+func TestCreateUsers(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	s.Hasher = plainHasher{}
+	ctx := context.Background()
+
+	// More users than fit in one statement.
+	n, err := s.CreateUsers(ctx, newUsers("user", 1500))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1500 {
+		t.Errorf("CreateUsers inserted %d users, want 1500", n)
+	}
+	if count, err := s.CountUsers(ctx); err != nil || count != 1500 {
+		t.Errorf("CountUsers = %d, %v; want 1500, nil", count, err)
+	}
+
+	// One bad user stops all of them being inserted.
+	batch := newUsers("new", 3)
+	batch[2].Username = "user7"
+	if _, err := s.CreateUsers(ctx, batch); !errors.Is(err, users.ErrDuplicateUsername) {
+		t.Errorf("taken username: err = %v, want ErrDuplicateUsername", err)
+	}
+	batch = newUsers("new", 3)
+	batch[1].Role = "root"
+	if _, err := s.CreateUsers(ctx, batch); !errors.Is(err, users.ErrInvalidRole) {
+		t.Errorf("invalid role: err = %v, want ErrInvalidRole", err)
+	}
+	if exists, err := s.UserExists(ctx, "new0"); err != nil || exists {
+		t.Errorf("UserExists(new0) = %v, %v; want false, nil", exists, err)
+	}
+}
+
+func TestGetOrCreateUsers(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+	ids := createUsers(t, s, "alice")
+
+	result, err := s.GetOrCreateUsers(ctx, []*users.User{
+		{Username: "bob", Password: "password123"},
+		{Username: "alice", Password: "ignored123"},
+		{Username: "bob", Password: "ignored123"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := usernames(result); got != "bob alice" {
+		t.Fatalf("usernames = %q, want %q", got, "bob alice")
+	}
+	if result[1].Id != ids[0] {
+		t.Errorf("alice has id %d, want her existing id %d", result[1].Id, ids[0])
+	}
+	if result[0].Id == 0 {
+		t.Error("bob was returned without an id")
+	}
+}
+
+func TestDeleteUsersByIDs(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+	ids := createUsers(t, s, "alice", "bob", "carol")
+
+	n, err := s.DeleteUsersByIDs(ctx, []int{ids[0], ids[1], 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("deleted %d users, want 2", n)
+	}
+	if count, err := s.CountUsers(ctx); err != nil || count != 1 {
+		t.Errorf("CountUsers = %d, %v; want 1, nil", count, err)
+	}
+}
+
+func TestDeleteUsersByIDsInBatches(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	s.Hasher = plainHasher{}
+	ctx := context.Background()
+	if _, err := s.CreateUsers(ctx, newUsers("user", 1500)); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := s.DeleteUsersByIDs(ctx, nil); err != nil || n != 0 {
+		t.Errorf("DeleteUsersByIDs(nil) = %d, %v, want 0, nil", n, err)
+	}
+
+	// More ids than fit in one statement, leaving the last user alone.
+	ids := make([]int, 1499)
+	for i := range ids {
+		ids[i] = i + 1
+	}
+	n, err := s.DeleteUsersByIDs(ctx, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1499 {
+		t.Errorf("deleted %d users, want 1499", n)
+	}
+	if count, err := s.CountUsers(ctx); err != nil || count != 1 {
+		t.Errorf("CountUsers = %d, %v; want 1, nil", count, err)
+	}
+}
+
+func TestDeleteInactiveUsers(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+	ids := createUsers(t, s, "alice", "bob", "carol", "dave")
+	for _, id := range ids[:3] {
+		if err := s.RecordLogin(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// dave has never signed in, so he's kept, while the others are
+	// deleted two at a time.
+	n, err := s.DeleteInactiveUsers(ctx, time.Now().Add(time.Hour), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("deleted %d users, want 3", n)
+	}
+	if _, err := s.GetUserByUsername(ctx, "dave"); err != nil {
+		t.Errorf("dave: %v", err)
+	}
+}
+
+func TestBulkSetRoles(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+	ids := createUsers(t, s, "alice", "bob")
+
+	if err := s.BulkSetRoles(ctx, map[int]string{ids[0]: users.RoleAdmin, ids[1]: "root"}); !errors.Is(err, users.ErrInvalidRole) {
+		t.Errorf("invalid role: err = %v, want ErrInvalidRole", err)
+	}
+	if err := s.BulkSetRoles(ctx, map[int]string{ids[0]: users.RoleAdmin, 1000: users.RoleAdmin}); err != nil {
+		t.Fatal(err)
+	}
+
+	admins, err := s.ListUsersByRole(ctx, users.RoleAdmin, users.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := usernames(admins); got != "alice" {
+		t.Errorf("admins = %q, want %q", got, "alice")
+	}
+}
+
+func BenchmarkCreateUsers(b *testing.B) {
+	// Passwords aren't hashed, so that the benchmarks compare the
+	// inserts.
+	const n = 100
+	for _, bulk := range []bool{false, true} {
+		name := "OneAtATime"
+		if bulk {
+			name = "Bulk"
+		}
+		b.Run(name, func(b *testing.B) {
+			s := dbtest.NewTestStore(b)
+			s.Hasher = plainHasher{}
+			ctx := context.Background()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				batch := newUsers(strconv.Itoa(i)+"-", n)
+				if bulk {
+					if _, err := s.CreateUsers(ctx, batch); err != nil {
+						b.Fatal(err)
+					}
+					continue
+				}
+				for _, u := range batch {
+					if _, err := s.CreateUser(ctx, u); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package users
+
+import (
+	"sync"
+	"time"
+)
+
+// A userCache holds the users read by GetUserByID, keyed by id, for
+// stores with a CacheTTL. Entries are expired lazily: an expired entry
+// stays in the map until its id is next looked up or invalidated.
+type userCache struct {
+	mu      sync.Mutex
+	entries map[int]cacheEntry
+}
+
+// A cacheEntry is a cached user along with the time it expires.
+type cacheEntry struct {
+	u       *User
+	expires time.Time
+}
+
+// get returns a copy of the cached user with the given id, if there's
+// one that hasn't expired by now.
+func (c *userCache) get(id int, now time.Time) (*User, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[id]
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(e.expires) {
+		delete(c.entries, id)
+		return nil, false
+	}
+	return copyUser(e.u), true
+}
+
+// put caches a copy of u until expires.
+func (c *userCache) put(u *User, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[int]cacheEntry)
+	}
+	c.entries[u.Id] = cacheEntry{u: copyUser(u), expires: expires}
+}
+
+// invalidate removes the users with the given ids from the cache.
+func (c *userCache) invalidate(ids ...int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, id := range ids {
+		delete(c.entries, id)
+	}
+}
+
+// invalidateAll removes every user from the cache.
+func (c *userCache) invalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = nil
+}
+
+// copyUser returns a copy of u that shares no memory with it, so that
+// callers can't change the cached users through the ones they're given.
+func copyUser(u *User) *User {
+	c := *u
+	if u.Email != nil {
+		email := *u.Email
+		c.Email = &email
+	}
+	if u.LastLoginAt != nil {
+		t := *u.LastLoginAt
+		c.LastLoginAt = &t
+	}
+	if u.LockedUntil != nil {
+		t := *u.LockedUntil
+		c.LockedUntil = &t
+	}
+	if u.Metadata != nil {
+		c.Metadata = copyJSON(u.Metadata).(map[string]interface{})
+	}
+	return &c
+}
@@ -0,0 +1,78 @@
+package users_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+func TestCache(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	s.CacheTTL = time.Hour
+	ctx := context.Background()
+	id := createUsers(t, s, "alice")[0]
+
+	u, err := s.GetUserByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Changing the returned user mustn't change the cached one.
+	u.Username = "changed"
+
+	// Exec doesn't invalidate the cache, so the cached user is returned.
+	if _, err := s.Exec(ctx, "update users set username = 'alicia' where id = ?", id); err != nil {
+		t.Fatal(err)
+	}
+	u, err = s.GetUserByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Username != "alice" {
+		t.Errorf("cached username = %q, want %q", u.Username, "alice")
+	}
+
+	// The store's own writes do invalidate it.
+	if err := s.SetRole(ctx, id, users.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	u, err = s.GetUserByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Username != "alicia" || u.Role != users.RoleAdmin {
+		t.Errorf("after SetRole got %q with role %q, want alicia with role admin", u.Username, u.Role)
+	}
+
+	if err := s.DeleteUser(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetUserByID(ctx, id); err == nil {
+		t.Error("GetUserByID returned a deleted user from the cache")
+	}
+}
+
+func TestCacheExpires(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	s.CacheTTL = time.Millisecond
+	ctx := context.Background()
+	id := createUsers(t, s, "alice")[0]
+
+	if _, err := s.GetUserByID(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Exec(ctx, "update users set username = 'alicia' where id = ?", id); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	u, err := s.GetUserByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Username != "alicia" {
+		t.Errorf("username = %q after the cache expired, want %q", u.Username, "alicia")
+	}
+}
@@ -0,0 +1,89 @@
+package users_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+func TestCaseSensitiveUsernames(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+	ids := createUsers(t, s, "Alice", "alice", "bob")
+
+	u, err := s.GetUserByUsername(ctx, "Alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Id != ids[0] {
+		t.Errorf("GetUserByUsername(Alice) returned user %d, want %d", u.Id, ids[0])
+	}
+	if _, err := s.GetUserByUsername(ctx, "ALICE"); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("GetUserByUsername(ALICE): err = %v, want ErrUserNotFound", err)
+	}
+
+	bob, err := s.GetUserByID(ctx, ids[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob.Username = "ALICE"
+	if err := s.UpdateUser(ctx, bob); err != nil {
+		t.Errorf("renaming bob to ALICE: %v", err)
+	}
+	bob.Username = "alice"
+	if err := s.UpdateUser(ctx, bob); !errors.Is(err, users.ErrDuplicateUsername) {
+		t.Errorf("renaming bob to alice: err = %v, want ErrDuplicateUsername", err)
+	}
+}
+
+func TestCaseInsensitiveUsernames(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+
+	// Users created before the setting was turned on keep their case,
+	// but are still found.
+	legacy := createUsers(t, s, "Carol")[0]
+	s.CaseInsensitiveUsernames = true
+	ids := createUsers(t, s, "Alice", "bob")
+
+	u, err := s.GetUserByUsername(ctx, "aLiCe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Id != ids[0] || u.Username != "alice" {
+		t.Errorf("GetUserByUsername(aLiCe) = user %d %q, want %d alice", u.Id, u.Username, ids[0])
+	}
+	if u, err := s.GetUserByUsername(ctx, "carol"); err != nil || u.Id != legacy {
+		t.Errorf("GetUserByUsername(carol) = %v, %v, want user %d", u, err, legacy)
+	}
+	if exists, err := s.UserExists(ctx, "ALICE"); err != nil || !exists {
+		t.Errorf("UserExists(ALICE) = %t, %v, want true", exists, err)
+	}
+	if _, err := s.Authenticate(ctx, "ALICE", "password123"); err != nil {
+		t.Errorf("Authenticate(ALICE): %v", err)
+	}
+
+	_, err = s.CreateUser(ctx, &users.User{Username: "ALICE", Password: "password123"})
+	if !errors.Is(err, users.ErrDuplicateUsername) {
+		t.Errorf("creating ALICE: err = %v, want ErrDuplicateUsername", err)
+	}
+
+	bob, err := s.GetUserByID(ctx, ids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob.Username = "ALICE"
+	if err := s.UpdateUser(ctx, bob); !errors.Is(err, users.ErrDuplicateUsername) {
+		t.Errorf("renaming bob to ALICE: err = %v, want ErrDuplicateUsername", err)
+	}
+	bob.Username = "Robert"
+	if err := s.UpdateUser(ctx, bob); err != nil {
+		t.Fatal(err)
+	}
+	if bob.Username != "robert" {
+		t.Errorf("UpdateUser stored username %q, want robert", bob.Username)
+	}
+}
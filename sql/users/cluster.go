@@ -0,0 +1,440 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// A Cluster routes queries between a primary database and its read
+// replicas. Writes always go to the primary, while reads are spread
+// across the replicas in turn.
+//
+// Since replicas can lag behind the primary, a read that must see an
+// earlier write should use a context returned by ReadPrimary.
+type Cluster struct {
+	primary  *Store
+	replicas []*Store
+	next     atomic.Uint64 // index of the next replica to read from
+}
+
+// NewCluster returns a Cluster that writes to primary and reads from
+// replicas, using the MySQL dialect. If there are no replicas, reads go
+// to the primary.
+func NewCluster(primary *sql.DB, replicas ...*sql.DB) *Cluster {
+	return NewClusterWithDialect(MySQL, primary, replicas...)
+}
+
+// NewClusterWithDialect is like NewCluster, but the databases have
+// dialect d.
+func NewClusterWithDialect(d Dialect, primary *sql.DB, replicas ...*sql.DB) *Cluster {
+	c := &Cluster{primary: NewStore(primary, d)}
+	for _, db := range replicas {
+		c.replicas = append(c.replicas, NewStore(db, d))
+	}
+	return c
+}
+
+// Primary returns the store for the primary database. Its settings, such
+// as RedactPasswords, TableName and Hooks, are the cluster's: reads from
+// the replicas use whatever they are at the time of the read. They should
+// be set before the cluster is used, like a Store's.
+func (c *Cluster) Primary() *Store {
+	return c.primary
+}
+
+// ForTenant returns a Cluster that only sees the users of the tenant with
+// the given id, on the primary and the replicas alike. See
+// Store.ForTenant.
+func (c *Cluster) ForTenant(tenantID int64) *Cluster {
+	return &Cluster{primary: c.primary.ForTenant(tenantID), replicas: c.replicas}
+}
+
+// readPrimaryKey is the context key used by ReadPrimary.
+type readPrimaryKey struct{}
+
+// ReadPrimary returns a copy of ctx that makes a Cluster's reads go to the
+// primary, for reads that must see the cluster's earlier writes.
+func ReadPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readPrimaryKey{}, true)
+}
+
+// reader returns the store that a read using ctx should go to.
+func (c *Cluster) reader(ctx context.Context) *Store {
+	if len(c.replicas) == 0 || ctx.Value(readPrimaryKey{}) != nil {
+		return c.primary
+	}
+	n := c.next.Add(1) - 1
+	return c.replica(int(n % uint64(len(c.replicas))))
+}
+
+// replica returns a store with the primary's current settings, including
+// its tenant, that reads from the i'th replica and shares its state, such
+// as its circuit breaker and the operations Shutdown waits for. Like the
+// stores created by ForTenant, it doesn't cache users or use prepared
+// statements.
+func (c *Cluster) replica(i int) *Store {
+	r := c.replicas[i]
+	rs := c.primary.derive()
+	rs.base, rs.breaker = r, r.breaker
+	return rs
+}
+
+// each calls fn with the primary and then every replica, as returned by
+// replica, and returns the errors it returns joined together.
+func (c *Cluster) each(fn func(s *Store) error) error {
+	var errs []error
+	if err := fn(c.primary); err != nil {
+		errs = append(errs, fmt.Errorf("primary: %w", err))
+	}
+	for i := range c.replicas {
+		if err := fn(c.replica(i)); err != nil {
+			errs = append(errs, fmt.Errorf("replica %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CreateUser creates a user on the primary. See Store.CreateUser.
+func (c *Cluster) CreateUser(ctx context.Context, u *User) (int64, error) {
+	return c.primary.CreateUser(ctx, u)
+}
+
+// UpdateUser updates a user on the primary. See Store.UpdateUser.
+func (c *Cluster) UpdateUser(ctx context.Context, u *User) error {
+	return c.primary.UpdateUser(ctx, u)
+}
+
+// DeleteUser deletes a user on the primary. See Store.DeleteUser.
+func (c *Cluster) DeleteUser(ctx context.Context, id int) error {
+	return c.primary.DeleteUser(ctx, id)
+}
+
+// GetUserByID reads a user from a replica. See Store.GetUserByID.
+func (c *Cluster) GetUserByID(ctx context.Context, id int) (*User, error) {
+	return c.reader(ctx).GetUserByID(ctx, id)
+}
+
+// GetUserByUsername reads a user from a replica. See
+// Store.GetUserByUsername.
+func (c *Cluster) GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	return c.reader(ctx).GetUserByUsername(ctx, username)
+}
+
+// GetUserByEmail reads a user from a replica. See Store.GetUserByEmail.
+func (c *Cluster) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	return c.reader(ctx).GetUserByEmail(ctx, email)
+}
+
+// ListUsers reads a page of users from a replica. See Store.ListUsers.
+func (c *Cluster) ListUsers(ctx context.Context, opts ListOptions) ([]*User, error) {
+	return c.reader(ctx).ListUsers(ctx, opts)
+}
+
+// CreateUsers creates users on the primary. See Store.CreateUsers.
+func (c *Cluster) CreateUsers(ctx context.Context, users []*User) (int, error) {
+	return c.primary.CreateUsers(ctx, users)
+}
+
+// CreateUserIdempotent creates a user on the primary. See
+// Store.CreateUserIdempotent.
+func (c *Cluster) CreateUserIdempotent(ctx context.Context, key string, u *User) (*User, error) {
+	return c.primary.CreateUserIdempotent(ctx, key, u)
+}
+
+// GetOrCreateUsers reads and creates users on the primary, since the
+// users it creates must be seen by its reads. See Store.GetOrCreateUsers.
+func (c *Cluster) GetOrCreateUsers(ctx context.Context, users []*User) ([]*User, error) {
+	return c.primary.GetOrCreateUsers(ctx, users)
+}
+
+// UpsertUser creates or updates a user on the primary. See
+// Store.UpsertUser.
+func (c *Cluster) UpsertUser(ctx context.Context, u *User) (bool, error) {
+	return c.primary.UpsertUser(ctx, u)
+}
+
+// ImportCSV creates users on the primary. See Store.ImportCSV.
+func (c *Cluster) ImportCSV(ctx context.Context, r io.Reader) (int, error) {
+	return c.primary.ImportCSV(ctx, r)
+}
+
+// SetRole sets a user's role on the primary. See Store.SetRole.
+func (c *Cluster) SetRole(ctx context.Context, id int, role string) error {
+	return c.primary.SetRole(ctx, id, role)
+}
+
+// BulkSetRoles sets users' roles on the primary. See Store.BulkSetRoles.
+func (c *Cluster) BulkSetRoles(ctx context.Context, userRoles map[int]string) error {
+	return c.primary.BulkSetRoles(ctx, userRoles)
+}
+
+// DeleteUsersByIDs deletes users on the primary. See
+// Store.DeleteUsersByIDs.
+func (c *Cluster) DeleteUsersByIDs(ctx context.Context, ids []int) (int, error) {
+	return c.primary.DeleteUsersByIDs(ctx, ids)
+}
+
+// DeleteInactiveUsers deletes users on the primary. See
+// Store.DeleteInactiveUsers.
+func (c *Cluster) DeleteInactiveUsers(ctx context.Context, before time.Time, maxRows int) (int, error) {
+	return c.primary.DeleteInactiveUsers(ctx, before, maxRows)
+}
+
+// HardDeleteUser permanently deletes a user on the primary. See
+// Store.HardDeleteUser.
+func (c *Cluster) HardDeleteUser(ctx context.Context, id int) error {
+	return c.primary.HardDeleteUser(ctx, id)
+}
+
+// RestoreUser restores a deleted user on the primary. See
+// Store.RestoreUser.
+func (c *Cluster) RestoreUser(ctx context.Context, id int) error {
+	return c.primary.RestoreUser(ctx, id)
+}
+
+// Authenticate checks a user's password on the primary, which records
+// failed attempts and rehashes weak passwords. See Store.Authenticate.
+func (c *Cluster) Authenticate(ctx context.Context, username, plain string) (*User, error) {
+	return c.primary.Authenticate(ctx, username, plain)
+}
+
+// RecordLogin records a user's sign in on the primary. See
+// Store.RecordLogin.
+func (c *Cluster) RecordLogin(ctx context.Context, id int) error {
+	return c.primary.RecordLogin(ctx, id)
+}
+
+// ChangePassword changes a user's password on the primary. See
+// Store.ChangePassword.
+func (c *Cluster) ChangePassword(ctx context.Context, id int, oldPlain, newPlain string) error {
+	return c.primary.ChangePassword(ctx, id, oldPlain, newPlain)
+}
+
+// RemovePassword removes a user's password on the primary. See
+// Store.RemovePassword.
+func (c *Cluster) RemovePassword(ctx context.Context, id int) error {
+	return c.primary.RemovePassword(ctx, id)
+}
+
+// IssueResetToken issues a password reset token on the primary. See
+// Store.IssueResetToken.
+func (c *Cluster) IssueResetToken(ctx context.Context, email string) (string, error) {
+	return c.primary.IssueResetToken(ctx, email)
+}
+
+// ResetPassword resets a user's password on the primary. See
+// Store.ResetPassword.
+func (c *Cluster) ResetPassword(ctx context.Context, token, newPlain string) error {
+	return c.primary.ResetPassword(ctx, token, newPlain)
+}
+
+// RehashWeakPasswords rehashes passwords on the primary. See
+// Store.RehashWeakPasswords.
+func (c *Cluster) RehashWeakPasswords(ctx context.Context, minCost int) (int, error) {
+	return c.primary.RehashWeakPasswords(ctx, minCost)
+}
+
+// GetUsersByIDs reads users from a replica. See Store.GetUsersByIDs.
+func (c *Cluster) GetUsersByIDs(ctx context.Context, ids []int) (map[int]*User, error) {
+	return c.reader(ctx).GetUsersByIDs(ctx, ids)
+}
+
+// UserExists checks for a user on a replica. See Store.UserExists.
+func (c *Cluster) UserExists(ctx context.Context, username string) (bool, error) {
+	return c.reader(ctx).UserExists(ctx, username)
+}
+
+// CountUsers counts the users on a replica. See Store.CountUsers.
+func (c *Cluster) CountUsers(ctx context.Context) (int, error) {
+	return c.reader(ctx).CountUsers(ctx)
+}
+
+// ListUsersAfter reads a page of users from a replica. See
+// Store.ListUsersAfter.
+func (c *Cluster) ListUsersAfter(ctx context.Context, afterID int, limit int) ([]*User, int, error) {
+	return c.reader(ctx).ListUsersAfter(ctx, afterID, limit)
+}
+
+// ListUsersByRole reads a page of users from a replica. See
+// Store.ListUsersByRole.
+func (c *Cluster) ListUsersByRole(ctx context.Context, role string, opts ListOptions) ([]*User, error) {
+	return c.reader(ctx).ListUsersByRole(ctx, role, opts)
+}
+
+// Search searches the users on a replica. See Store.Search.
+func (c *Cluster) Search(ctx context.Context, term string, opts ListOptions) ([]*User, error) {
+	return c.reader(ctx).Search(ctx, term, opts)
+}
+
+// SearchUsersByPrefix searches the users on a replica. See
+// Store.SearchUsersByPrefix.
+func (c *Cluster) SearchUsersByPrefix(ctx context.Context, prefix string, limit int) ([]*User, error) {
+	return c.reader(ctx).SearchUsersByPrefix(ctx, prefix, limit)
+}
+
+// Iterate iterates over the users on a replica. Every page is read from
+// the same replica. See Store.Iterate.
+func (c *Cluster) Iterate(ctx context.Context, pageSize int) *UserIterator {
+	return c.reader(ctx).Iterate(ctx, pageSize)
+}
+
+// StreamUsers streams the users on a replica. See Store.StreamUsers.
+func (c *Cluster) StreamUsers(ctx context.Context) (<-chan *User, <-chan error) {
+	return c.reader(ctx).StreamUsers(ctx)
+}
+
+// ExportCSV writes the users on a replica as CSV. See Store.ExportCSV.
+func (c *Cluster) ExportCSV(ctx context.Context, w io.Writer) error {
+	return c.reader(ctx).ExportCSV(ctx, w)
+}
+
+// GetUserForUpdate locks a user's row on the primary, where tx must have
+// been started. See Store.GetUserForUpdate.
+func (c *Cluster) GetUserForUpdate(ctx context.Context, tx *sql.Tx, id int) (*User, error) {
+	return c.primary.GetUserForUpdate(ctx, tx, id)
+}
+
+// GetUserForUpdateSkipLocked locks a user's row on the primary, where tx
+// must have been started. See Store.GetUserForUpdateSkipLocked.
+func (c *Cluster) GetUserForUpdateSkipLocked(ctx context.Context, tx *sql.Tx, id int) (*User, error) {
+	return c.primary.GetUserForUpdateSkipLocked(ctx, tx, id)
+}
+
+// WithTx runs fn in a transaction on the primary. See Store.WithTx.
+func (c *Cluster) WithTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return c.primary.WithTx(ctx, fn)
+}
+
+// WithTxOpts runs fn in a transaction on the primary. See
+// Store.WithTxOpts.
+func (c *Cluster) WithTxOpts(ctx context.Context, opts *sql.TxOptions, fn func(tx *sql.Tx) error) error {
+	return c.primary.WithTxOpts(ctx, opts, fn)
+}
+
+// WithinTx runs fn with a store whose methods run in a transaction on the
+// primary. See Store.WithinTx.
+func (c *Cluster) WithinTx(ctx context.Context, fn func(txStore *Store) error) error {
+	return c.primary.WithinTx(ctx, fn)
+}
+
+// Exec runs a custom statement on the primary. See Store.Exec.
+func (c *Cluster) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.primary.Exec(ctx, query, args...)
+}
+
+// Query runs a custom query on the primary, since it can't tell whether
+// the query writes. See Store.Query.
+func (c *Cluster) Query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return c.primary.Query(ctx, query, args...)
+}
+
+// NamedExec runs a custom statement on the primary. See Store.NamedExec.
+func (c *Cluster) NamedExec(ctx context.Context, query string, arg map[string]interface{}) (sql.Result, error) {
+	return c.primary.NamedExec(ctx, query, arg)
+}
+
+// Rebind rebinds query for the cluster's dialect. See Store.Rebind.
+func (c *Cluster) Rebind(query string) string {
+	return c.primary.Rebind(query)
+}
+
+// NewBuilder returns a Builder for queries on the cluster's table. See
+// Store.NewBuilder.
+func (c *Cluster) NewBuilder() *Builder {
+	return c.primary.NewBuilder()
+}
+
+// WithCircuitBreaker gives the primary and every replica a circuit
+// breaker of its own, so that an outage of one of them doesn't stop calls
+// to the others. It returns c. See Store.WithCircuitBreaker.
+func (c *Cluster) WithCircuitBreaker(failures int, cooldown time.Duration) *Cluster {
+	c.primary.WithCircuitBreaker(failures, cooldown)
+	for _, r := range c.replicas {
+		r.WithCircuitBreaker(failures, cooldown)
+	}
+	return c
+}
+
+// WithMetrics registers collectors with reg that count and time the calls
+// of the cluster's methods, whichever database they go to. It returns c.
+// See Store.WithMetrics.
+func (c *Cluster) WithMetrics(reg prometheus.Registerer) *Cluster {
+	c.primary.WithMetrics(reg)
+	return c
+}
+
+// WithSlog makes the cluster log every call of its methods to logger,
+// whichever database they go to. It returns c. See Store.WithSlog.
+func (c *Cluster) WithSlog(logger *slog.Logger) *Cluster {
+	c.primary.WithSlog(logger)
+	return c
+}
+
+// Prepare prepares the primary's statements. Reads from the replicas
+// don't use prepared statements. See Store.Prepare.
+func (c *Cluster) Prepare(ctx context.Context) error {
+	return c.primary.Prepare(ctx)
+}
+
+// Close closes the primary's prepared statements. See Store.Close.
+func (c *Cluster) Close() error {
+	return c.primary.Close()
+}
+
+// Shutdown gracefully shuts down the primary and every replica, and
+// returns their errors joined together. See Store.Shutdown.
+func (c *Cluster) Shutdown(ctx context.Context) error {
+	return c.each(func(s *Store) error { return s.Shutdown(ctx) })
+}
+
+// Reconnect reconnects the primary and every replica, and returns their
+// errors joined together. See Store.Reconnect.
+func (c *Cluster) Reconnect(ctx context.Context) error {
+	return c.each(func(s *Store) error { return s.Reconnect(ctx) })
+}
+
+// WarmUp opens n connections to the primary and to every replica, and
+// returns their errors joined together. See Store.WarmUp.
+func (c *Cluster) WarmUp(ctx context.Context, n int) error {
+	return c.each(func(s *Store) error { return s.WarmUp(ctx, n) })
+}
+
+// HealthCheck reports whether the primary and every replica are usable,
+// returning their errors joined together. See Store.HealthCheck.
+func (c *Cluster) HealthCheck(ctx context.Context) error {
+	return c.each(func(s *Store) error { return s.HealthCheck(ctx) })
+}
+
+// HealthHandler returns a handler for readiness probes, which responds
+// with 200 OK if c passes HealthCheck and 503 Service Unavailable if it
+// doesn't. See Store.HealthHandler.
+func (c *Cluster) HealthHandler() http.HandlerFunc {
+	return healthHandler(c.HealthCheck)
+}
+
+// Stats returns the connection pool statistics of the primary. See
+// Store.Stats.
+func (c *Cluster) Stats() sql.DBStats {
+	return c.primary.Stats()
+}
+
+// PoolUtilization returns the utilization of the primary's connection
+// pool. See Store.PoolUtilization.
+func (c *Cluster) PoolUtilization() float64 {
+	return c.primary.PoolUtilization()
+}
+
+// MonitorPool monitors the primary's connection pool. See
+// Store.MonitorPool.
+func (c *Cluster) MonitorPool(ctx context.Context, interval time.Duration, fn func(sql.DBStats)) {
+	c.primary.MonitorPool(ctx, interval, fn)
+}
@@ -0,0 +1,159 @@
+package users_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+func TestCluster(t *testing.T) {
+	// The replica is a separate database that nothing replicates to, so
+	// reads that go to it don't see the cluster's writes.
+	c := users.NewClusterWithDialect(users.SQLite, dbtest.NewTestDB(t), dbtest.NewTestDB(t))
+	ctx := context.Background()
+
+	id, err := c.CreateUser(ctx, &users.User{Username: "alice", Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.GetUserByID(ctx, int(id)); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("read from replica: err = %v, want ErrUserNotFound", err)
+	}
+	if _, err := c.GetUserByID(users.ReadPrimary(ctx), int(id)); err != nil {
+		t.Errorf("read from primary: %v", err)
+	}
+
+	inserted, err := c.UpsertUser(ctx, &users.User{Username: "alice", Password: "password456"})
+	if err != nil || inserted {
+		t.Errorf("UpsertUser = %v, %v; want false, nil", inserted, err)
+	}
+	if _, err := c.Authenticate(ctx, "alice", "password456"); err != nil {
+		t.Errorf("Authenticate: %v", err)
+	}
+	if n, err := c.CountUsers(ctx); err != nil || n != 0 {
+		t.Errorf("CountUsers on replica = %d, %v; want 0, nil", n, err)
+	}
+	if n, err := c.CountUsers(users.ReadPrimary(ctx)); err != nil || n != 1 {
+		t.Errorf("CountUsers on primary = %d, %v; want 1, nil", n, err)
+	}
+
+	if err := c.DeleteUser(ctx, int(id)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RestoreUser(ctx, int(id)); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := c.Primary().UserExists(ctx, "alice"); err != nil || !exists {
+		t.Errorf("UserExists after restore = %v, %v", exists, err)
+	}
+}
+
+func TestClusterWithoutReplicas(t *testing.T) {
+	c := users.NewClusterWithDialect(users.SQLite, dbtest.NewTestDB(t))
+	ctx := context.Background()
+
+	if _, err := c.CreateUser(ctx, &users.User{Username: "alice", Password: "password123"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetUserByUsername(ctx, "alice"); err != nil {
+		t.Errorf("GetUserByUsername: %v", err)
+	}
+}
+
+// newReplicas returns test databases to use as replicas, each of which
+// has a single user named after it, replica0, replica1 and so on.
+func newReplicas(t *testing.T, n int) []*sql.DB {
+	dbs := make([]*sql.DB, n)
+	for i := range dbs {
+		dbs[i] = dbtest.NewTestDB(t)
+		s := users.NewStore(dbs[i], users.SQLite)
+		username := "replica" + string(rune('0'+i))
+		if _, err := s.CreateUser(context.Background(), &users.User{Username: username, Password: "password123"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dbs
+}
+
+func TestClusterRoutesReadsRoundRobin(t *testing.T) {
+	c := users.NewClusterWithDialect(users.SQLite, dbtest.NewTestDB(t), newReplicas(t, 2)...)
+	ctx := context.Background()
+	if _, err := c.CreateUser(ctx, &users.User{Username: "primary", Password: "password123"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for i := 0; i < 4; i++ {
+		list, err := c.ListUsers(ctx, users.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, usernames(list))
+	}
+	list, err := c.ListUsers(users.ReadPrimary(ctx), users.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, usernames(list))
+
+	if want := "replica0 replica1 replica0 replica1 primary"; strings.Join(got, " ") != want {
+		t.Errorf("reads went to %q, want %q", strings.Join(got, " "), want)
+	}
+}
+
+func TestClusterReplicasUsePrimarySettings(t *testing.T) {
+	c := users.NewClusterWithDialect(users.SQLite, dbtest.NewTestDB(t), newReplicas(t, 1)...)
+	ctx := context.Background()
+
+	// Settings changed after the cluster was created still apply.
+	c.Primary().RedactPasswords = true
+	u, err := c.GetUserByUsername(ctx, "replica0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Password != "" {
+		t.Error("read from replica returned the password hash with RedactPasswords set")
+	}
+
+	c.Primary().TableName = "no such table"
+	if _, err := c.GetUserByID(ctx, u.Id); !errors.Is(err, users.ErrInvalidTableName) {
+		t.Errorf("read from replica with invalid TableName: err = %v, want ErrInvalidTableName", err)
+	}
+	c.Primary().TableName = ""
+
+	c.Primary().RequireTenant = true
+	if _, err := c.GetUserByID(ctx, u.Id); !errors.Is(err, users.ErrTenantRequired) {
+		t.Errorf("read from replica with RequireTenant set: err = %v, want ErrTenantRequired", err)
+	}
+	// replica0 doesn't belong to tenant 1.
+	if _, err := c.ForTenant(1).GetUserByID(ctx, u.Id); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("read from replica for another tenant: err = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestClusterHealthCheckAndShutdown(t *testing.T) {
+	replicas := newReplicas(t, 2)
+	c := users.NewClusterWithDialect(users.SQLite, dbtest.NewTestDB(t), replicas...)
+	ctx := context.Background()
+
+	if err := c.HealthCheck(ctx); err != nil {
+		t.Fatal(err)
+	}
+	replicas[1].Close()
+	if err := c.HealthCheck(ctx); err == nil || !strings.Contains(err.Error(), "replica 1") {
+		t.Errorf("HealthCheck with a closed replica = %v, want an error for replica 1", err)
+	}
+
+	if err := c.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetUserByID(ctx, 1); !errors.Is(err, users.ErrStoreClosed) {
+		t.Errorf("read after Shutdown: err = %v, want ErrStoreClosed", err)
+	}
+}
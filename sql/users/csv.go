@@ -0,0 +1,168 @@
+package users
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvHeader is the header row written by ExportCSV. Passwords are never
+// exported.
+var csvHeader = []string{"id", "username", "email"}
+
+// ExportCSV writes every user to w as CSV, with the header row
+// id,username,email. Users are read from the database one row at a time
+// and written as they're read, so the whole table never has to be held
+// in memory. If ctx is done before every user has been written, ExportCSV
+// stops reading users and returns ctx's error.
+func (s *Store) ExportCSV(ctx context.Context, w io.Writer) (err error) {
+	ctx, op, err := s.startOp(ctx, "ExportCSV")
+	if err != nil {
+		return err
+	}
+	var n int
+	defer func() { op.end(err, n) }()
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return fmt.Errorf("export csv: %w", err)
+	}
+	err = s.eachUser(ctx, "export csv", selectAllUsersQuery(s.dialect, s.table()), func(u *User) error {
+		// Stop as soon as ctx is done, such as when the client that the
+		// export is being sent to has gone away, rather than reading the
+		// rest of the table for nothing. Returning closes the rows, which
+		// frees the connection.
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var email string
+		if u.Email != nil {
+			email = *u.Email
+		}
+		if err := cw.Write([]string{strconv.Itoa(u.Id), u.Username, email}); err != nil {
+			return fmt.Errorf("export csv: %w", err)
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return err
+	}
+
+	// Flush writes any buffered data to w, and Error reports any error
+	// that happened while writing it.
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("export csv: %w", err)
+	}
+	return nil
+}
+
+// ImportCSV inserts the users read from r as CSV, and returns the number
+// of users it inserted. The first row must be a header naming the
+// columns, which must include username and may include email, password
+// and role. Users with an empty email or no email column are imported
+// without an email, and users without a role get RoleUser. Other columns, such as the id column written by ExportCSV,
+// are ignored.
+//
+// Passwords are expected to be in plaintext and are hashed, and checked
+// against s.PasswordPolicy, before they're stored. Without a password
+// column, the users are imported without passwords.
+//
+// Every row is validated before any of them are inserted, and they're all
+// inserted in a single transaction, so a bad row aborts the whole import.
+// The error then says which line of the CSV the row is on. Once the
+// transaction commits, the hooks are told about each imported user,
+// without its id.
+func (s *Store) ImportCSV(ctx context.Context, r io.Reader) (imported int, err error) {
+	ctx, op, err := s.startOp(ctx, "ImportCSV")
+	if err != nil {
+		return 0, err
+	}
+	defer func() { op.end(err, imported) }()
+
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("import csv: %w", err)
+	}
+	cols := make(map[string]int, len(header))
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	usernameCol, hasUsername := cols["username"]
+	emailCol, hasEmail := cols["email"]
+	passwordCol, hasPassword := cols["password"]
+	roleCol, hasRole := cols["role"]
+	if !hasUsername {
+		return 0, errors.New("import csv: header must include username")
+	}
+
+	now := time.Now().UTC()
+	var args []interface{}
+	var users []*User
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// Errors reading a record are *csv.ParseErrors, which include
+			// the line number.
+			return 0, fmt.Errorf("import csv: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+
+		u := &User{Username: record[usernameCol]}
+		if hasEmail && record[emailCol] != "" {
+			u.Email = &record[emailCol]
+		}
+		if hasPassword {
+			u.Password = record[passwordCol]
+		}
+		if hasRole {
+			u.Role = record[roleCol]
+		}
+		s.normalize(u)
+		if err := u.validate(hasPassword); err != nil {
+			return 0, fmt.Errorf("import csv: line %d: %w", line, err)
+		}
+
+		var hash string
+		if hasPassword {
+			if err := s.PasswordPolicy.Validate(u.Password); err != nil {
+				return 0, fmt.Errorf("import csv: line %d: %w", line, err)
+			}
+			if hash, err = s.hashPassword(u.Password); err != nil {
+				return 0, fmt.Errorf("import csv: line %d: %w", line, err)
+			}
+		}
+		args = append(args, u.Username, u.Email, nullPassword(hash), u.Role, now, now, jsonMap(u.Metadata))
+
+		u.Password = hash
+		u.CreatedAt = now
+		u.UpdatedAt = now
+		u.Version = 1
+		users = append(users, u)
+	}
+	if len(args) == 0 {
+		return 0, nil
+	}
+
+	imported, err = s.bulkInsertUsers(ctx, "import csv", args)
+	if err != nil {
+		return 0, err
+	}
+	return imported, s.runHooksForEach(ctx, hookCreate, users)
+}
@@ -0,0 +1,108 @@
+package users_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+func TestImportCSV(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+
+	const input = "Username, Email, Password, Role\n" +
+		"alice,Alice@Example.com,password123,admin\n" +
+		"bob,,password456,\n"
+	n, err := s.ImportCSV(ctx, strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("imported %d users, want 2", n)
+	}
+
+	alice, err := s.GetUserByEmail(ctx, "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.Username != "alice" || alice.Role != users.RoleAdmin || !users.CheckPassword(alice.Password, "password123") {
+		t.Errorf("alice imported as %+v", alice)
+	}
+	bob, err := s.GetUserByUsername(ctx, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bob.Email != nil || bob.Role != users.RoleUser {
+		t.Errorf("bob imported with email %v and role %q", bob.Email, bob.Role)
+	}
+}
+
+func TestImportCSVWithoutPasswords(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+
+	if _, err := s.ImportCSV(ctx, strings.NewReader("username\ncarol\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Authenticate(ctx, "carol", ""); !errors.Is(err, users.ErrNoPasswordSet) {
+		t.Errorf("Authenticate: err = %v, want ErrNoPasswordSet", err)
+	}
+}
+
+func TestImportCSVErrors(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	s.PasswordPolicy = users.PasswordPolicy{MinLength: 8}
+	ctx := context.Background()
+
+	tests := []struct {
+		input, want string
+	}{
+		{"email\na@example.com\n", "header must include username"},
+		{"username,role\nalice,user\nbob,root\n", "line 3"},
+		{"username,password\nalice,password123\nbob,short\n", "line 3"},
+	}
+	for _, tt := range tests {
+		_, err := s.ImportCSV(ctx, strings.NewReader(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ImportCSV(%q) = %v, want an error containing %q", tt.input, err, tt.want)
+		}
+	}
+	_, err := s.ImportCSV(ctx, strings.NewReader("username\nalice\nalice\n"))
+	if !errors.Is(err, users.ErrDuplicateUsername) {
+		t.Errorf("repeated username: err = %v, want ErrDuplicateUsername", err)
+	}
+
+	// Each bad import is rolled back as a whole.
+	if n, err := s.CountUsers(ctx); err != nil || n != 0 {
+		t.Errorf("CountUsers = %d, %v; want 0, nil", n, err)
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+	if _, err := s.CreateUser(ctx, &users.User{Username: "alice", Email: strptr("alice@example.com"), Password: "password123"}); err != nil {
+		t.Fatal(err)
+	}
+	createUsers(t, s, "bob")
+
+	var buf bytes.Buffer
+	if err := s.ExportCSV(ctx, &buf); err != nil {
+		t.Fatal(err)
+	}
+	const want = "id,username,email\n1,alice,alice@example.com\n2,bob,\n"
+	if buf.String() != want {
+		t.Errorf("ExportCSV wrote %q, want %q", buf.String(), want)
+	}
+
+	// The export can be imported into another store.
+	other := dbtest.NewTestStore(t)
+	if n, err := other.ImportCSV(ctx, &buf); err != nil || n != 2 {
+		t.Errorf("ImportCSV of the export = %d, %v; want 2, nil", n, err)
+	}
+}
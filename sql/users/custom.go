@@ -0,0 +1,60 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// customOp is the name that calls of Exec and Query are instrumented
+// under, in metrics, logs and spans.
+const customOp = "custom"
+
+// Exec runs query with args, for one-off statements that none of the
+// store's other methods cover. It's instrumented like the other methods,
+// under the name "custom", and runs in the store's transaction if it has
+// one. query must use the placeholders of the store's dialect.
+//
+// Unlike the store's own statements, query isn't retried, isn't scoped to
+// the store's tenant and isn't skipped in dry run mode, and cached users
+// it changes aren't invalidated.
+func (s *Store) Exec(ctx context.Context, query string, args ...interface{}) (res sql.Result, err error) {
+	ctx, op, err := s.startOp(ctx, customOp)
+	if err != nil {
+		return nil, err
+	}
+	var affected int64
+	defer func() { op.end(err, int(affected)) }()
+
+	res, err = s.execContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("exec: %w", err)
+	}
+	// Not every driver reports the rows affected, which only matters to
+	// the instrumentation.
+	affected, _ = res.RowsAffected()
+	return res, nil
+}
+
+// Query runs query with args and returns the rows it selects, for one-off
+// queries that none of the store's other methods cover. It's instrumented
+// like Exec, and the rows can be read into maps with ScanMaps. The caller
+// must close the rows.
+//
+// The rows outlive the call, so the query is run with ctx itself rather
+// than with the call's timeouts, which end once Query returns. The call is
+// only tracked until the query has run, not while its rows are read, so
+// ctx should have a deadline if the rows might take long to read.
+func (s *Store) Query(ctx context.Context, query string, args ...interface{}) (rows *sql.Rows, err error) {
+	_, op, err := s.startOp(ctx, customOp)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { op.end(err, 0) }()
+
+	rows, err = s.queryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	return rows, nil
+}
@@ -0,0 +1,66 @@
+package users_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestExec(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	s := dbtest.NewTestStore(t).WithMetrics(reg)
+	ctx := context.Background()
+	createUsers(t, s, "alice", "bob")
+
+	res, err := s.Exec(ctx, "update users set role = ? where username = ?", users.RoleAdmin, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		t.Errorf("RowsAffected = %d, %v, want 1, nil", n, err)
+	}
+	if _, err := s.Exec(ctx, "update nowhere set x = 1"); err == nil {
+		t.Error("Exec of an invalid statement didn't fail")
+	}
+
+	if got := counterValue(t, reg, "store_queries_total", "custom"); got != 2 {
+		t.Errorf("custom queries = %v, want 2", got)
+	}
+	if got := counterValue(t, reg, "store_query_errors_total", "custom"); got != 1 {
+		t.Errorf("custom query errors = %v, want 1", got)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	s := dbtest.NewTestStore(t).WithMetrics(reg)
+	ctx := context.Background()
+	createUsers(t, s, "alice", "bob")
+
+	rows, err := s.Query(ctx, "select username from users order by username")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	if len(names) != 2 || names[0] != "alice" || names[1] != "bob" {
+		t.Errorf("Query read %q, want alice and bob", names)
+	}
+
+	if got := counterValue(t, reg, "store_queries_total", "custom"); got != 1 {
+		t.Errorf("custom queries = %v, want 1", got)
+	}
+}
@@ -0,0 +1,461 @@
+package users
+
+import (
+	"strconv"
+	"strings"
+)
+
+// A Dialect identifies the flavour of SQL spoken by a database, which
+// decides things like how query placeholders are written.
+type Dialect int
+
+const (
+	// MySQL uses ? placeholders.
+	MySQL Dialect = iota
+	// Postgres uses numbered $1, $2, ... placeholders.
+	Postgres
+	// SQLite uses ? placeholders.
+	SQLite
+)
+
+// String returns the name of d.
+func (d Dialect) String() string {
+	switch d {
+	case MySQL:
+		return "mysql"
+	case Postgres:
+		return "postgres"
+	case SQLite:
+		return "sqlite"
+	}
+	return "Dialect(" + strconv.Itoa(int(d)) + ")"
+}
+
+// DriverName returns the name that d's driver registers itself with,
+// for use with sql.Open.
+func (d Dialect) DriverName() string {
+	if d == SQLite {
+		return "sqlite3"
+	}
+	return d.String()
+}
+
+// Placeholder returns the placeholder for the n'th (1-indexed) argument
+// of a query written in dialect d.
+func Placeholder(d Dialect, n int) string {
+	if d == Postgres {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// placeholders returns n comma separated placeholders for dialect d,
+// numbered from start.
+func placeholders(d Dialect, start, n int) string {
+	ps := make([]string, n)
+	for i := range ps {
+		ps[i] = Placeholder(d, start+i)
+	}
+	return strings.Join(ps, ", ")
+}
+
+// inClause returns a condition that column is one of n arguments, whose
+// placeholders for dialect d are numbered from start, such as
+// "id in ($1, $2)". None of the databases accept an empty list, so if n
+// is 0, it returns a condition that's always false instead. Callers with
+// more than a few thousand arguments should split them into batches, to
+// stay under the databases' limits on the number of placeholders.
+func inClause(d Dialect, column string, start, n int) string {
+	if n == 0 {
+		return "1=0"
+	}
+	return column + " in (" + placeholders(d, start, n) + ")"
+}
+
+// insertUserColumns lists the columns set when inserting a user, and
+// numInsertUserColumns is how many of them there are.
+const (
+	insertUserColumns    = "username, email, password, role, created_at, updated_at, metadata"
+	numInsertUserColumns = 7
+)
+
+// The functions below render the queries used by the user helpers with
+// placeholders for a given dialect, against the users table t, which
+// scopes them to its tenant if it has one. Queries that read users skip
+// users that have been soft deleted, which have a non-null deleted_at.
+
+func insertUserQuery(d Dialect, t userTable) string {
+	query := "insert into " + t.name + " (" + t.insertColumns() + ") values " + t.insertValues(d, 1)
+	if d == Postgres {
+		query += " returning id"
+	}
+	return query
+}
+
+func selectUserByIDQuery(d Dialect, t userTable) string {
+	return "select " + userColumns + " from " + t.name + t.where() + "id = " + Placeholder(d, 1) + " and deleted_at is null"
+}
+
+func selectUserByUsernameQuery(d Dialect, t userTable) string {
+	return "select " + userColumns + " from " + t.name + t.where() + t.usernameCond("=", Placeholder(d, 1)) + " and deleted_at is null"
+}
+
+func selectUserByEmailQuery(d Dialect, t userTable) string {
+	return "select " + userColumns + " from " + t.name + t.where() + "email = " + Placeholder(d, 1) + " and deleted_at is null"
+}
+
+// selectUserForUpdateQuery selects a user like selectUserByIDQuery while
+// locking its row until the end of the transaction, skipping the row if
+// another transaction has already locked it when skipLocked is set.
+// SQLite has no row locks, since a transaction that writes locks the
+// whole database, so its query is the same as selectUserByIDQuery.
+func selectUserForUpdateQuery(d Dialect, t userTable, skipLocked bool) string {
+	query := selectUserByIDQuery(d, t)
+	if d == SQLite {
+		return query
+	}
+	query += " for update"
+	if skipLocked {
+		query += " skip locked"
+	}
+	return query
+}
+
+func selectUsersByIDsQuery(d Dialect, t userTable, n int) string {
+	return "select " + userColumns + " from " + t.name + t.where() + inClause(d, "id", 1, n) + " and deleted_at is null"
+}
+
+func selectUsersByUsernamesQuery(d Dialect, t userTable, n int) string {
+	return "select " + userColumns + " from " + t.name + t.where() + t.usernameIn(d, 1, n) + " and deleted_at is null"
+}
+
+// updateUserQuery updates a user's fields, leaving out the password, and
+// its placeholder, unless setPassword is set.
+func updateUserQuery(d Dialect, t userTable, setPassword bool) string {
+	set := "username = " + Placeholder(d, 1) + ", email = " + Placeholder(d, 2)
+	n := 3
+	if setPassword {
+		set += ", password = " + Placeholder(d, n)
+		n++
+	}
+	return "update " + t.name + " set " + set +
+		", role = " + Placeholder(d, n) +
+		", metadata = " + Placeholder(d, n+1) +
+		", updated_at = " + Placeholder(d, n+2) +
+		", version = version + 1" +
+		t.where() + "id = " + Placeholder(d, n+3) + " and version = " + Placeholder(d, n+4) + " and deleted_at is null"
+}
+
+func updateRoleQuery(d Dialect, t userTable) string {
+	return "update " + t.name + " set role = " + Placeholder(d, 1) +
+		", updated_at = " + Placeholder(d, 2) +
+		", version = version + 1" +
+		t.where() + "id = " + Placeholder(d, 3) + " and deleted_at is null"
+}
+
+func updatePasswordQuery(d Dialect, t userTable) string {
+	return "update " + t.name + " set password = " + Placeholder(d, 1) +
+		", needs_rehash = false" +
+		", updated_at = " + Placeholder(d, 2) +
+		", version = version + 1" +
+		t.where() + "id = " + Placeholder(d, 3) + " and deleted_at is null"
+}
+
+func updateLastLoginQuery(d Dialect, t userTable) string {
+	return "update " + t.name + " set last_login_at = " + Placeholder(d, 1) + t.where() + "id = " + Placeholder(d, 2)
+}
+
+// failedLoginQuery counts a failed login, locking the account once the
+// count reaches the given threshold and starting the count again. The
+// locked_until assignment comes first since MySQL, unlike the other
+// databases, lets later assignments see the values set by earlier ones.
+func failedLoginQuery(d Dialect, t userTable) string {
+	return "update " + t.name + " set locked_until = case when failed_login_count + 1 >= " + Placeholder(d, 1) +
+		" then " + Placeholder(d, 2) + " else locked_until end" +
+		", failed_login_count = case when failed_login_count + 1 >= " + Placeholder(d, 3) +
+		" then 0 else failed_login_count + 1 end" +
+		t.where() + "id = " + Placeholder(d, 4)
+}
+
+// flagWeakPasswordsQuery flags the users whose bcrypt hashes have a cost
+// below a given cost, which is written as two digits after the hash's
+// $2a$ prefix, so comparing it as a two digit string works.
+func flagWeakPasswordsQuery(d Dialect, t userTable) string {
+	return "update " + t.name + " set needs_rehash = true" +
+		t.where() + "password like '$2%' and substr(password, 5, 2) < " + Placeholder(d, 1) +
+		" and needs_rehash = false and deleted_at is null"
+}
+
+// rehashPasswordQuery replaces a user's password hash without changing
+// the user's updated_at time or version, as long as the hash hasn't been
+// changed since it was read.
+func rehashPasswordQuery(d Dialect, t userTable) string {
+	return "update " + t.name + " set password = " + Placeholder(d, 1) + ", needs_rehash = false" +
+		t.where() + "id = " + Placeholder(d, 2) + " and password = " + Placeholder(d, 3)
+}
+
+func resetFailedLoginsQuery(d Dialect, t userTable) string {
+	return "update " + t.name + " set failed_login_count = 0, locked_until = null" + t.where() + "id = " + Placeholder(d, 1)
+}
+
+// updateRolesQuery gives each of n users their own role in one
+// statement. Its arguments are each user's id followed by their role,
+// then the updated_at time, and then each id again.
+func updateRolesQuery(d Dialect, t userTable, n int) string {
+	var b strings.Builder
+	b.WriteString("update " + t.name + " set role = case id")
+	for i := 0; i < n; i++ {
+		b.WriteString(" when " + Placeholder(d, 1+2*i) + " then " + Placeholder(d, 2+2*i))
+	}
+	b.WriteString(" end, updated_at = " + Placeholder(d, 1+2*n) + ", version = version + 1")
+	b.WriteString(t.where() + inClause(d, "id", 2+2*n, n) + " and deleted_at is null")
+	return b.String()
+}
+
+func deleteUserQuery(d Dialect, t userTable) string {
+	return "update " + t.name + " set deleted_at = " + Placeholder(d, 1) +
+		t.where() + "id = " + Placeholder(d, 2) + " and deleted_at is null"
+}
+
+func deleteUsersByIDsQuery(d Dialect, t userTable, n int) string {
+	return "update " + t.name + " set deleted_at = " + Placeholder(d, 1) +
+		t.where() + inClause(d, "id", 2, n) + " and deleted_at is null"
+}
+
+func countUsersByIDsQuery(d Dialect, t userTable, n int) string {
+	return "select count(*) from " + t.name + t.where() + inClause(d, "id", 1, n) + " and deleted_at is null"
+}
+
+// deleteInactiveUsersQuery soft deletes up to a given number of the users
+// who last signed in before a given time. MySQL can limit an update
+// directly, but doesn't allow the subquery that the others need instead,
+// since it selects from the table being updated.
+func deleteInactiveUsersQuery(d Dialect, t userTable) string {
+	cond := "last_login_at < " + Placeholder(d, 2) + " and deleted_at is null"
+	if d == MySQL {
+		return "update " + t.name + " set deleted_at = " + Placeholder(d, 1) +
+			t.where() + cond + " order by id limit " + Placeholder(d, 3)
+	}
+	return "update " + t.name + " set deleted_at = " + Placeholder(d, 1) +
+		t.where() + "id in (select id from " + t.name + t.where() + cond +
+		" order by id limit " + Placeholder(d, 3) + ")"
+}
+
+func countInactiveUsersQuery(d Dialect, t userTable) string {
+	return "select count(*) from " + t.name + t.where() + "last_login_at < " + Placeholder(d, 1) + " and deleted_at is null"
+}
+
+// lockUserIDsQuery selects the ids of the users that aren't deleted among
+// n given ids, and locks their rows until the transaction ends, so that
+// the methods that change several users can tell the hooks exactly which
+// ones they changed. SQLite has no row locks, but its transactions hold
+// the whole database once they write.
+func lockUserIDsQuery(d Dialect, t userTable, n int) string {
+	return forUpdate(d, "select id from "+t.name+t.where()+inClause(d, "id", 1, n)+" and deleted_at is null order by id")
+}
+
+// lockInactiveUserIDsQuery selects and locks the ids of up to a given
+// number of the users who last signed in before a given time, like
+// lockUserIDsQuery.
+func lockInactiveUserIDsQuery(d Dialect, t userTable) string {
+	return forUpdate(d, "select id from "+t.name+t.where()+"last_login_at < "+Placeholder(d, 1)+
+		" and deleted_at is null order by id limit "+Placeholder(d, 2))
+}
+
+// forUpdate has query lock the rows it selects, on the databases that
+// support it.
+func forUpdate(d Dialect, query string) string {
+	if d == SQLite {
+		return query
+	}
+	return query + " for update"
+}
+
+func hardDeleteUserQuery(d Dialect, t userTable) string {
+	return "delete from " + t.name + t.where() + "id = " + Placeholder(d, 1)
+}
+
+// countUserByIDQuery counts the users with a given id, which is used to
+// find out what deleting the user would affect in dry run mode. Soft
+// deleted users are only counted if includeDeleted is set.
+func countUserByIDQuery(d Dialect, t userTable, includeDeleted bool) string {
+	query := "select count(*) from " + t.name + t.where() + "id = " + Placeholder(d, 1)
+	if !includeDeleted {
+		query += " and deleted_at is null"
+	}
+	return query
+}
+
+func restoreUserQuery(d Dialect, t userTable) string {
+	return "update " + t.name + " set deleted_at = null" + t.where() + "id = " + Placeholder(d, 1) +
+		" and deleted_at is not null"
+}
+
+func listUsersQuery(d Dialect, t userTable, cols, orderBy string) string {
+	return "select " + cols + " from " + t.name + t.where() + "deleted_at is null order by " + orderBy +
+		" limit " + Placeholder(d, 1) + " offset " + Placeholder(d, 2)
+}
+
+func listUsersAfterQuery(d Dialect, t userTable) string {
+	return "select " + userColumns + " from " + t.name + t.where() + "id > " + Placeholder(d, 1) +
+		" and deleted_at is null order by id asc limit " + Placeholder(d, 2)
+}
+
+// listFilteredUsersQuery is listUsersQuery with the where clause where,
+// which uses the first numArgs placeholders.
+func listFilteredUsersQuery(d Dialect, t userTable, cols, where string, numArgs int, orderBy string) string {
+	return "select " + cols + " from " + t.name + t.where() + where + " order by " + orderBy +
+		" limit " + Placeholder(d, numArgs+1) + " offset " + Placeholder(d, numArgs+2)
+}
+
+// upsertUserQuery inserts a user unless one with the same username exists,
+// in which case Postgres updates that user, while SQLite does nothing. It
+// isn't used on MySQL, whose on duplicate key update fires on a conflict
+// with any unique key, including email, rather than only username.
+func upsertUserQuery(d Dialect, t userTable) string {
+	if d == Postgres {
+		// xmax is only zero for rows that were freshly inserted by the
+		// current transaction, which tells an insert apart from an update.
+		return "insert into " + t.name + " (" + t.insertColumns() + ") values " + t.insertValues(d, 1) +
+			" on conflict (username) do update set email = excluded.email," +
+			" password = excluded.password, role = excluded.role, metadata = excluded.metadata, updated_at = excluded.updated_at," +
+			" version = " + t.name + ".version + 1" +
+			" returning id, (xmax = 0) as inserted"
+	}
+	return "insert into " + t.name + " (" + t.insertColumns() + ") values " + t.insertValues(d, 1) +
+		" on conflict (username) do nothing"
+}
+
+// updateUserByUsernameQuery updates the user with a given username for
+// UpsertUser, whether or not the user has been soft deleted, since the
+// username is still taken.
+func updateUserByUsernameQuery(d Dialect, t userTable) string {
+	return "update " + t.name + " set email = " + Placeholder(d, 1) +
+		", password = " + Placeholder(d, 2) +
+		", role = " + Placeholder(d, 3) +
+		", metadata = " + Placeholder(d, 4) +
+		", updated_at = " + Placeholder(d, 5) +
+		", version = version + 1" +
+		t.where() + t.usernameCond("=", Placeholder(d, 6))
+}
+
+func selectUserIDByUsernameQuery(d Dialect, t userTable) string {
+	return "select id from " + t.name + t.where() + t.usernameCond("=", Placeholder(d, 1))
+}
+
+// selectUserVersionQuery selects the version of the user with a given id,
+// which UpsertUser reads back after writing the user.
+func selectUserVersionQuery(d Dialect, t userTable) string {
+	return "select version from " + t.name + t.where() + "id = " + Placeholder(d, 1)
+}
+
+func userExistsQuery(d Dialect, t userTable) string {
+	return "select exists(select 1 from " + t.name + t.where() + t.usernameCond("=", Placeholder(d, 1)) + ")"
+}
+
+func selectAllUsersQuery(d Dialect, t userTable) string {
+	return "select " + userColumns + " from " + t.name + t.where() + "deleted_at is null"
+}
+
+func bulkInsertUsersQuery(d Dialect, t userTable, n int) string {
+	var b strings.Builder
+	b.WriteString("insert into " + t.name + " (" + t.insertColumns() + ") values ")
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(t.insertValues(d, i*numInsertUserColumns+1))
+	}
+	return b.String()
+}
+
+// likeEscape is the escape character used in like patterns built by
+// escapeLike. A backslash isn't used since MySQL treats backslashes in
+// string literals as escapes too.
+const likeEscape = "!"
+
+// escapeLike escapes the like wildcards % and _ in s, so that s matches
+// itself literally when used in a like pattern with escape '!'.
+func escapeLike(s string) string {
+	return strings.NewReplacer(
+		likeEscape, likeEscape+likeEscape,
+		"%", likeEscape+"%",
+		"_", likeEscape+"_",
+	).Replace(s)
+}
+
+func searchUsersByPrefixQuery(d Dialect, t userTable) string {
+	return "select " + userColumns + " from " + t.name + t.where() + t.usernameCond("like", Placeholder(d, 1)) +
+		" escape '" + likeEscape + "' and deleted_at is null order by username limit " + Placeholder(d, 2)
+}
+
+// postgresSearchVector is the text search vector that Search matches
+// users against on Postgres. It must be written exactly like this in the
+// expression index that the search uses, created by the migrations.
+const postgresSearchVector = "to_tsvector('simple', username || ' ' || coalesce(email, ''))"
+
+// searchCondition returns the condition that Search matches users against
+// term with, whose placeholders are numbered from 1, and its arguments.
+// MySQL and Postgres use their full-text search, while SQLite, which has
+// none without an extension, matches term anywhere in the username or
+// email instead.
+func searchCondition(d Dialect, term string) (string, []interface{}) {
+	switch d {
+	case MySQL:
+		return "match (username, email) against (" + Placeholder(d, 1) + " in natural language mode)", []interface{}{term}
+	case Postgres:
+		return postgresSearchVector + " @@ plainto_tsquery('simple', " + Placeholder(d, 1) + ")", []interface{}{term}
+	}
+	pattern := "%" + escapeLike(term) + "%"
+	return "(username like " + Placeholder(d, 1) + " escape '" + likeEscape + "'" +
+		" or email like " + Placeholder(d, 2) + " escape '" + likeEscape + "')", []interface{}{pattern, pattern}
+}
+
+func insertUserIfNotExistsQuery(d Dialect, t userTable) string {
+	if d == MySQL {
+		return "insert ignore into " + t.name + " (" + t.insertColumns() + ") values " + t.insertValues(d, 1)
+	}
+	return "insert into " + t.name + " (" + t.insertColumns() + ") values " + t.insertValues(d, 1) +
+		" on conflict do nothing"
+}
+
+// idempotencyKeyCond is the condition that selects an idempotency key by
+// its table, tenant and key, in that order.
+func idempotencyKeyCond(d Dialect) string {
+	return " where table_name = " + Placeholder(d, 1) +
+		" and tenant_id = " + Placeholder(d, 2) +
+		" and idempotency_key = " + Placeholder(d, 3)
+}
+
+func selectIdempotencyKeyQuery(d Dialect) string {
+	return "select user_id, created_at from idempotency_keys" + idempotencyKeyCond(d)
+}
+
+func deleteIdempotencyKeyQuery(d Dialect) string {
+	return "delete from idempotency_keys" + idempotencyKeyCond(d)
+}
+
+func insertIdempotencyKeyQuery(d Dialect) string {
+	return "insert into idempotency_keys (table_name, tenant_id, idempotency_key, user_id, created_at) values (" +
+		placeholders(d, 1, 5) + ")"
+}
+
+func insertResetTokenQuery(d Dialect) string {
+	return "insert into reset_tokens (token_hash, user_id, expires_at) values (" + placeholders(d, 1, 3) + ")"
+}
+
+func selectResetTokenQuery(d Dialect) string {
+	return "select user_id, expires_at from reset_tokens where token_hash = " + Placeholder(d, 1)
+}
+
+func deleteResetTokenQuery(d Dialect) string {
+	return "delete from reset_tokens where token_hash = " + Placeholder(d, 1)
+}
+
+func deleteUserResetTokensQuery(d Dialect) string {
+	return "delete from reset_tokens where user_id = " + Placeholder(d, 1)
+}
+
+func deleteExpiredResetTokensQuery(d Dialect) string {
+	return "delete from reset_tokens where expires_at <= " + Placeholder(d, 1)
+}
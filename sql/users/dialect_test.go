@@ -0,0 +1,116 @@
+package users
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPlaceholder(t *testing.T) {
+	tests := []struct {
+		d    Dialect
+		n    int
+		want string
+	}{
+		{MySQL, 1, "?"},
+		{MySQL, 12, "?"},
+		{Postgres, 1, "$1"},
+		{Postgres, 12, "$12"},
+		{SQLite, 1, "?"},
+		{SQLite, 12, "?"},
+	}
+	for _, tt := range tests {
+		if got := Placeholder(tt.d, tt.n); got != tt.want {
+			t.Errorf("Placeholder(%v, %d) = %q, want %q", tt.d, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestDriverName(t *testing.T) {
+	for d, want := range map[Dialect]string{MySQL: "mysql", Postgres: "postgres", SQLite: "sqlite3"} {
+		if got := d.DriverName(); got != want {
+			t.Errorf("%v.DriverName() = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestUserQueries(t *testing.T) {
+	table := userTable{name: "users"}
+	tests := []struct {
+		name string
+		fn   func(d Dialect) string
+		want [3]string // for MySQL, Postgres and SQLite
+	}{
+		{
+			"insert",
+			func(d Dialect) string { return insertUserQuery(d, table) },
+			[3]string{
+				"insert into users (" + insertUserColumns + ") values (?, ?, ?, ?, ?, ?, ?)",
+				"insert into users (" + insertUserColumns + ") values ($1, $2, $3, $4, $5, $6, $7) returning id",
+				"insert into users (" + insertUserColumns + ") values (?, ?, ?, ?, ?, ?, ?)",
+			},
+		},
+		{
+			"select by username",
+			func(d Dialect) string { return selectUserByUsernameQuery(d, table) },
+			[3]string{
+				"select " + userColumns + " from users where username = ? and deleted_at is null",
+				"select " + userColumns + " from users where username = $1 and deleted_at is null",
+				"select " + userColumns + " from users where username = ? and deleted_at is null",
+			},
+		},
+		{
+			"select for update",
+			func(d Dialect) string { return selectUserForUpdateQuery(d, table, false) },
+			[3]string{
+				"select " + userColumns + " from users where id = ? and deleted_at is null for update",
+				"select " + userColumns + " from users where id = $1 and deleted_at is null for update",
+				"select " + userColumns + " from users where id = ? and deleted_at is null",
+			},
+		},
+		{
+			"update role",
+			func(d Dialect) string { return updateRoleQuery(d, table) },
+			[3]string{
+				"update users set role = ?, updated_at = ?, version = version + 1 where id = ? and deleted_at is null",
+				"update users set role = $1, updated_at = $2, version = version + 1 where id = $3 and deleted_at is null",
+				"update users set role = ?, updated_at = ?, version = version + 1 where id = ? and deleted_at is null",
+			},
+		},
+	}
+	for _, tt := range tests {
+		for i, d := range []Dialect{MySQL, Postgres, SQLite} {
+			if got := tt.fn(d); got != tt.want[i] {
+				t.Errorf("%s query for %v = %q, want %q", tt.name, d, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestInClause(t *testing.T) {
+	tests := []struct {
+		d        Dialect
+		start, n int
+		want     string
+	}{
+		{MySQL, 1, 0, "1=0"},
+		{Postgres, 1, 0, "1=0"},
+		{SQLite, 1, 0, "1=0"},
+		{MySQL, 1, 1, "id in (?)"},
+		{Postgres, 1, 1, "id in ($1)"},
+		{SQLite, 1, 1, "id in (?)"},
+		{MySQL, 2, 3, "id in (?, ?, ?)"},
+		{Postgres, 2, 3, "id in ($2, $3, $4)"},
+		{SQLite, 2, 3, "id in (?, ?, ?)"},
+	}
+	for _, tt := range tests {
+		if got := inClause(tt.d, "id", tt.start, tt.n); got != tt.want {
+			t.Errorf("inClause(%v, id, %d, %d) = %q, want %q", tt.d, tt.start, tt.n, got, tt.want)
+		}
+	}
+
+	// More arguments than a batch holds still get one placeholder each.
+	got := inClause(Postgres, "id", 1, 2500)
+	if n := strings.Count(got, "$"); n != 2500 || !strings.HasSuffix(got, ", $2500)") {
+		t.Errorf("inClause(Postgres, id, 1, 2500) has %d placeholders and ends %q", n, got[len(got)-10:])
+	}
+}
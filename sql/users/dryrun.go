@@ -0,0 +1,57 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+)
+
+// A DryRunLogger is a Logger that's also told about the statements a
+// Store skips running because its DryRun field is set. Stores whose
+// Logger isn't a DryRunLogger log skipped statements with the log
+// package instead.
+type DryRunLogger interface {
+	Logger
+
+	// LogDryRun is called instead of running query with args for the
+	// method called op. affected is the number of rows query would have
+	// affected.
+	LogDryRun(ctx context.Context, op, query string, args []interface{}, affected int64)
+}
+
+// dryRunResult is the sql.Result of a statement that wasn't run because
+// of dry run mode.
+type dryRunResult int64
+
+var _ sql.Result = dryRunResult(0)
+
+func (r dryRunResult) LastInsertId() (int64, error) {
+	return 0, errors.New("last insert id is not available in dry run mode")
+}
+
+func (r dryRunResult) RowsAffected() (int64, error) {
+	return int64(r), nil
+}
+
+// execDestructive runs query with args for the method called op, which
+// deletes or otherwise destroys rows. If s.DryRun is set, query is logged
+// instead of being run, and countQuery is run with countArgs to count the
+// rows that query would have affected, which the returned result reports.
+func (s *Store) execDestructive(ctx context.Context, op, query string, args []interface{}, countQuery string, countArgs ...interface{}) (sql.Result, error) {
+	if !s.DryRun {
+		return s.execRetry(ctx, query, args...)
+	}
+
+	var n int64
+	if err := s.queryRowContext(ctx, countQuery, countArgs...).Scan(&n); err != nil {
+		return nil, err
+	}
+	if l, ok := s.Logger.(DryRunLogger); ok {
+		l.LogDryRun(ctx, op, query, args, n)
+	} else {
+		log.Printf("dry run: op=%s request_id=%q query=%q args=%v affected=%d",
+			op, requestIDFromContext(ctx), query, args, n)
+	}
+	return dryRunResult(n), nil
+}
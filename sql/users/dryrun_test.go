@@ -0,0 +1,68 @@
+package users_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+// dryRunLogger records the statements skipped by a store in dry run mode.
+type dryRunLogger struct {
+	skipped []string
+}
+
+func (l *dryRunLogger) Log(ctx context.Context, op string, dur time.Duration, err error) {}
+
+func (l *dryRunLogger) LogDryRun(ctx context.Context, op, query string, args []interface{}, affected int64) {
+	l.skipped = append(l.skipped, fmt.Sprintf("%s %d", op, affected))
+}
+
+func TestDryRun(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+	ids := createUsers(t, s, "alice", "bob", "carol")
+	for _, username := range []string{"alice", "bob"} {
+		if _, err := s.Authenticate(ctx, username, "password123"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l := &dryRunLogger{}
+	s.DryRun = true
+	s.Logger = l
+
+	if err := s.DeleteUser(ctx, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.HardDeleteUser(ctx, ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.DeleteUsersByIDs(ctx, ids); err != nil || n != 3 {
+		t.Errorf("DeleteUsersByIDs = %d, %v, want 3, nil", n, err)
+	}
+	if n, err := s.DeleteInactiveUsers(ctx, time.Now().Add(time.Hour), 100); err != nil || n != 2 {
+		t.Errorf("DeleteInactiveUsers = %d, %v, want 2, nil", n, err)
+	}
+	if err := s.DeleteUser(ctx, 999); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("DeleteUser of a missing user: err = %v, want ErrUserNotFound", err)
+	}
+
+	want := []string{"DeleteUser 1", "HardDeleteUser 1", "DeleteUsersByIDs 3", "DeleteInactiveUsers 2", "DeleteUser 0"}
+	if fmt.Sprint(l.skipped) != fmt.Sprint(want) {
+		t.Errorf("skipped statements = %q, want %q", l.skipped, want)
+	}
+
+	s.DryRun = false
+	list, err := s.ListUsers(ctx, users.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := usernames(list); got != "alice bob carol" {
+		t.Errorf("users after dry run = %q, want all of them", got)
+	}
+}
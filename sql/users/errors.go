@@ -0,0 +1,165 @@
+package users
+
+import (
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+var (
+	// ErrDuplicateUsername is returned when a write would give a user a
+	// username that another user already has.
+	ErrDuplicateUsername = errors.New("username already exists")
+
+	// ErrDuplicateEmail is returned when a write would give a user an
+	// email that another user already has.
+	ErrDuplicateEmail = errors.New("email already exists")
+)
+
+// A uniqueViolationError is returned in place of a driver's unique
+// constraint violation error. errors.Is reports it as its kind, such as
+// ErrDuplicateUsername, while errors.Unwrap returns the driver's error.
+type uniqueViolationError struct {
+	op   string // the operation that failed, such as "create user"
+	kind error
+	err  error
+}
+
+func (e *uniqueViolationError) Error() string {
+	return e.op + ": " + e.kind.Error() + ": " + e.err.Error()
+}
+
+func (e *uniqueViolationError) Unwrap() error { return e.err }
+
+func (e *uniqueViolationError) Is(target error) bool { return target == e.kind }
+
+// uniqueViolationDetail reports whether err is a unique constraint
+// violation reported by one of the supported drivers, and if it is,
+// returns the driver's description of the violated constraint.
+func uniqueViolationDetail(err error) (detail string, ok bool) {
+	// MySQL reports duplicate keys with error 1062 (ER_DUP_ENTRY), with a
+	// message that names the key, such as "... for key 'users.email'".
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return myErr.Message, myErr.Number == 1062
+	}
+
+	// Postgres reports them with SQLSTATE 23505 (unique_violation), and
+	// names the constraint, such as users_email_key.
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Constraint, pqErr.Code == "23505"
+	}
+
+	// SQLite's message names the columns, such as "UNIQUE constraint
+	// failed: users.email".
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Error(), sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+
+	return "", false
+}
+
+// uniqueViolation returns err as a uniqueViolationError if it's a unique
+// constraint violation, or nil if it isn't. Violations of a constraint
+// on the email column are reported as ErrDuplicateEmail, and any others
+// as ErrDuplicateUsername.
+func uniqueViolation(op string, err error) error {
+	detail, ok := uniqueViolationDetail(err)
+	if !ok {
+		return nil
+	}
+
+	kind := ErrDuplicateUsername
+	if strings.Contains(detail, "email") {
+		kind = ErrDuplicateEmail
+	}
+	return &uniqueViolationError{op: op, kind: kind, err: err}
+}
+
+var (
+	// ErrCannotConnect is returned by Open when the database can't be
+	// reached at all, such as when its host can't be resolved or refuses
+	// connections.
+	ErrCannotConnect = errors.New("cannot connect to database")
+
+	// ErrAuthFailed is returned by Open when the database rejects the
+	// credentials in the DSN.
+	ErrAuthFailed = errors.New("database authentication failed")
+)
+
+// A connectError is returned in place of the error that stopped Open
+// from connecting to a database. errors.Is reports it as its kind, such
+// as ErrCannotConnect, while errors.Unwrap returns the driver's error.
+type connectError struct {
+	kind error
+	err  error
+}
+
+func (e *connectError) Error() string { return e.kind.Error() + ": " + e.err.Error() }
+
+func (e *connectError) Unwrap() error { return e.err }
+
+func (e *connectError) Is(target error) bool { return target == e.kind }
+
+// classifyConnectError returns err as a connectError if it's an
+// authentication failure or a failure to reach the database, and err
+// itself if it's neither.
+func classifyConnectError(err error) error {
+	switch {
+	case isAuthFailure(err):
+		return &connectError{kind: ErrAuthFailed, err: err}
+	case isConnectFailure(err):
+		return &connectError{kind: ErrCannotConnect, err: err}
+	}
+	return err
+}
+
+// isAuthFailure reports whether err is one of the supported drivers
+// rejecting a connection's credentials.
+func isAuthFailure(err error) bool {
+	// MySQL reports bad credentials with error 1045
+	// (ER_ACCESS_DENIED_ERROR).
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return myErr.Number == 1045
+	}
+
+	// Postgres reports them with SQLSTATE 28P01 (invalid_password) or
+	// 28000 (invalid_authorization_specification), such as for an
+	// unknown role.
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "28P01" || pqErr.Code == "28000"
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrAuth
+	}
+
+	return false
+}
+
+// isConnectFailure reports whether err means that the database couldn't
+// be reached, which for a network database is a failure to resolve its
+// host or dial it, and for SQLite a failure to open its file.
+func isConnectFailure(err error) bool {
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	if errors.As(err, &opErr) || errors.As(err, &dnsErr) {
+		return true
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrCantOpen
+	}
+
+	return false
+}
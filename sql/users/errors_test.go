@@ -0,0 +1,60 @@
+package users
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+func TestClassifyConnectError(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	tests := []struct {
+		err  error
+		want error // nil if err should be returned as is
+	}{
+		{refused, ErrCannotConnect},
+		{fmt.Errorf("ping: %w", refused), ErrCannotConnect},
+		{&net.DNSError{Err: "no such host", Name: "db.invalid"}, ErrCannotConnect},
+		{sqlite3.Error{Code: sqlite3.ErrCantOpen}, ErrCannotConnect},
+		{&mysql.MySQLError{Number: 1045}, ErrAuthFailed},
+		{&pq.Error{Code: "28P01"}, ErrAuthFailed},
+		{&pq.Error{Code: "28000"}, ErrAuthFailed},
+		{&pq.Error{Code: "3D000"}, nil},
+		{errors.New("something else"), nil},
+	}
+	for _, tt := range tests {
+		got := classifyConnectError(tt.err)
+		if tt.want == nil {
+			if got != tt.err {
+				t.Errorf("classifyConnectError(%v) = %v, want it unchanged", tt.err, got)
+			}
+			continue
+		}
+		if !errors.Is(got, tt.want) {
+			t.Errorf("classifyConnectError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+		if !errors.Is(got, tt.err) {
+			t.Errorf("classifyConnectError(%v) = %v, which doesn't wrap the driver's error", tt.err, got)
+		}
+	}
+}
+
+func TestOpenCannotConnect(t *testing.T) {
+	// Nothing listens on port 1, so the connection is refused.
+	dsn := DSN{User: "app", Password: "secret", Host: "127.0.0.1", Port: 1, Database: "app"}
+	_, err := Open(dsn.String(), Config{Dialect: MySQL, PingAttempts: 1})
+	if !errors.Is(err, ErrCannotConnect) {
+		t.Errorf("Open with a refused connection = %v, want ErrCannotConnect", err)
+	}
+
+	_, err = Open(filepath.Join(t.TempDir(), "missing", "users.db"), Config{Dialect: SQLite, PingAttempts: 1})
+	if !errors.Is(err, ErrCannotConnect) {
+		t.Errorf("Open with a file that can't be created = %v, want ErrCannotConnect", err)
+	}
+}
@@ -0,0 +1,73 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+)
+
+// eachUser calls fn with every user selected by query, one at a time,
+// for the store's methods that read whole tables. It stops as soon as fn
+// returns an error, which is returned as is. Other errors are prefixed
+// with op.
+//
+// On Postgres, if s.FetchSize is set, query is run through a cursor in a
+// transaction, fetching s.FetchSize users at a time, since lib/pq
+// otherwise reads the whole result set. MySQL's driver already streams
+// rows from the server as they're read, and SQLite steps through the
+// results, so they don't need one.
+func (s *Store) eachUser(ctx context.Context, op, query string, fn func(*User) error) error {
+	if s.dialect != Postgres || s.FetchSize <= 0 {
+		rows, err := s.queryContext(ctx, query)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		_, err = scanEachUser(rows, op, fn)
+		return err
+	}
+
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		// The cursor is closed when the transaction ends.
+		if _, err := tx.ExecContext(ctx, "declare user_cursor no scroll cursor for "+query); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		fetch := "fetch forward " + strconv.Itoa(s.FetchSize) + " from user_cursor"
+		for {
+			rows, err := tx.QueryContext(ctx, fetch)
+			if err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+			n, err := scanEachUser(rows, op, fn)
+			if err != nil {
+				return err
+			}
+			// A short fetch means the cursor has run out of rows.
+			if n < s.FetchSize {
+				return nil
+			}
+		}
+	})
+}
+
+// scanEachUser calls fn with every user in rows for eachUser, and returns
+// the number of users scanned. rows is closed once it returns.
+func scanEachUser(rows *sql.Rows, op string, fn func(*User) error) (int, error) {
+	defer rows.Close()
+
+	var n int
+	for rows.Next() {
+		u := new(User)
+		if err := scanInto(rows, u); err != nil {
+			return n, fmt.Errorf("%s: %w", op, err)
+		}
+		n++
+		if err := fn(u); err != nil {
+			return n, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return n, fmt.Errorf("%s: %w", op, err)
+	}
+	return n, nil
+}
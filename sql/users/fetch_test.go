@@ -0,0 +1,179 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A cursorConn is a driver.Conn that pretends to be a Postgres database
+// with a cursor over users with the given names, and records the
+// statements it's sent.
+type cursorConn struct {
+	names   []string
+	next    int
+	queries []string
+}
+
+func (c *cursorConn) Prepare(query string) (driver.Stmt, error) {
+	return &cursorStmt{c: c, query: query}, nil
+}
+
+func (c *cursorConn) Close() error              { return nil }
+func (c *cursorConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *cursorConn) Commit() error             { return nil }
+func (c *cursorConn) Rollback() error           { return nil }
+
+// A cursorStmt is a statement prepared on a cursorConn.
+type cursorStmt struct {
+	c     *cursorConn
+	query string
+}
+
+func (s *cursorStmt) Close() error  { return nil }
+func (s *cursorStmt) NumInput() int { return -1 }
+
+func (s *cursorStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.c.queries = append(s.c.queries, s.query)
+	return driver.RowsAffected(0), nil
+}
+
+// Query answers fetch forward statements with the cursor's next rows.
+func (s *cursorStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.c.queries = append(s.c.queries, s.query)
+	n, err := fetchCount(s.query)
+	if err != nil {
+		return nil, err
+	}
+	rows := &cursorRows{}
+	for i := 0; i < n && s.c.next < len(s.c.names); i++ {
+		s.c.next++
+		rows.users = append(rows.users, cursorUser(s.c.next, s.c.names[s.c.next-1]))
+	}
+	return rows, nil
+}
+
+// fetchCount returns the number of rows fetched by query, a fetch
+// forward statement.
+func fetchCount(query string) (int, error) {
+	fields := strings.Fields(query)
+	if len(fields) < 3 || fields[0] != "fetch" {
+		return 0, errors.New("unexpected query: " + query)
+	}
+	return strconv.Atoi(fields[2])
+}
+
+// cursorUser returns the userColumns of a user with the given id and
+// username, and every other column empty.
+func cursorUser(id int, username string) []driver.Value {
+	return []driver.Value{int64(id), username, nil, nil, RoleUser, time.Time{}, time.Time{}, int64(1), nil, int64(0), nil, false, nil}
+}
+
+// cursorRows are rows fetched from a cursorConn.
+type cursorRows struct {
+	users [][]driver.Value
+}
+
+func (r *cursorRows) Columns() []string { return userColumnNames }
+func (r *cursorRows) Close() error      { return nil }
+
+func (r *cursorRows) Next(dest []driver.Value) error {
+	if len(r.users) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.users[0])
+	r.users = r.users[1:]
+	return nil
+}
+
+// A cursorConnector connects to a single cursorConn.
+type cursorConnector struct {
+	c *cursorConn
+}
+
+func (c cursorConnector) Connect(context.Context) (driver.Conn, error) { return c.c, nil }
+func (c cursorConnector) Driver() driver.Driver                        { return nil }
+
+func TestEachUserFetchSize(t *testing.T) {
+	tests := []struct {
+		users       int
+		wantFetches int
+	}{
+		{0, 1},
+		{4, 3}, // the last fetch finds that the cursor has run out
+		{5, 3},
+	}
+	for _, tt := range tests {
+		names := make([]string, tt.users)
+		for i := range names {
+			names[i] = "user" + strconv.Itoa(i)
+		}
+		c := &cursorConn{names: names}
+		db := sql.OpenDB(cursorConnector{c})
+		s := NewStore(db, Postgres)
+		s.FetchSize = 2
+
+		var got []string
+		err := s.eachUser(context.Background(), "stream users", "select "+userColumns+" from users", func(u *User) error {
+			got = append(got, u.Username)
+			return nil
+		})
+		db.Close()
+		if err != nil {
+			t.Errorf("%d users: %v", tt.users, err)
+			continue
+		}
+		if strings.Join(got, " ") != strings.Join(names, " ") {
+			t.Errorf("%d users: read %q, want %q", tt.users, got, names)
+		}
+		if c.queries[0] != "declare user_cursor no scroll cursor for select "+userColumns+" from users" {
+			t.Errorf("%d users: first statement %q doesn't declare the cursor", tt.users, c.queries[0])
+		}
+		fetches := 0
+		for _, q := range c.queries[1:] {
+			if q != "fetch forward 2 from user_cursor" {
+				t.Errorf("%d users: unexpected statement %q", tt.users, q)
+			}
+			fetches++
+		}
+		if fetches != tt.wantFetches {
+			t.Errorf("%d users: fetched %d times, want %d", tt.users, fetches, tt.wantFetches)
+		}
+	}
+}
+
+func TestEachUserWithoutCursor(t *testing.T) {
+	// SQLite steps through the results, so FetchSize doesn't change how
+	// they're read.
+	db := newTestDB(t)
+	s := NewStore(db, SQLite)
+	s.FetchSize = 2
+	ctx := context.Background()
+	for _, name := range []string{"alice", "bob", "carol"} {
+		if _, err := db.Exec("insert into users (username, role, created_at, updated_at) values (?, 'user', 0, 0)", name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	errStop := errors.New("stop")
+	err := s.eachUser(ctx, "stream users", "select "+userColumns+" from users order by id", func(u *User) error {
+		got = append(got, u.Username)
+		if len(got) == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("err = %v, want fn's error", err)
+	}
+	if strings.Join(got, " ") != "alice bob" {
+		t.Errorf("read %q before stopping, want alice and bob", got)
+	}
+}
@@ -0,0 +1,76 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+)
+
+// The functions in this file predate Store and are kept so that existing
+// callers passing around a *sql.DB keep working. They all use the MySQL
+// dialect.
+
+// CreateUser calls CreateUserContext with context.Background().
+func CreateUser(db *sql.DB, u *User) (int64, error) {
+	return CreateUserContext(context.Background(), db, u)
+}
+
+// CreateUserContext calls CreateUser on a MySQL Store for db.
+// See Store.CreateUser for details.
+func CreateUserContext(ctx context.Context, db *sql.DB, u *User) (int64, error) {
+	return NewStore(db, MySQL).CreateUser(ctx, u)
+}
+
+// GetUserByID calls GetUserByIDContext with context.Background().
+func GetUserByID(db *sql.DB, id int) (*User, error) {
+	return GetUserByIDContext(context.Background(), db, id)
+}
+
+// GetUserByIDContext calls GetUserByID on a MySQL Store for db.
+// See Store.GetUserByID for details.
+func GetUserByIDContext(ctx context.Context, db *sql.DB, id int) (*User, error) {
+	return NewStore(db, MySQL).GetUserByID(ctx, id)
+}
+
+// GetUserByUsername calls GetUserByUsernameContext with context.Background().
+func GetUserByUsername(db *sql.DB, username string) (*User, error) {
+	return GetUserByUsernameContext(context.Background(), db, username)
+}
+
+// GetUserByUsernameContext calls GetUserByUsername on a MySQL Store for db.
+// See Store.GetUserByUsername for details.
+func GetUserByUsernameContext(ctx context.Context, db *sql.DB, username string) (*User, error) {
+	return NewStore(db, MySQL).GetUserByUsername(ctx, username)
+}
+
+// UpdateUser calls UpdateUserContext with context.Background().
+func UpdateUser(db *sql.DB, u *User) error {
+	return UpdateUserContext(context.Background(), db, u)
+}
+
+// UpdateUserContext calls UpdateUser on a MySQL Store for db.
+// See Store.UpdateUser for details.
+func UpdateUserContext(ctx context.Context, db *sql.DB, u *User) error {
+	return NewStore(db, MySQL).UpdateUser(ctx, u)
+}
+
+// DeleteUser calls DeleteUserContext with context.Background().
+func DeleteUser(db *sql.DB, id int) error {
+	return DeleteUserContext(context.Background(), db, id)
+}
+
+// DeleteUserContext calls DeleteUser on a MySQL Store for db.
+// See Store.DeleteUser for details.
+func DeleteUserContext(ctx context.Context, db *sql.DB, id int) error {
+	return NewStore(db, MySQL).DeleteUser(ctx, id)
+}
+
+// ListUsers calls ListUsersContext with context.Background().
+func ListUsers(db *sql.DB, limit, offset int) ([]*User, error) {
+	return ListUsersContext(context.Background(), db, limit, offset)
+}
+
+// ListUsersContext calls ListUsers on a MySQL Store for db, listing users
+// in order of their ids. See Store.ListUsers for details.
+func ListUsersContext(ctx context.Context, db *sql.DB, limit, offset int) ([]*User, error) {
+	return NewStore(db, MySQL).ListUsers(ctx, ListOptions{Limit: limit, Offset: offset})
+}
@@ -0,0 +1,193 @@
+package users
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// A userRequest is the JSON body accepted when creating or updating a
+// user. It's separate from User since a User never decodes its password
+// from JSON.
+type userRequest struct {
+	Username string  `json:"username"`
+	Email    *string `json:"email"`
+	Password string  `json:"password"`
+
+	// Version must be the version of the user being updated, as read
+	// from it earlier. It's ignored when creating a user.
+	Version int `json:"version"`
+}
+
+// NewHandler returns an http.Handler that serves the users in s as JSON:
+//
+//	GET    /users/{id}  returns the user with the given id
+//	POST   /users       creates a user from a username, email and password
+//	PUT    /users/{id}  replaces the username, email and password of a user
+//	DELETE /users/{id}  deletes a user
+//
+// Unknown users are reported with a 404, invalid users with a 400, and
+// taken usernames or emails and updates of stale versions with a 409.
+func NewHandler(s *Store) http.Handler {
+	h := &userHandler{store: s}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", h.get)
+	mux.HandleFunc("POST /users", h.create)
+	mux.HandleFunc("PUT /users/{id}", h.update)
+	mux.HandleFunc("DELETE /users/{id}", h.delete)
+	return mux
+}
+
+// A userHandler implements the handlers returned by NewHandler.
+type userHandler struct {
+	store *Store
+}
+
+func (h *userHandler) get(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	u, err := h.store.GetUserByID(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, u)
+}
+
+func (h *userHandler) create(w http.ResponseWriter, r *http.Request) {
+	var req userRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	u := &User{Username: req.Username, Email: req.Email, Password: req.Password}
+	if _, err := h.store.CreateUser(r.Context(), u); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, u)
+}
+
+func (h *userHandler) update(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	var req userRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// UpdateUser stores the password as is, so the plaintext password
+	// is validated, checked against the store's password policy and
+	// hashed here first.
+	u := &User{Id: id, Username: req.Username, Email: req.Email, Password: req.Password, Version: req.Version}
+	if err := u.Validate(); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := h.store.PasswordPolicy.Validate(u.Password); err != nil {
+		writeError(w, err)
+		return
+	}
+	hash, err := h.store.hashPassword(u.Password)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	u.Password = hash
+
+	// Roles and metadata can't be changed through the API, so the user
+	// keeps the ones it already has. If the user changes in between, its
+	// version will have moved on and UpdateUser will report a conflict.
+	existing, err := h.store.GetUserByID(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	u.Role = existing.Role
+	u.Metadata = existing.Metadata
+
+	if err := h.store.UpdateUser(r.Context(), u); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, u)
+}
+
+func (h *userHandler) delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.DeleteUser(r.Context(), id); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pathID parses the {id} wildcard of r's path. If it isn't a valid id,
+// pathID writes a 400 response and returns false.
+func pathID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	// PathValue returns the value for the named path wildcard in the
+	// ServeMux pattern that matched the request.
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// writeJSON writes v as a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error response for err, with a status code that
+// depends on the kind of error. Users with invalid fields get a JSON
+// object mapping each field to what's wrong with it, under "errors", so
+// that clients can show the problems next to the fields.
+func writeError(w http.ResponseWriter, err error) {
+	var ve *ValidationError
+	switch {
+	case errors.As(err, &ve):
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"errors": ve.Fields})
+	case errors.Is(err, ErrUserNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case isValidationError(err):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrDuplicateUsername), errors.Is(err, ErrDuplicateEmail),
+		errors.Is(err, ErrVersionConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		// Don't expose the details of unexpected errors to clients.
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// isValidationError reports whether err was caused by invalid user input.
+func isValidationError(err error) bool {
+	return errors.Is(err, ErrEmptyUsername) ||
+		errors.Is(err, ErrUsernameTooLong) ||
+		errors.Is(err, ErrEmptyEmail) ||
+		errors.Is(err, ErrEmptyPassword) ||
+		errors.Is(err, ErrInvalidRole) ||
+		errors.Is(err, ErrPasswordTooShort) ||
+		errors.Is(err, ErrPasswordNoUpper) ||
+		errors.Is(err, ErrPasswordNoDigit) ||
+		errors.Is(err, ErrPasswordNoSymbol) ||
+		errors.Is(err, ErrMissingUserID)
+}
@@ -0,0 +1,128 @@
+package users_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+// do sends a request with the given method, path and body to h, and
+// returns the response.
+func do(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	var r *http.Request
+	if body == "" {
+		r = httptest.NewRequest(method, path, nil)
+	} else {
+		r = httptest.NewRequest(method, path, strings.NewReader(body))
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestHandler(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	h := users.NewHandler(s)
+
+	w := do(h, "POST", "/users", `{"username": "alice", "email": "alice@example.com", "password": "password123"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST: status %d: %s", w.Code, w.Body)
+	}
+	var created users.User
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	path := "/users/" + strconv.Itoa(created.Id)
+
+	w = do(h, "GET", path, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET: status %d: %s", w.Code, w.Body)
+	}
+	if strings.Contains(w.Body.String(), "password") {
+		t.Errorf("GET response exposes the password: %s", w.Body)
+	}
+
+	w = do(h, "POST", "/users", `{"username": "alice", "password": "password123"}`)
+	if w.Code != http.StatusConflict {
+		t.Errorf("POST taken username: status %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	w = do(h, "PUT", path, `{"username": "alice", "email": "new@example.com", "password": "password456", "version": 1}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT: status %d: %s", w.Code, w.Body)
+	}
+	u, err := s.GetUserByID(context.Background(), created.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *u.Email != "new@example.com" || !users.CheckPassword(u.Password, "password456") {
+		t.Errorf("PUT didn't update the user: email %q", *u.Email)
+	}
+
+	w = do(h, "PUT", path, `{"username": "alice", "password": "password789", "version": 1}`)
+	if w.Code != http.StatusConflict {
+		t.Errorf("PUT stale version: status %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	w = do(h, "DELETE", path, "")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE: status %d: %s", w.Code, w.Body)
+	}
+	w = do(h, "GET", path, "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET deleted user: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestHandlerInvalidRequests(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	h := users.NewHandler(s)
+
+	tests := []struct {
+		method, path, body string
+	}{
+		{"GET", "/users/abc", ""},
+		{"GET", "/users/0", ""},
+		{"POST", "/users", `{"username": `},
+		{"POST", "/users", `{"username": "", "password": "password123"}`},
+		{"POST", "/users", `{"username": "bob"}`},
+	}
+	for _, tt := range tests {
+		w := do(h, tt.method, tt.path, tt.body)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s %s %s: status %d, want %d", tt.method, tt.path, tt.body, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestHandlerUpdatePasswordPolicy(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	s.PasswordPolicy = users.PasswordPolicy{MinLength: 12}
+	h := users.NewHandler(s)
+
+	u := &users.User{Username: "alice", Password: "long enough password"}
+	id, err := s.CreateUser(context.Background(), u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := "/users/" + strconv.FormatInt(id, 10)
+
+	w := do(h, "PUT", path, `{"username": "alice", "password": "short", "version": 1}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("PUT short password: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	got, err := s.GetUserByID(context.Background(), int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !users.CheckPassword(got.Password, "long enough password") {
+		t.Error("PUT changed the password to one the policy rejects")
+	}
+}
@@ -0,0 +1,210 @@
+package users
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// A Hasher hashes passwords for a Store, and checks passwords against the
+// hashes it made. Hashes must describe how they were made, such as with a
+// prefix naming the algorithm and its parameters, so that they can still
+// be checked after the store's Hasher or its settings change.
+type Hasher interface {
+	// Hash returns the hash of plain.
+	Hash(plain string) (string, error)
+
+	// Verify reports whether plain is the password that hash was made
+	// from. It only returns an error if hash is malformed or can't be
+	// checked, not for a wrong password.
+	Verify(hash, plain string) (bool, error)
+}
+
+// A BcryptHasher hashes passwords with bcrypt, which only uses the first
+// 72 bytes of a password and refuses to hash longer ones. Its hashes
+// start with $2a$, followed by the cost.
+type BcryptHasher struct {
+	// Cost is the bcrypt cost, or BcryptCost if it isn't set.
+	Cost int
+}
+
+// Hash implements Hasher.
+func (h BcryptHasher) Hash(plain string) (string, error) {
+	cost := h.Cost
+	if cost == 0 {
+		cost = BcryptCost
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(plain), cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Verify implements Hasher.
+func (h BcryptHasher) Verify(hash, plain string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(plain))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// The defaults for the fields of an Argon2idHasher, which are those
+// recommended by RFC 9106 for memory-constrained environments.
+const (
+	defaultArgon2Time    = 3
+	defaultArgon2Memory  = 64 * 1024
+	defaultArgon2Threads = 4
+	defaultArgon2KeyLen  = 32
+	argon2SaltLen        = 16
+)
+
+// An Argon2idHasher hashes passwords with Argon2id, which unlike bcrypt
+// has no limit on the length of passwords. Its hashes use the PHC string
+// format, as in $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>, with the
+// parameters they were made with, so changing the fields doesn't stop
+// existing hashes from being checked.
+type Argon2idHasher struct {
+	// Time is the number of passes over the memory, Memory is the amount
+	// of memory used in KiB, Threads is the degree of parallelism and
+	// KeyLen is the length of the derived key in bytes. Fields that
+	// aren't set use the defaults of 3 passes, 64 MiB, 4 threads and 32
+	// bytes.
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+	KeyLen  uint32
+}
+
+// argon2idPrefix starts every hash made by an Argon2idHasher.
+const argon2idPrefix = "$argon2id$"
+
+// Hash implements Hasher.
+func (h Argon2idHasher) Hash(plain string) (string, error) {
+	if h.Time == 0 {
+		h.Time = defaultArgon2Time
+	}
+	if h.Memory == 0 {
+		h.Memory = defaultArgon2Memory
+	}
+	if h.Threads == 0 {
+		h.Threads = defaultArgon2Threads
+	}
+	if h.KeyLen == 0 {
+		h.KeyLen = defaultArgon2KeyLen
+	}
+
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(plain), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version,
+		h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify implements Hasher. The fields of h are ignored in favour of the
+// parameters recorded in hash.
+func (h Argon2idHasher) Verify(hash, plain string) (bool, error) {
+	// The hash splits into "", "argon2id", the version, the parameters,
+	// the salt and the key.
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, fmt.Errorf("argon2id: malformed hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return false, fmt.Errorf("argon2id: malformed version: %w", err)
+	}
+	if version != argon2.Version {
+		return false, fmt.Errorf("argon2id: unsupported version %d", version)
+	}
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, fmt.Errorf("argon2id: malformed parameters: %w", err)
+	}
+	// argon2.IDKey panics for a zero time or thread count.
+	if time == 0 || threads == 0 {
+		return false, fmt.Errorf("argon2id: malformed parameters: t and p must be positive")
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, fmt.Errorf("argon2id: malformed salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, fmt.Errorf("argon2id: malformed key: %w", err)
+	}
+	// An empty key would match the empty key derived for any password.
+	if len(key) == 0 {
+		return false, fmt.Errorf("argon2id: malformed key: empty")
+	}
+
+	got := argon2.IDKey([]byte(plain), salt, time, memory, threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(got, key) == 1, nil
+}
+
+// hasherFor returns the built-in Hasher that made hash, going by its
+// prefix, or nil if it wasn't made by one of them.
+func hasherFor(hash string) Hasher {
+	switch {
+	case strings.HasPrefix(hash, argon2idPrefix):
+		return Argon2idHasher{}
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return BcryptHasher{}
+	}
+	return nil
+}
+
+// hasher returns s.Hasher, or a BcryptHasher if it isn't set.
+func (s *Store) hasher() Hasher {
+	if s.Hasher == nil {
+		return BcryptHasher{}
+	}
+	return s.Hasher
+}
+
+// hashPassword hashes plain with s's Hasher.
+func (s *Store) hashPassword(plain string) (string, error) {
+	return s.hasher().Hash(plain)
+}
+
+// verifyPassword reports whether plain is the password that hash was made
+// from, using the built-in Hasher that made hash if there is one, and s's
+// Hasher otherwise.
+func (s *Store) verifyPassword(hash, plain string) (bool, error) {
+	h := hasherFor(hash)
+	if h == nil {
+		h = s.hasher()
+	}
+	return h.Verify(hash, plain)
+}
+
+// hashOutdated reports whether hash was made by a different built-in
+// Hasher than s's, so that it should be replaced with one made by s's
+// Hasher when the password is next known. Hashes are never considered
+// outdated for stores with a Hasher of their own.
+func (s *Store) hashOutdated(hash string) bool {
+	switch s.hasher().(type) {
+	case BcryptHasher, *BcryptHasher:
+		_, ok := hasherFor(hash).(Argon2idHasher)
+		return ok
+	case Argon2idHasher, *Argon2idHasher:
+		_, ok := hasherFor(hash).(BcryptHasher)
+		return ok
+	}
+	return false
+}
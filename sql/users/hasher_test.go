@@ -0,0 +1,84 @@
+package users_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+// testArgon2 is an Argon2idHasher with parameters small enough to keep
+// the tests fast.
+var testArgon2 = users.Argon2idHasher{Time: 1, Memory: 64, Threads: 1}
+
+func TestHashers(t *testing.T) {
+	hashers := []users.Hasher{users.BcryptHasher{}, testArgon2}
+	for _, h := range hashers {
+		hash, err := h.Hash("password123")
+		if err != nil {
+			t.Fatalf("%T: %v", h, err)
+		}
+		if ok, err := h.Verify(hash, "password123"); err != nil || !ok {
+			t.Errorf("%T: Verify(right password) = %v, %v", h, ok, err)
+		}
+		if ok, err := h.Verify(hash, "password456"); err != nil || ok {
+			t.Errorf("%T: Verify(wrong password) = %v, %v", h, ok, err)
+		}
+	}
+}
+
+func TestArgon2idHasherMalformed(t *testing.T) {
+	// Each of these would otherwise verify any password or panic.
+	hashes := []string{
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$",
+		"$argon2id$v=19$m=64,t=0,p=1$c2FsdHNhbHQ$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=0$c2FsdHNhbHQ$a2V5",
+		"$argon2id$v=19$m=64,t=1$c2FsdHNhbHQ$a2V5",
+		"$argon2id$v=18$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$!!!",
+	}
+	for _, hash := range hashes {
+		ok, err := testArgon2.Verify(hash, "anything")
+		if err == nil || ok {
+			t.Errorf("Verify(%q) = %v, %v; want an error", hash, ok, err)
+		}
+	}
+}
+
+func TestStoreVerifiesEitherHasher(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+
+	// alice's password is hashed with bcrypt, and bob's with Argon2id.
+	if _, err := s.CreateUser(ctx, &users.User{Username: "alice", Password: "password123"}); err != nil {
+		t.Fatal(err)
+	}
+	s.Hasher = testArgon2
+	if _, err := s.CreateUser(ctx, &users.User{Username: "bob", Password: "password123"}); err != nil {
+		t.Fatal(err)
+	}
+	bob, err := s.GetUserByUsername(ctx, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(bob.Password, "$argon2id$") {
+		t.Errorf("bob's hash %q wasn't made by Argon2idHasher", bob.Password)
+	}
+
+	for _, username := range []string{"alice", "bob"} {
+		if _, err := s.Authenticate(ctx, username, "password123"); err != nil {
+			t.Errorf("Authenticate(%s): %v", username, err)
+		}
+	}
+
+	// alice's password is rehashed with Argon2id once she signs in.
+	alice, err := s.GetUserByUsername(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(alice.Password, "$argon2id$") {
+		t.Errorf("alice's hash %q wasn't replaced on sign in", alice.Password)
+	}
+}
@@ -0,0 +1,45 @@
+package users
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// HealthCheck reports whether the store's database is usable. Besides
+// pinging the database it runs a trivial query, which catches databases
+// that accept connections but can't currently run queries. Both respect
+// ctx's deadline.
+func (s *Store) HealthCheck(ctx context.Context) error {
+	ctx, cancel := s.withDefaultTimeout(ctx)
+	defer cancel()
+
+	if err := s.conn().PingContext(ctx); err != nil {
+		return fmt.Errorf("health check: %w", err)
+	}
+	var one int
+	if err := s.conn().QueryRowContext(ctx, "select 1").Scan(&one); err != nil {
+		return fmt.Errorf("health check: %w", err)
+	}
+	return nil
+}
+
+// HealthHandler returns a handler for readiness probes, which responds
+// with 200 OK if s passes HealthCheck and 503 Service Unavailable if it
+// doesn't. The check is bounded by the request's context.
+func (s *Store) HealthHandler() http.HandlerFunc {
+	return healthHandler(s.HealthCheck)
+}
+
+// healthHandler returns the handler of HealthHandler, which runs check.
+func healthHandler(check func(ctx context.Context) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := check(r.Context()); err != nil {
+			// The error isn't exposed to clients, like writeError does
+			// for unexpected errors.
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	}
+}
@@ -0,0 +1,47 @@
+package users_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+)
+
+func TestHealthHandler(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	h := s.HealthHandler()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "ok\n" {
+		t.Errorf("healthy store: status %d, body %q; want 200, ok", w.Code, w.Body)
+	}
+
+	// Once the database is closed the check fails, without the error
+	// being shown to the client.
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.HealthCheck(context.Background()); err == nil {
+		t.Error("HealthCheck succeeded after Shutdown")
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	if want := http.StatusText(http.StatusServiceUnavailable) + "\n"; w.Code != http.StatusServiceUnavailable || w.Body.String() != want {
+		t.Errorf("closed store: status %d, body %q; want 503, %q", w.Code, w.Body, want)
+	}
+}
+
+func TestHealthHandlerCanceled(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	w := httptest.NewRecorder()
+	s.HealthHandler().ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil).WithContext(ctx))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("canceled request: status %d, want 503", w.Code)
+	}
+}
@@ -0,0 +1,142 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// A Hook is told about the users a Store creates, updates and deletes,
+// such as to keep a cache or search index in step with the database.
+// Hooks are only called once the change has been committed, so they
+// never see changes that were rolled back.
+//
+// The user a hook is given is a copy, without its Password. Methods that
+// are only given a user's id, such as DeleteUser and SetRole, pass a User
+// with just the fields they know, so hooks that need the rest must read
+// the user themselves. Likewise, methods that insert many users at once,
+// such as CreateUsers and ImportCSV, pass users without their ids.
+type Hook interface {
+	OnCreate(ctx context.Context, u *User) error
+	OnUpdate(ctx context.Context, u *User) error
+	OnDelete(ctx context.Context, u *User) error
+}
+
+// A hookEvent is the kind of change a Hook is told about.
+type hookEvent int
+
+const (
+	hookCreate hookEvent = iota
+	hookUpdate
+	hookDelete
+)
+
+func (e hookEvent) String() string {
+	switch e {
+	case hookCreate:
+		return "create"
+	case hookUpdate:
+		return "update"
+	}
+	return "delete"
+}
+
+// A pendingHook is a change made within a transaction that the hooks are
+// told about once the transaction commits.
+type pendingHook struct {
+	event hookEvent
+	u     *User
+}
+
+// runHooks tells s.Hooks about event for u. If s runs its queries within
+// a transaction passed to the function given to WithinTx, the hooks are
+// instead called once the transaction commits, by WithinTx.
+//
+// Errors from the hooks are logged, to s's slog logger if it has one and
+// with the log package otherwise. They're only returned if
+// s.FailOnHookError is set.
+func (s *Store) runHooks(ctx context.Context, event hookEvent, u *User) error {
+	if len(s.Hooks) == 0 {
+		return nil
+	}
+	u = copyUser(u)
+	u.Password = ""
+
+	if s.tx != nil {
+		r := s.root()
+		r.mu.Lock()
+		r.pendingHooks = append(r.pendingHooks, pendingHook{event: event, u: u})
+		r.mu.Unlock()
+		return nil
+	}
+	return s.callHooks(ctx, event, u)
+}
+
+// runHooksForEach calls runHooks for each of users, for the methods that
+// change several users at once. It returns the hooks' errors joined
+// together.
+func (s *Store) runHooksForEach(ctx context.Context, event hookEvent, users []*User) error {
+	var errs []error
+	for _, u := range users {
+		if err := s.runHooks(ctx, event, u); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// callHooks calls every one of s.Hooks for event and u, even if earlier
+// ones fail.
+func (s *Store) callHooks(ctx context.Context, event hookEvent, u *User) error {
+	var errs []error
+	for _, h := range s.Hooks {
+		var err error
+		switch event {
+		case hookCreate:
+			err = h.OnCreate(ctx, u)
+		case hookUpdate:
+			err = h.OnUpdate(ctx, u)
+		case hookDelete:
+			err = h.OnDelete(ctx, u)
+		}
+		if err == nil {
+			continue
+		}
+		if s.slog != nil {
+			s.slog.ErrorContext(ctx, "store hook failed",
+				"event", event.String(),
+				"user_id", u.Id,
+				"request_id", requestIDFromContext(ctx),
+				"error", err,
+			)
+		} else {
+			log.Printf("hook failed: event=%s user_id=%d request_id=%q err=%v",
+				event, u.Id, requestIDFromContext(ctx), err)
+		}
+		errs = append(errs, err)
+	}
+
+	if !s.FailOnHookError || len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s hook: %w", event, errors.Join(errs...))
+}
+
+// flushHooks calls the hooks for the changes queued up by runHooks in s,
+// a store passed to the function given to WithinTx, once its transaction
+// has been committed.
+func (s *Store) flushHooks(ctx context.Context) error {
+	s.mu.Lock()
+	pending := s.pendingHooks
+	s.pendingHooks = nil
+	s.mu.Unlock()
+
+	var errs []error
+	for _, p := range pending {
+		if err := s.callHooks(ctx, p.event, p.u); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
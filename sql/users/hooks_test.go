@@ -0,0 +1,221 @@
+package users_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+// A recordingHook records the events it's told about as strings such as
+// "create alice" or "delete 3".
+type recordingHook struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (h *recordingHook) record(event string, u *users.User) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if u.Password != "" {
+		return errors.New("hook was given a password")
+	}
+	if u.Username != "" {
+		h.events = append(h.events, event+" "+u.Username)
+	} else {
+		h.events = append(h.events, fmt.Sprintf("%s %d", event, u.Id))
+	}
+	return nil
+}
+
+func (h *recordingHook) OnCreate(ctx context.Context, u *users.User) error {
+	return h.record("create", u)
+}
+
+func (h *recordingHook) OnUpdate(ctx context.Context, u *users.User) error {
+	return h.record("update", u)
+}
+
+func (h *recordingHook) OnDelete(ctx context.Context, u *users.User) error {
+	return h.record("delete", u)
+}
+
+// take returns the events recorded since it was last called, formatted
+// by events.
+func (h *recordingHook) take() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	recorded := h.events
+	h.events = nil
+	return events(recorded...)
+}
+
+// events sorts the given events and joins them into a single string.
+func events(list ...string) string {
+	sort.Strings(list)
+	return strings.Join(list, ", ")
+}
+
+// newHookedStore returns a test store whose only hook is the returned
+// recordingHook, which fails the test if a hook returns an error.
+func newHookedStore(t *testing.T) (*users.Store, *recordingHook) {
+	s := dbtest.NewTestStore(t)
+	h := &recordingHook{}
+	s.Hooks = []users.Hook{h}
+	s.FailOnHookError = true
+	return s, h
+}
+
+func TestHooks(t *testing.T) {
+	s, h := newHookedStore(t)
+	ctx := context.Background()
+
+	id := createUsers(t, s, "alice")[0]
+	if got, want := h.take(), "create alice"; got != want {
+		t.Errorf("CreateUser: events %q, want %q", got, want)
+	}
+
+	if err := s.SetRole(ctx, id, users.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := h.take(), fmt.Sprintf("update %d", id); got != want {
+		t.Errorf("SetRole: events %q, want %q", got, want)
+	}
+
+	if err := s.DeleteUser(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := h.take(), fmt.Sprintf("delete %d", id); got != want {
+		t.Errorf("DeleteUser: events %q, want %q", got, want)
+	}
+}
+
+func TestHooksWithinTx(t *testing.T) {
+	s, h := newHookedStore(t)
+	ctx := context.Background()
+
+	errRollback := errors.New("roll back")
+	err := s.WithinTx(ctx, func(ts *users.Store) error {
+		createUsers(t, ts, "alice")
+		if got := h.take(); got != "" {
+			t.Errorf("hooks called before commit: %q", got)
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("WithinTx: err = %v", err)
+	}
+	if got := h.take(); got != "" {
+		t.Errorf("hooks called for a rolled back transaction: %q", got)
+	}
+
+	err = s.WithinTx(ctx, func(ts *users.Store) error {
+		createUsers(t, ts, "bob")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := h.take(), "create bob"; got != want {
+		t.Errorf("events %q, want %q", got, want)
+	}
+}
+
+func TestHooksBulk(t *testing.T) {
+	s, h := newHookedStore(t)
+	ctx := context.Background()
+
+	_, err := s.CreateUsers(ctx, []*users.User{
+		{Username: "alice", Password: "password123"},
+		{Username: "bob", Password: "password123"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := h.take(), "create alice, create bob"; got != want {
+		t.Errorf("CreateUsers: events %q, want %q", got, want)
+	}
+
+	_, err = s.ImportCSV(ctx, strings.NewReader("username,password\ncarol,password123\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := h.take(), "create carol"; got != want {
+		t.Errorf("ImportCSV: events %q, want %q", got, want)
+	}
+
+	if err := users.Seed(ctx, s, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Seed(ctx, s, 3); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := h.take(), "create user1, create user2, create user3"; got != want {
+		t.Errorf("Seed: events %q, want %q", got, want)
+	}
+
+	ids := createUsers(t, s, "dave", "erin")
+	h.take()
+
+	// The id that doesn't belong to a user mustn't be reported.
+	err = s.BulkSetRoles(ctx, map[int]string{ids[0]: users.RoleAdmin, ids[1]: users.RoleAdmin, 1000: users.RoleAdmin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := h.take(), events(fmt.Sprintf("update %d", ids[0]), fmt.Sprintf("update %d", ids[1])); got != want {
+		t.Errorf("BulkSetRoles: events %q, want %q", got, want)
+	}
+
+	n, err := s.DeleteUsersByIDs(ctx, []int{ids[0], 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("DeleteUsersByIDs deleted %d users, want 1", n)
+	}
+	if got, want := h.take(), fmt.Sprintf("delete %d", ids[0]); got != want {
+		t.Errorf("DeleteUsersByIDs: events %q, want %q", got, want)
+	}
+
+	if err := s.RecordLogin(ctx, ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	h.take()
+	n, err = s.DeleteInactiveUsers(ctx, time.Now().Add(time.Hour), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("DeleteInactiveUsers deleted %d users, want 1", n)
+	}
+	if got, want := h.take(), fmt.Sprintf("delete %d", ids[1]); got != want {
+		t.Errorf("DeleteInactiveUsers: events %q, want %q", got, want)
+	}
+}
+
+func TestHooksNotCalledOnFailure(t *testing.T) {
+	s, h := newHookedStore(t)
+	ctx := context.Background()
+
+	createUsers(t, s, "alice")
+	h.take()
+
+	// The duplicate rolls back the whole batch.
+	_, err := s.CreateUsers(ctx, []*users.User{
+		{Username: "bob", Password: "password123"},
+		{Username: "alice", Password: "password123"},
+	})
+	if !errors.Is(err, users.ErrDuplicateUsername) {
+		t.Fatalf("err = %v, want ErrDuplicateUsername", err)
+	}
+	if got := h.take(); got != "" {
+		t.Errorf("hooks called for a failed insert: %q", got)
+	}
+}
@@ -0,0 +1,124 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// defaultIdempotencyWindow is how long idempotency keys are remembered
+// if a Store's IdempotencyWindow isn't set.
+const defaultIdempotencyWindow = 24 * time.Hour
+
+// ErrEmptyIdempotencyKey is returned by CreateUserIdempotent when it's
+// given an empty idempotency key.
+var ErrEmptyIdempotencyKey = errors.New("idempotency key is required")
+
+// idempotencyWindow returns s.IdempotencyWindow, or
+// defaultIdempotencyWindow if it isn't set.
+func (s *Store) idempotencyWindow() time.Duration {
+	if s.IdempotencyWindow <= 0 {
+		return defaultIdempotencyWindow
+	}
+	return s.IdempotencyWindow
+}
+
+// CreateUserIdempotent is like CreateUser, but only creates one user for
+// each idempotency key, so that clients can safely retry a create whose
+// outcome they don't know. The first call with a key creates u, records
+// its id along with the key in the idempotency_keys table and returns u.
+// Later calls with the same key return the user that was created, as it
+// is now, without creating another one, until the key is older than
+// s.IdempotencyWindow. After that the key can be used again.
+//
+// Keys are scoped to s's table and tenant, so the same key can be used
+// for different tenants without them seeing each other's users. Stores
+// that aren't scoped to a tenant share their keys with tenant 0.
+func (s *Store) CreateUserIdempotent(ctx context.Context, key string, u *User) (created *User, err error) {
+	ctx, op, err := s.startOp(ctx, "CreateUserIdempotent")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { op.end(err, 1) }()
+
+	if key == "" {
+		return nil, fmt.Errorf("create user idempotent: %w", ErrEmptyIdempotencyKey)
+	}
+
+	var id int
+	var replayed bool
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		id, replayed, err = s.idempotentUserID(ctx, tx, key)
+		if err != nil || replayed {
+			return err
+		}
+
+		newID, err := s.txStore(tx).createUser(ctx, "create user idempotent", u)
+		if err != nil {
+			return err
+		}
+		id = int(newID)
+
+		// Any row left for the key has expired, so it's replaced.
+		scope := s.idempotencyScope(key)
+		if _, err := tx.ExecContext(ctx, deleteIdempotencyKeyQuery(s.dialect), scope...); err != nil {
+			return fmt.Errorf("create user idempotent: %w", err)
+		}
+		_, err = tx.ExecContext(ctx, insertIdempotencyKeyQuery(s.dialect), append(scope, id, time.Now().UTC())...)
+		if err != nil {
+			return fmt.Errorf("create user idempotent: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		// A concurrent call with the same key makes this one fail with a
+		// unique violation, either on the user or on the key, once its
+		// transaction commits. The user it created is returned instead.
+		if _, ok := uniqueViolationDetail(err); !ok {
+			return nil, err
+		}
+		var found bool
+		var lookupErr error
+		id, found, lookupErr = s.idempotentUserID(ctx, s.querier(ctx), key)
+		if lookupErr != nil || !found {
+			return nil, err
+		}
+		replayed = true
+	}
+
+	if !replayed {
+		return u, s.runHooks(ctx, hookCreate, u)
+	}
+	created, err = s.getUserByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("create user idempotent: %w", err)
+	}
+	s.redact(created)
+	return created, nil
+}
+
+// idempotentUserID returns the id of the user created for key, using q,
+// if key was recorded within the idempotency window.
+func (s *Store) idempotentUserID(ctx context.Context, q querier, key string) (id int, found bool, err error) {
+	var createdAt time.Time
+	err = q.QueryRowContext(ctx, selectIdempotencyKeyQuery(s.dialect), s.idempotencyScope(key)...).Scan(&id, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("create user idempotent: %w", err)
+	}
+	if time.Since(createdAt) >= s.idempotencyWindow() {
+		return 0, false, nil
+	}
+	return id, true, nil
+}
+
+// idempotencyScope returns the arguments that identify key in the
+// idempotency_keys table: s's table, its tenant and key itself.
+func (s *Store) idempotencyScope(key string) []interface{} {
+	return []interface{}{s.table().name, s.tenantID, key}
+}
@@ -0,0 +1,66 @@
+package users_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+func TestCreateUserIdempotent(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+
+	first, err := s.CreateUserIdempotent(ctx, "key", &users.User{Username: "alice", Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := s.CreateUserIdempotent(ctx, "key", &users.User{Username: "alice", Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Id != first.Id {
+		t.Errorf("retry returned user %d, want %d", again.Id, first.Id)
+	}
+
+	// A new key creates another user, so the taken username is reported.
+	_, err = s.CreateUserIdempotent(ctx, "other", &users.User{Username: "alice", Password: "password123"})
+	if !errors.Is(err, users.ErrDuplicateUsername) {
+		t.Errorf("new key: err = %v, want ErrDuplicateUsername", err)
+	}
+
+	_, err = s.CreateUserIdempotent(ctx, "", &users.User{Username: "bob", Password: "password123"})
+	if !errors.Is(err, users.ErrEmptyIdempotencyKey) {
+		t.Errorf("empty key: err = %v, want ErrEmptyIdempotencyKey", err)
+	}
+}
+
+func TestCreateUserIdempotentScopedToTenant(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+
+	a, err := s.ForTenant(1).CreateUserIdempotent(ctx, "key", &users.User{Username: "alice", Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tenant 2 using the same key must get a user of its own, rather
+	// than tenant 1's.
+	b, err := s.ForTenant(2).CreateUserIdempotent(ctx, "key", &users.User{Username: "bob", Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Id == a.Id || b.Username != "bob" {
+		t.Errorf("tenant 2 got user %d %q, which tenant 1 created", b.Id, b.Username)
+	}
+
+	again, err := s.ForTenant(1).CreateUserIdempotent(ctx, "key", &users.User{Username: "alice", Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Id != a.Id {
+		t.Errorf("tenant 1 retry returned user %d, want %d", again.Id, a.Id)
+	}
+}
@@ -0,0 +1,137 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// An op tracks a single call of one of a Store's methods, so that every
+// method is instrumented the same way.
+type op struct {
+	s     *Store
+	name  string // the method's name, such as "GetUserByID"
+	start time.Time
+	span  trace.Span // nil if the store has no Tracer
+	m     *metrics   // nil if the store has no metrics
+
+	cancel context.CancelFunc // cancels the call's timeouts
+	conn   *sql.Conn          // the connection reserved for the call, if any
+
+	// logger is told about the call if it takes longer than slow.
+	logger Logger
+	slow   time.Duration
+	ctx    context.Context
+
+	slog *slog.Logger // nil if the store has no slog logger
+}
+
+// startOp starts tracking a call of the method called name. The returned
+// context should be used for the rest of the call, and the op's end
+// method must be called once the call is done. It returns ErrStoreClosed
+// instead if s has been shut down, ErrInvalidTableName if s has an
+// invalid TableName, ErrTenantRequired if s requires a tenant but isn't
+// scoped to one, ErrCircuitOpen if s's circuit breaker is open, and
+// ErrPoolExhausted if s has an AcquireTimeout and no connection became
+// free in time.
+func (s *Store) startOp(ctx context.Context, name string) (context.Context, *op, error) {
+	if err := s.checkTable(); err != nil {
+		return ctx, nil, err
+	}
+	if s.RequireTenant && !s.hasTenant {
+		return ctx, nil, ErrTenantRequired
+	}
+	if err := s.acquire(ctx); err != nil {
+		return ctx, nil, err
+	}
+	_, hasDeadline := ctx.Deadline()
+	o := &op{s: s, name: name, start: time.Now(), m: s.metrics, slog: s.slog}
+	ctx, cancelDefault := s.withDefaultTimeout(ctx)
+	ctx, cancelOp := s.withOpTimeout(ctx, name)
+	o.cancel = func() {
+		cancelOp()
+		cancelDefault()
+	}
+	if s.breaker != nil {
+		if err := s.breaker.allow(ctx, s.root().db); err != nil {
+			o.cancel()
+			s.release()
+			return ctx, nil, err
+		}
+	}
+	if !hasDeadline {
+		var err error
+		ctx, o.conn, err = s.reserveConn(ctx)
+		if err != nil {
+			o.cancel()
+			s.release()
+			return ctx, nil, err
+		}
+	}
+	if s.Logger != nil {
+		o.logger, o.slow = s.Logger, s.SlowThreshold
+	}
+	if s.Tracer != nil {
+		attrs := []attribute.KeyValue{attribute.String("db.operation", name)}
+		if id := requestIDFromContext(ctx); id != "" {
+			attrs = append(attrs, attribute.String("request.id", id))
+		}
+		ctx, o.span = s.Tracer.Start(ctx, "Store."+name,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attrs...),
+		)
+	}
+	o.ctx = ctx
+	return ctx, o, nil
+}
+
+// end finishes tracking o. rows is the number of rows the call read or
+// wrote, which is ignored if err is not nil.
+func (o *op) end(err error, rows int) {
+	dur := time.Since(o.start)
+	if o.m != nil {
+		o.m.observe(o.name, dur.Seconds(), err != nil)
+	}
+	if o.s.breaker != nil {
+		o.s.breaker.record(err)
+	}
+	if o.logger != nil && dur > o.slow {
+		o.logger.Log(o.ctx, o.name, dur, err)
+	}
+	if o.slog != nil {
+		logOp(o.ctx, o.slog, o.name, dur, rows, err)
+	}
+	if o.span != nil {
+		if err != nil {
+			o.span.RecordError(err)
+			o.span.SetStatus(codes.Error, err.Error())
+		} else {
+			o.span.SetAttributes(attribute.Int("db.rows", rows))
+		}
+		o.span.End()
+	}
+	if o.conn != nil {
+		o.conn.Close()
+	}
+	o.cancel()
+	o.s.release()
+}
+
+// withDefaultTimeout returns a copy of ctx that times out after
+// s.DefaultTimeout, unless s.DefaultTimeout isn't set or ctx already has
+// a deadline, in which case ctx is returned as is. The returned cancel
+// function must be called once ctx is no longer needed.
+func (s *Store) withDefaultTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.DefaultTimeout <= 0 {
+		return ctx, func() {}
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, s.DefaultTimeout)
+}
@@ -0,0 +1,95 @@
+package users_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+// A recordingTracer records the spans it starts.
+type recordingTracer struct {
+	noop.Tracer
+
+	mu    sync.Mutex
+	spans []*recordingSpan
+}
+
+func (tr *recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	cfg := trace.NewSpanStartConfig(opts...)
+	span := &recordingSpan{name: name, kind: cfg.SpanKind(), attrs: make(map[attribute.Key]attribute.Value)}
+	span.SetAttributes(cfg.Attributes()...)
+
+	tr.mu.Lock()
+	tr.spans = append(tr.spans, span)
+	tr.mu.Unlock()
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+// A recordingSpan is a span started by a recordingTracer.
+type recordingSpan struct {
+	noop.Span
+
+	name   string
+	kind   trace.SpanKind
+	attrs  map[attribute.Key]attribute.Value
+	status codes.Code
+	err    error
+	ended  bool
+}
+
+func (s *recordingSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, a := range kv {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *recordingSpan) SetStatus(code codes.Code, _ string) { s.status = code }
+
+func (s *recordingSpan) RecordError(err error, _ ...trace.EventOption) { s.err = err }
+
+func (s *recordingSpan) End(...trace.SpanEndOption) { s.ended = true }
+
+func TestTracing(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	tr := &recordingTracer{}
+	s.Tracer = tr
+	ctx := context.Background()
+
+	ids := createUsers(t, s, "alice")
+	if _, err := s.GetUserByID(ctx, ids[0]+1); !errors.Is(err, users.ErrUserNotFound) {
+		t.Fatalf("err = %v, want ErrUserNotFound", err)
+	}
+
+	if len(tr.spans) != 2 {
+		t.Fatalf("started %d spans, want 2", len(tr.spans))
+	}
+	created, failed := tr.spans[0], tr.spans[1]
+	if created.name != "Store.CreateUser" || created.kind != trace.SpanKindClient || !created.ended {
+		t.Errorf("span %q, kind %v, ended %v; want an ended client span Store.CreateUser", created.name, created.kind, created.ended)
+	}
+	if op := created.attrs["db.operation"].AsString(); op != "CreateUser" {
+		t.Errorf("db.operation = %q, want CreateUser", op)
+	}
+	if rows := created.attrs["db.rows"].AsInt64(); rows != 1 || created.status == codes.Error {
+		t.Errorf("CreateUser span has db.rows %d and status %v", rows, created.status)
+	}
+
+	if failed.name != "Store.GetUserByID" || !failed.ended {
+		t.Errorf("span %q, ended %v; want an ended span Store.GetUserByID", failed.name, failed.ended)
+	}
+	if failed.status != codes.Error || !errors.Is(failed.err, users.ErrUserNotFound) {
+		t.Errorf("GetUserByID span has status %v and error %v, want the lookup's error", failed.status, failed.err)
+	}
+	if _, ok := failed.attrs["db.rows"]; ok {
+		t.Error("failed span has db.rows")
+	}
+}
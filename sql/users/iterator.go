@@ -0,0 +1,103 @@
+package users
+
+import "context"
+
+// A UserIterator goes through every user, in order of id, a page at a
+// time, as returned by Iterate. Its Next method advances it to the next
+// user, which its User method returns:
+//
+//	it := s.Iterate(ctx, 500)
+//	for it.Next() {
+//		u := it.User()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+//
+// A UserIterator must not be used by more than one goroutine at a time.
+type UserIterator struct {
+	s        *Store
+	ctx      context.Context
+	pageSize int
+
+	page   []*User
+	i      int // the index in page of the current user
+	lastID int // the id of the last user read
+	done   bool
+	err    error
+}
+
+// Iterate returns a UserIterator over every user, which reads pageSize
+// users at a time with ListUsersAfter, so that only one page is ever held
+// in memory. If pageSize is not positive, defaultListLimit is used
+// instead. The iterator stops once ctx is done, and its Err method then
+// returns ctx's error.
+//
+// Like ListUsersAfter, the iterator doesn't skip or repeat users when
+// users are created or deleted as it goes, though users created after it
+// has gone past their id aren't seen.
+func (s *Store) Iterate(ctx context.Context, pageSize int) *UserIterator {
+	if pageSize <= 0 {
+		pageSize = defaultListLimit
+	}
+	return &UserIterator{s: s, ctx: ctx, pageSize: pageSize, i: -1}
+}
+
+// Next advances it to the next user, reading the next page of users if
+// it has gone through the current one. It reports whether there is a
+// next user, and returns false once every user has been read, ctx is
+// done or an error occurs, after which Err should be checked.
+func (it *UserIterator) Next() bool {
+	if it.done {
+		return false
+	}
+	if err := it.ctx.Err(); err != nil {
+		it.stop(err)
+		return false
+	}
+
+	it.i++
+	if it.i < len(it.page) {
+		return true
+	}
+	// A short page means there are no more users, so there's no need to
+	// ask for another.
+	if it.page != nil && len(it.page) < it.pageSize {
+		it.stop(nil)
+		return false
+	}
+
+	page, lastID, err := it.s.ListUsersAfter(it.ctx, it.lastID, it.pageSize)
+	if err != nil {
+		it.stop(err)
+		return false
+	}
+	if len(page) == 0 {
+		it.stop(nil)
+		return false
+	}
+	it.page, it.i, it.lastID = page, 0, lastID
+	return true
+}
+
+// stop ends the iteration with err, which is nil if every user was read.
+func (it *UserIterator) stop(err error) {
+	it.done, it.err = true, err
+	it.page, it.i = nil, -1
+}
+
+// User returns the user that Next advanced it to, or nil if Next hasn't
+// been called or returned false.
+func (it *UserIterator) User() *User {
+	if it.i < 0 || it.i >= len(it.page) {
+		return nil
+	}
+	return it.page[it.i]
+}
+
+// Err returns the error that stopped it, if any. It returns nil if it
+// stopped because every user had been read.
+func (it *UserIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,143 @@
+package users
+
+import (
+	"context"
+	"fmt"
+)
+
+// defaultListLimit is the page size ListUsers uses when it's given a
+// non-positive limit, so a missing limit can't load a huge table.
+const defaultListLimit = 50
+
+// A SortField is a field that users can be listed in the order of.
+type SortField int
+
+const (
+	SortByID SortField = iota
+	SortByUsername
+	SortByCreatedAt
+)
+
+// A SortOrder is the direction users are sorted in.
+type SortOrder int
+
+const (
+	Asc SortOrder = iota
+	Desc
+)
+
+// sortColumns and sortDirections map the sort options to the SQL used for
+// them. Only the SQL in these allow-lists is ever put into an order by
+// clause, so sort options can't be used to inject SQL.
+var (
+	sortColumns = map[SortField]string{
+		SortByID:        "id",
+		SortByUsername:  "username",
+		SortByCreatedAt: "created_at",
+	}
+	sortDirections = map[SortOrder]string{
+		Asc:  "asc",
+		Desc: "desc",
+	}
+)
+
+// ListOptions describe which page of users ListUsers returns and how
+// they're ordered. The zero value returns the first defaultListLimit
+// users ordered by id.
+type ListOptions struct {
+	Limit  int // non-positive uses defaultListLimit
+	Offset int
+	SortBy SortField
+	Order  SortOrder
+
+	// Filter, if set, limits the users to those matching its conditions.
+	// Its ordering and limit are ignored in favour of the fields above.
+	Filter *Builder
+
+	// Columns, if set, are the only columns that are read, such as id and
+	// username, which saves reading ones that aren't needed. The fields
+	// of the other columns are left at their zero values. Any of the
+	// columns of the users table can be used.
+	Columns []string
+}
+
+// validate checks that opts' sort options are known.
+func (opts ListOptions) validate() error {
+	if _, ok := sortColumns[opts.SortBy]; !ok {
+		return fmt.Errorf("unknown sort field %d", opts.SortBy)
+	}
+	if _, ok := sortDirections[opts.Order]; !ok {
+		return fmt.Errorf("unknown sort order %d", opts.Order)
+	}
+	for _, col := range opts.Columns {
+		if _, ok := userFields[col]; !ok {
+			return fmt.Errorf("unknown column %q", col)
+		}
+	}
+	if opts.Filter != nil {
+		return opts.Filter.Err()
+	}
+	return nil
+}
+
+// columns returns the columns read for opts.
+func (opts ListOptions) columns() []string {
+	if len(opts.Columns) == 0 {
+		return userColumnNames
+	}
+	return opts.Columns
+}
+
+// limit returns opts.Limit, or defaultListLimit if it's not positive.
+func (opts ListOptions) limit() int {
+	if opts.Limit <= 0 {
+		return defaultListLimit
+	}
+	return opts.Limit
+}
+
+// orderBy returns the order by clause, without the "order by", for opts.
+// Rows with equal sort values are ordered by id, so that pages are stable.
+func (opts ListOptions) orderBy() string {
+	col, dir := sortColumns[opts.SortBy], sortDirections[opts.Order]
+	if opts.SortBy == SortByID {
+		return col + " " + dir
+	}
+	return col + " " + dir + ", id " + dir
+}
+
+// ListUsersAfter returns up to limit users with ids greater than afterID,
+// ordered by id, along with the id of the last user returned. Passing
+// that id back in as afterID returns the next page, and 0 returns the
+// first page. Once there are no more users, the returned users are empty
+// and the returned id is afterID. If limit is not positive,
+// defaultListLimit is used instead.
+//
+// Unlike ListUsers, which skips over Offset rows for every page, this
+// keyset pagination jumps straight to the page using the primary key, so
+// it stays fast however deep the page is. Pages also don't skip or repeat
+// users when users are created or deleted between requests. Prefer it
+// for paging through many users, such as in exports or infinite scrolls,
+// and ListUsers when pages must be sorted by other fields or jumped to
+// by number.
+func (s *Store) ListUsersAfter(ctx context.Context, afterID int, limit int) (users []*User, lastID int, err error) {
+	ctx, op, err := s.startOp(ctx, "ListUsersAfter")
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { op.end(err, len(users)) }()
+
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	users, err = s.queryUsers(ctx, listUsersAfterQuery(s.dialect, s.table()), afterID, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list users after: %w", err)
+	}
+
+	lastID = afterID
+	if len(users) > 0 {
+		lastID = users[len(users)-1].Id
+	}
+	return users, lastID, nil
+}
@@ -0,0 +1,158 @@
+package users_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+// usernames returns the usernames of list separated by spaces.
+func usernames(list []*users.User) string {
+	var s string
+	for i, u := range list {
+		if i > 0 {
+			s += " "
+		}
+		s += u.Username
+	}
+	return s
+}
+
+// newListStore returns a test store with the users carol, alice, bob,
+// dave and erin, created in that order, of whom erin is deleted.
+func newListStore(t *testing.T) *users.Store {
+	s := dbtest.NewTestStore(t)
+	ids := createUsers(t, s, "carol", "alice", "bob", "dave", "erin")
+	if err := s.DeleteUser(context.Background(), ids[4]); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestListUsers(t *testing.T) {
+	s := newListStore(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		opts users.ListOptions
+		want string
+	}{
+		{users.ListOptions{}, "carol alice bob dave"},
+		{users.ListOptions{Limit: 2}, "carol alice"},
+		{users.ListOptions{Limit: 2, Offset: 3}, "dave"},
+		{users.ListOptions{Offset: 10}, ""},
+		{users.ListOptions{SortBy: users.SortByUsername}, "alice bob carol dave"},
+		{users.ListOptions{SortBy: users.SortByUsername, Order: users.Desc, Limit: 3}, "dave carol bob"},
+		{users.ListOptions{Filter: users.NewBuilder(users.SQLite).Where("username", ">=", "bob")}, "carol bob dave"},
+	}
+	for _, tt := range tests {
+		list, err := s.ListUsers(ctx, tt.opts)
+		if err != nil {
+			t.Errorf("ListUsers(%+v): %v", tt.opts, err)
+			continue
+		}
+		if got := usernames(list); got != tt.want {
+			t.Errorf("ListUsers(%+v) = %q, want %q", tt.opts, got, tt.want)
+		}
+	}
+
+	for _, opts := range []users.ListOptions{
+		{SortBy: 99},
+		{Order: 99},
+		{Columns: []string{"id", "secret"}},
+		{Filter: users.NewBuilder(users.SQLite).Where("password", "=", "x")},
+	} {
+		if _, err := s.ListUsers(ctx, opts); err == nil {
+			t.Errorf("ListUsers(%+v) didn't fail", opts)
+		}
+	}
+}
+
+func TestListUsersColumns(t *testing.T) {
+	s := newListStore(t)
+	ctx := context.Background()
+
+	list, err := s.ListUsers(ctx, users.ListOptions{Columns: []string{"id", "username"}, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := list[0]
+	if u.Id == 0 || u.Username != "carol" {
+		t.Errorf("selected columns weren't read: %+v", u)
+	}
+	if u.Password != "" || u.Role != "" || !u.CreatedAt.IsZero() {
+		t.Errorf("unselected columns were read: %+v", u)
+	}
+}
+
+func TestListUsersAfter(t *testing.T) {
+	s := newListStore(t)
+	ctx := context.Background()
+
+	var all []*users.User
+	lastID := 0
+	for {
+		page, next, err := s.ListUsersAfter(ctx, lastID, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) == 0 {
+			if next != lastID {
+				t.Errorf("empty page returned id %d, want %d", next, lastID)
+			}
+			break
+		}
+		all = append(all, page...)
+		lastID = next
+	}
+	if got := usernames(all); got != "carol alice bob dave" {
+		t.Errorf("pages = %q, want %q", got, "carol alice bob dave")
+	}
+}
+
+func TestIterate(t *testing.T) {
+	s := newListStore(t)
+	ctx := context.Background()
+
+	var all []*users.User
+	it := s.Iterate(ctx, 2)
+	for it.Next() {
+		all = append(all, it.User())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if got := usernames(all); got != "carol alice bob dave" {
+		t.Errorf("iterated over %q, want %q", got, "carol alice bob dave")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	it = s.Iterate(ctx, 2)
+	if it.Next() {
+		t.Error("Next = true with a cancelled context")
+	}
+	if !errors.Is(it.Err(), context.Canceled) {
+		t.Errorf("Err = %v, want context.Canceled", it.Err())
+	}
+}
+
+func TestStreamUsers(t *testing.T) {
+	s := newListStore(t)
+	ctx := context.Background()
+
+	var all []*users.User
+	usersc, errc := s.StreamUsers(ctx)
+	for u := range usersc {
+		all = append(all, u)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if got := usernames(all); got != "carol alice bob dave" {
+		t.Errorf("streamed %q, want %q", got, "carol alice bob dave")
+	}
+}
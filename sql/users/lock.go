@@ -0,0 +1,91 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrTxRequired is returned by GetUserForUpdate when it's called without
+// a transaction, in which the row lock would be released straight away.
+var ErrTxRequired = errors.New("a transaction is required")
+
+// ErrUserLocked is returned by GetUserForUpdateSkipLocked when the user's
+// row is locked by another transaction.
+var ErrUserLocked = errors.New("user is locked by another transaction")
+
+// GetUserForUpdate returns the user with the given id like GetUserByID,
+// but reads it in tx with select ... for update, which locks the user's
+// row until tx is committed or rolled back. Other transactions that try
+// to lock or change the row wait until then, so the user can safely be
+// read, changed and written back within tx. It returns ErrUserNotFound if
+// no such user exists.
+//
+// tx can be nil for a store passed to the function given to WithinTx,
+// which uses the store's transaction. Otherwise ErrTxRequired is returned.
+//
+// SQLite doesn't have row locks, and only locks the database once a
+// transaction writes to it, so to serialize read-modify-write cycles
+// there, tx should be started with BEGIN IMMEDIATE, such as by adding
+// _txlock=immediate to the DSN.
+func (s *Store) GetUserForUpdate(ctx context.Context, tx *sql.Tx, id int) (u *User, err error) {
+	ctx, op, err := s.startOp(ctx, "GetUserForUpdate")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { op.end(err, 1) }()
+
+	return s.getUserForUpdate(ctx, "get user for update", tx, id, false)
+}
+
+// GetUserForUpdateSkipLocked is like GetUserForUpdate, but instead of
+// waiting for another transaction that has locked the user's row, it
+// returns ErrUserLocked straight away, using select ... for update skip
+// locked. This lets several workers each claim a different user without
+// queueing up behind one another. On SQLite, which has no row locks, it's
+// the same as GetUserForUpdate.
+func (s *Store) GetUserForUpdateSkipLocked(ctx context.Context, tx *sql.Tx, id int) (u *User, err error) {
+	ctx, op, err := s.startOp(ctx, "GetUserForUpdateSkipLocked")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { op.end(err, 1) }()
+
+	return s.getUserForUpdate(ctx, "get user for update skip locked", tx, id, true)
+}
+
+// getUserForUpdate reads and locks the user with the given id for
+// GetUserForUpdate and GetUserForUpdateSkipLocked. Errors are prefixed
+// with op.
+func (s *Store) getUserForUpdate(ctx context.Context, op string, tx *sql.Tx, id int, skipLocked bool) (*User, error) {
+	if tx == nil {
+		tx = s.tx
+	}
+	if tx == nil {
+		return nil, fmt.Errorf("%s: %w", op, ErrTxRequired)
+	}
+
+	query := selectUserForUpdateQuery(s.dialect, s.table(), skipLocked)
+	u, err := scanUser(tx.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		if !skipLocked {
+			return nil, ErrUserNotFound
+		}
+		// A skipped row looks just like a missing one, so a plain read,
+		// which doesn't wait for locks, tells them apart.
+		var n int
+		if err := tx.QueryRowContext(ctx, countUserByIDQuery(s.dialect, s.table(), false), id).Scan(&n); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if n > 0 {
+			return nil, ErrUserLocked
+		}
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	s.redact(u)
+	return u, nil
+}
@@ -0,0 +1,49 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrAccountLocked is returned by Authenticate for users whose account is
+// locked after too many failed logins.
+var ErrAccountLocked = errors.New("account is locked")
+
+// defaultLockoutDuration is how long accounts are locked for when a
+// Store's LockoutDuration isn't set.
+const defaultLockoutDuration = 15 * time.Minute
+
+// lockoutDuration returns s.LockoutDuration, or defaultLockoutDuration if
+// it isn't set.
+func (s *Store) lockoutDuration() time.Duration {
+	if s.LockoutDuration <= 0 {
+		return defaultLockoutDuration
+	}
+	return s.LockoutDuration
+}
+
+// recordFailedLogin counts a failed login of the user with the given id,
+// locking its account until now plus the lockout duration if that makes
+// s.MaxFailedLogins failed logins in a row.
+func (s *Store) recordFailedLogin(ctx context.Context, id int, now time.Time) error {
+	lockedUntil := now.Add(s.lockoutDuration())
+	_, err := s.execRetry(ctx, failedLoginQuery(s.dialect, s.table()), s.MaxFailedLogins, lockedUntil, s.MaxFailedLogins, id)
+	s.invalidate(id)
+	if err != nil {
+		return fmt.Errorf("record failed login: %w", err)
+	}
+	return nil
+}
+
+// resetFailedLogins clears the failed login count and any lock of the
+// user with the given id.
+func (s *Store) resetFailedLogins(ctx context.Context, id int) error {
+	_, err := s.execRetry(ctx, resetFailedLoginsQuery(s.dialect, s.table()), id)
+	s.invalidate(id)
+	if err != nil {
+		return fmt.Errorf("reset failed logins: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package users
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// A Logger is told about calls of a Store's methods that take longer than
+// the store's SlowThreshold.
+type Logger interface {
+	// Log is called once a slow call of the method called op is done. dur
+	// is how long the call took and err is the error it returned, if any.
+	// ctx is the context the method was called with.
+	Log(ctx context.Context, op string, dur time.Duration, err error)
+}
+
+// A StdLogger is a Logger that writes slow calls to a *log.Logger, or to
+// the standard logger if L is nil. Each line includes the request id set
+// on the call's context with ContextWithRequestID, which is empty if
+// there isn't one.
+type StdLogger struct {
+	L *log.Logger
+}
+
+// Log implements Logger.
+func (l StdLogger) Log(ctx context.Context, op string, dur time.Duration, err error) {
+	printf := log.Printf
+	if l.L != nil {
+		printf = l.L.Printf
+	}
+	printf("slow query: op=%s duration=%s request_id=%q err=%v", op, dur, requestIDFromContext(ctx), err)
+}
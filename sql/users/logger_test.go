@@ -0,0 +1,73 @@
+package users_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+// A recordingLogger records the calls it's told about.
+type recordingLogger struct {
+	mu    sync.Mutex
+	calls []loggedCall
+}
+
+// A loggedCall is a call told to a recordingLogger.
+type loggedCall struct {
+	ctx context.Context
+	op  string
+	err error
+}
+
+func (l *recordingLogger) Log(ctx context.Context, op string, dur time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls = append(l.calls, loggedCall{ctx, op, err})
+}
+
+func TestSlowQueryLogger(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	l := &recordingLogger{}
+	s.Logger = l
+	ctx := context.Background()
+
+	// Every call takes longer than no time at all.
+	ids := createUsers(t, s, "alice")
+	if _, err := s.GetUserByID(ctx, ids[0]+1); !errors.Is(err, users.ErrUserNotFound) {
+		t.Fatalf("err = %v, want ErrUserNotFound", err)
+	}
+	if len(l.calls) != 2 || l.calls[0].op != "CreateUser" || l.calls[1].op != "GetUserByID" {
+		t.Fatalf("logged %v, want CreateUser and GetUserByID", l.calls)
+	}
+	if l.calls[0].err != nil || !errors.Is(l.calls[1].err, users.ErrUserNotFound) {
+		t.Errorf("logged errors %v and %v, want nil and ErrUserNotFound", l.calls[0].err, l.calls[1].err)
+	}
+
+	// No call takes an hour.
+	s.SlowThreshold = time.Hour
+	if _, err := s.GetUserByID(ctx, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if len(l.calls) != 2 {
+		t.Errorf("logged %d calls, want the fast call not to be logged", len(l.calls)-2)
+	}
+}
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := users.StdLogger{L: log.New(&buf, "", 0)}
+
+	l.Log(context.Background(), "GetUserByID", 2*time.Second, users.ErrUserNotFound)
+	const want = `slow query: op=GetUserByID duration=2s request_id="" err=user not found`
+	if got := strings.TrimSpace(buf.String()); got != want {
+		t.Errorf("logged %q, want %q", got, want)
+	}
+}
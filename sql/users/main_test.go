@@ -0,0 +1,22 @@
+package users_test
+
+import (
+	"os"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+func TestMain(m *testing.M) {
+	// The tests hash a lot of passwords, which the default cost makes
+	// slow for no benefit.
+	users.BcryptCost = bcrypt.MinCost
+	os.Exit(m.Run())
+}
+
+// strptr returns a pointer to s, for setting User.Email.
+func strptr(s string) *string {
+	return &s
+}
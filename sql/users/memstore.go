@@ -0,0 +1,356 @@
+package users
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A MemStore is a UserStore that keeps users in memory. It behaves like a
+// Store, including soft deleting users and reporting duplicate usernames
+// and emails, which makes it useful as a stand-in for a Store in tests.
+// Users are copied on the way in and out, so changing a user passed to
+// or returned by a MemStore doesn't change the stored user.
+//
+// The zero value is an empty MemStore ready to use.
+type MemStore struct {
+	mu     sync.Mutex
+	users  map[int]*memUser
+	lastID int
+}
+
+// A memUser is a user stored in a MemStore.
+type memUser struct {
+	User
+	deleted bool
+}
+
+// CreateUser stores a copy of u, like Store.CreateUser.
+func (m *MemStore) CreateUser(ctx context.Context, u *User) (int64, error) {
+	u.normalize()
+	if err := u.Validate(); err != nil {
+		return 0, fmt.Errorf("create user: %w", err)
+	}
+	hash, err := HashPassword(u.Password)
+	if err != nil {
+		return 0, fmt.Errorf("create user: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkUnique(u, 0); err != nil {
+		return 0, fmt.Errorf("create user: %w", err)
+	}
+
+	if m.users == nil {
+		m.users = make(map[int]*memUser)
+	}
+	m.lastID++
+	now := time.Now().UTC()
+
+	u.Id = m.lastID
+	u.Password = hash
+	u.CreatedAt = now
+	u.UpdatedAt = now
+	u.Version = 1
+	m.users[u.Id] = &memUser{User: *copyUser(u)}
+
+	return int64(u.Id), nil
+}
+
+// GetUserByID returns a copy of the user with the given id, like
+// Store.GetUserByID.
+func (m *MemStore) GetUserByID(ctx context.Context, id int) (*User, error) {
+	return m.find(func(u *User) bool { return u.Id == id })
+}
+
+// GetUserByUsername returns a copy of the user with the given username,
+// like Store.GetUserByUsername.
+func (m *MemStore) GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	return m.find(func(u *User) bool { return u.Username == username })
+}
+
+// GetUserByEmail returns a copy of the user with the given email, like
+// Store.GetUserByEmail.
+func (m *MemStore) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	email = normalizeEmail(email)
+	if email == "" {
+		return nil, fmt.Errorf("get user by email: %w", ErrEmptyEmail)
+	}
+	return m.find(func(u *User) bool { return u.Email != nil && *u.Email == email })
+}
+
+// UpdateUser saves a copy of u, like Store.UpdateUser.
+func (m *MemStore) UpdateUser(ctx context.Context, u *User) error {
+	if u.Id == 0 {
+		return fmt.Errorf("update user: %w", ErrMissingUserID)
+	}
+	u.normalize()
+	if err := u.validate(false); err != nil {
+		return fmt.Errorf("update user: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.users[u.Id]
+	if !ok || stored.deleted {
+		return ErrUserNotFound
+	}
+	if u.Version != stored.Version {
+		return fmt.Errorf("update user: %w", ErrVersionConflict)
+	}
+	if err := m.checkUnique(u, u.Id); err != nil {
+		return fmt.Errorf("update user: %w", err)
+	}
+
+	u.CreatedAt = stored.CreatedAt
+	u.UpdatedAt = time.Now().UTC()
+	u.Version++
+	password := stored.Password
+	stored.User = *copyUser(u)
+	if u.Password == "" {
+		stored.Password = password
+	}
+
+	return nil
+}
+
+// DeleteUser soft deletes the user with the given id, like
+// Store.DeleteUser.
+func (m *MemStore) DeleteUser(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.users[id]
+	if !ok || stored.deleted {
+		return ErrUserNotFound
+	}
+	stored.deleted = true
+
+	return nil
+}
+
+// ListUsers returns copies of a page of users, like Store.ListUsers,
+// including applying opts.Filter and opts.Columns. Like patterns in the
+// filter match case-sensitively, as they do in Postgres.
+func (m *MemStore) ListUsers(ctx context.Context, opts ListOptions) ([]*User, error) {
+	if err := opts.validate(); err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+
+	m.mu.Lock()
+	var users []*User
+	for _, stored := range m.users {
+		if stored.deleted {
+			continue
+		}
+		if opts.Filter != nil {
+			ok, err := matchFilter(opts.Filter, &stored.User)
+			if err != nil {
+				m.mu.Unlock()
+				return nil, fmt.Errorf("list users: %w", err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		users = append(users, copyUser(&stored.User))
+	}
+	m.mu.Unlock()
+
+	sort.Slice(users, func(i, j int) bool {
+		a, b := users[i], users[j]
+		if opts.Order == Desc {
+			a, b = b, a
+		}
+		switch opts.SortBy {
+		case SortByUsername:
+			if c := strings.Compare(a.Username, b.Username); c != 0 {
+				return c < 0
+			}
+		case SortByCreatedAt:
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.Before(b.CreatedAt)
+			}
+		}
+		return a.Id < b.Id
+	})
+
+	if opts.Offset >= len(users) {
+		return nil, nil
+	}
+	users = users[opts.Offset:]
+	if limit := opts.limit(); len(users) > limit {
+		users = users[:limit]
+	}
+	if len(opts.Columns) > 0 {
+		for i, u := range users {
+			users[i] = selectColumns(u, opts.Columns)
+		}
+	}
+	return users, nil
+}
+
+// find returns a copy of the first user that isn't deleted and matches
+// match, or ErrUserNotFound if there isn't one.
+func (m *MemStore) find(match func(u *User) bool) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.users {
+		if !stored.deleted && match(&stored.User) {
+			return copyUser(&stored.User), nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+// checkUnique returns ErrDuplicateUsername or ErrDuplicateEmail if a user
+// other than the one with id skip already has u's username or email. Like
+// the unique constraints in the database, deleted users are included.
+// m.mu must be held.
+func (m *MemStore) checkUnique(u *User, skip int) error {
+	for id, stored := range m.users {
+		if id == skip {
+			continue
+		}
+		if stored.Username == u.Username {
+			return ErrDuplicateUsername
+		}
+		if stored.Email != nil && u.Email != nil && *stored.Email == *u.Email {
+			return ErrDuplicateEmail
+		}
+	}
+	return nil
+}
+
+// selectColumns returns a User with only the fields of u's that are read
+// from the given columns, like a Store reading just those columns.
+func selectColumns(u *User, columns []string) *User {
+	src := reflect.ValueOf(u).Elem()
+	c := &User{}
+	dst := reflect.ValueOf(c).Elem()
+	for _, col := range columns {
+		index := userFields[col].index
+		dst.FieldByIndex(index).Set(src.FieldByIndex(index))
+	}
+	return c
+}
+
+// matchFilter reports whether u matches all of b's conditions. Like in
+// SQL, a condition on a null email never matches.
+func matchFilter(b *Builder, u *User) (bool, error) {
+	for _, c := range b.conds {
+		v := reflect.ValueOf(u).Elem().FieldByIndex(userFields[c.col].index)
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return false, nil
+			}
+			v = v.Elem()
+		}
+
+		if c.op == "like" {
+			pattern, ok := c.val.(string)
+			if !ok || v.Kind() != reflect.String {
+				return false, fmt.Errorf("%s like %v: like needs a string column and pattern", c.col, c.val)
+			}
+			if !likeRegexp(pattern).MatchString(v.String()) {
+				return false, nil
+			}
+			continue
+		}
+
+		cmp, err := compareField(v, c.val)
+		if err != nil {
+			return false, fmt.Errorf("%s %s %v: %w", c.col, c.op, c.val, err)
+		}
+		var ok bool
+		switch c.op {
+		case "=":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// compareField compares v, the value of one of a user's fields, with val,
+// returning -1, 0 or 1 as v is less than, equal to or greater than val.
+// val must be an integer for the id, a time.Time for the times and a
+// string for the rest.
+func compareField(v reflect.Value, val interface{}) (int, error) {
+	rv := reflect.ValueOf(val)
+	switch {
+	case v.Kind() == reflect.Int && rv.CanInt():
+		return compareOrdered(v.Int(), rv.Int()), nil
+	case v.Kind() == reflect.Int && rv.CanUint():
+		if rv.Uint() > math.MaxInt64 {
+			return -1, nil
+		}
+		return compareOrdered(v.Int(), int64(rv.Uint())), nil
+	case v.Kind() == reflect.String && rv.Kind() == reflect.String:
+		return strings.Compare(v.String(), rv.String()), nil
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		if tv, ok := val.(time.Time); ok {
+			return t.Compare(tv), nil
+		}
+	}
+	return 0, fmt.Errorf("can't compare %s with %T", v.Type(), val)
+}
+
+// compareOrdered compares a and b like strings.Compare.
+func compareOrdered(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// likeRegexp returns a regular expression that matches the same strings
+// as the like pattern, which uses likeEscape as its escape character.
+func likeRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?s)^")
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case string(r) == likeEscape:
+			escaped = true
+		case r == '%':
+			b.WriteString(".*")
+		case r == '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
@@ -0,0 +1,115 @@
+package users_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+func TestMemStore(t *testing.T) {
+	var m users.MemStore
+	ctx := context.Background()
+
+	u := &users.User{Username: "alice", Email: strptr("alice@example.com"), Password: "password123"}
+	id, err := m.CreateUser(ctx, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.CreateUser(ctx, &users.User{Username: "alice", Password: "password123"}); !errors.Is(err, users.ErrDuplicateUsername) {
+		t.Errorf("duplicate username: err = %v, want ErrDuplicateUsername", err)
+	}
+	if _, err := m.CreateUser(ctx, &users.User{Username: "bob", Email: strptr("ALICE@example.com"), Password: "password123"}); !errors.Is(err, users.ErrDuplicateEmail) {
+		t.Errorf("duplicate email: err = %v, want ErrDuplicateEmail", err)
+	}
+
+	got, err := m.GetUserByEmail(ctx, "Alice@Example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.Email = strptr("new@example.com")
+	got.Version = 2
+	if err := m.UpdateUser(ctx, got); !errors.Is(err, users.ErrVersionConflict) {
+		t.Errorf("stale version: err = %v, want ErrVersionConflict", err)
+	}
+	got.Version = 1
+	if err := m.UpdateUser(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.DeleteUser(ctx, int(id)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.GetUserByID(ctx, int(id)); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("deleted user: err = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestMemStoreCopiesUsers(t *testing.T) {
+	var m users.MemStore
+	ctx := context.Background()
+
+	u := &users.User{
+		Username: "alice",
+		Email:    strptr("alice@example.com"),
+		Password: "password123",
+		Metadata: map[string]interface{}{"plan": "free"},
+	}
+	id, err := m.CreateUser(ctx, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	*u.Email = "changed@example.com"
+	u.Metadata["plan"] = "changed"
+
+	got, err := m.GetUserByID(ctx, int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	*got.Email = "changed@example.com"
+	got.Metadata["plan"] = "changed"
+
+	list, err := m.ListUsers(ctx, users.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || *list[0].Email != "alice@example.com" || list[0].Metadata["plan"] != "free" {
+		t.Errorf("stored user was changed through a copy: %+v", list)
+	}
+}
+
+func TestMemStoreListUsers(t *testing.T) {
+	var m users.MemStore
+	ctx := context.Background()
+	for _, username := range []string{"carol", "alice", "bob", "alfred"} {
+		if _, err := m.CreateUser(ctx, &users.User{Username: username, Password: "password123"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := m.ListUsers(ctx, users.ListOptions{SortBy: users.SortByUsername, Limit: 2, Offset: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := usernames(list); got != "alice bob" {
+		t.Errorf("page = %q, want %q", got, "alice bob")
+	}
+
+	filter := users.NewBuilder(users.SQLite).Where("username", "like", "al%").Where("id", ">", 2)
+	list, err = m.ListUsers(ctx, users.ListOptions{Filter: filter, Columns: []string{"id", "username"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := usernames(list); got != "alfred" {
+		t.Errorf("filtered = %q, want %q", got, "alfred")
+	}
+	if list[0].Id != 4 || list[0].Password != "" || !list[0].CreatedAt.IsZero() {
+		t.Errorf("columns weren't applied: %+v", list[0])
+	}
+
+	filter = users.NewBuilder(users.SQLite).Where("id", "=", "one")
+	if _, err := m.ListUsers(ctx, users.ListOptions{Filter: filter}); err == nil {
+		t.Error("ListUsers accepted an id compared with a string")
+	}
+}
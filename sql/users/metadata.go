@@ -0,0 +1,44 @@
+package users
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// A jsonMap writes a map to a JSON column, for the metadata column of the
+// users table. A nil map is written as NULL. The column is read back by
+// the json option of User.Metadata's db tag.
+type jsonMap map[string]interface{}
+
+// Value implements driver.Valuer, encoding m as JSON.
+func (m jsonMap) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(map[string]interface{}(m))
+	if err != nil {
+		return nil, fmt.Errorf("encode metadata: %w", err)
+	}
+	return string(b), nil
+}
+
+// copyJSON returns a deep copy of v, a value decoded from JSON into an
+// interface{}, copying the maps and slices that it's made up of.
+func copyJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			c[k] = copyJSON(e)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, e := range v {
+			c[i] = copyJSON(e)
+		}
+		return c
+	}
+	return v
+}
@@ -0,0 +1,95 @@
+package users_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+func TestMetadata(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+
+	meta := map[string]interface{}{
+		"theme": "dark",
+		"beta":  true,
+		"tags":  []interface{}{"a", "b"},
+		"prefs": map[string]interface{}{"pageSize": float64(50)},
+	}
+	u := &users.User{Username: "alice", Password: "password123", Metadata: meta}
+	id, err := s.CreateUser(ctx, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob := createUsers(t, s, "bob")[0]
+
+	got, err := s.GetUserByID(ctx, int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Metadata, meta) {
+		t.Errorf("Metadata = %v, want %v", got.Metadata, meta)
+	}
+	if u, err := s.GetUserByID(ctx, bob); err != nil {
+		t.Fatal(err)
+	} else if u.Metadata == nil || len(u.Metadata) != 0 {
+		t.Errorf("user without metadata: Metadata = %#v, want an empty map", u.Metadata)
+	}
+
+	got.Metadata["theme"] = "light"
+	delete(got.Metadata, "tags")
+	if err := s.UpdateUser(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	got, err = s.GetUserByID(ctx, int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Metadata["theme"] != "light" || got.Metadata["tags"] != nil {
+		t.Errorf("UpdateUser didn't update Metadata: %v", got.Metadata)
+	}
+
+	got.Metadata = nil
+	if err := s.UpdateUser(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = s.GetUserByID(ctx, int(id)); err != nil {
+		t.Fatal(err)
+	} else if got.Metadata == nil || len(got.Metadata) != 0 {
+		t.Errorf("Metadata = %#v after clearing it, want an empty map", got.Metadata)
+	}
+}
+
+func TestMetadataCached(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	s.CacheTTL = time.Minute
+	ctx := context.Background()
+
+	u := &users.User{
+		Username: "alice",
+		Password: "password123",
+		Metadata: map[string]interface{}{"prefs": map[string]interface{}{"theme": "dark"}},
+	}
+	id, err := s.CreateUser(ctx, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changing the metadata of a returned user mustn't change the copy in
+	// the cache.
+	for i := 0; i < 2; i++ {
+		got, err := s.GetUserByID(ctx, int(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		prefs := got.Metadata["prefs"].(map[string]interface{})
+		if prefs["theme"] != "dark" {
+			t.Fatalf("read %d: theme = %v, want dark", i+1, prefs["theme"])
+		}
+		prefs["theme"] = "light"
+	}
+}
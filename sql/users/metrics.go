@@ -0,0 +1,52 @@
+package users
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// metrics holds the Prometheus collectors updated by a Store's methods.
+type metrics struct {
+	queries  *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		queries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "store_queries_total",
+			Help: "Total number of store operations, by operation.",
+		}, []string{"operation"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "store_query_errors_total",
+			Help: "Total number of store operations that failed, by operation.",
+		}, []string{"operation"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "store_query_duration_seconds",
+			Help:    "Duration of store operations in seconds, by operation.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"operation"}),
+	}
+}
+
+// WithMetrics registers collectors with reg that count the calls of s's
+// methods and the calls that fail, and time how long each call takes,
+// all labelled with the method's name. It returns s so that it can be
+// chained onto NewStore.
+//
+// WithMetrics panics if the collectors can't be registered, such as when
+// they've already been registered with reg by another store.
+func (s *Store) WithMetrics(reg prometheus.Registerer) *Store {
+	m := newMetrics()
+	reg.MustRegister(m.queries, m.errors, m.duration)
+	s.metrics = m
+	return s
+}
+
+// observe records a call of the operation called name that took seconds
+// to run and failed if failed is true.
+func (m *metrics) observe(name string, seconds float64, failed bool) {
+	m.queries.WithLabelValues(name).Inc()
+	if failed {
+		m.errors.WithLabelValues(name).Inc()
+	}
+	m.duration.WithLabelValues(name).Observe(seconds)
+}
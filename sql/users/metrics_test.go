@@ -0,0 +1,104 @@
+package users_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// counterValue returns the value of the counter called name in reg with
+// the given operation label, or 0 if there isn't one.
+func counterValue(t *testing.T, reg *prometheus.Registry, name, operation string) float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "operation" && l.GetValue() == operation {
+					return m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// histogramCount returns the number of observations of the histogram
+// called name in reg with the given operation label, or 0 if there isn't
+// one.
+func histogramCount(t *testing.T, reg *prometheus.Registry, name, operation string) uint64 {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "operation" && l.GetValue() == operation {
+					return m.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	s := dbtest.NewTestStore(t).WithMetrics(reg)
+	ctx := context.Background()
+
+	ids := createUsers(t, s, "alice", "bob")
+	if _, err := s.GetUserByID(ctx, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetUserByID(ctx, ids[1]+1); !errors.Is(err, users.ErrUserNotFound) {
+		t.Fatalf("err = %v, want ErrUserNotFound", err)
+	}
+
+	tests := []struct {
+		operation     string
+		calls, errors float64
+	}{
+		{"CreateUser", 2, 0},
+		{"GetUserByID", 2, 1},
+		{"DeleteUser", 0, 0},
+	}
+	for _, tt := range tests {
+		if got := counterValue(t, reg, "store_queries_total", tt.operation); got != tt.calls {
+			t.Errorf("%s: store_queries_total = %v, want %v", tt.operation, got, tt.calls)
+		}
+		if got := counterValue(t, reg, "store_query_errors_total", tt.operation); got != tt.errors {
+			t.Errorf("%s: store_query_errors_total = %v, want %v", tt.operation, got, tt.errors)
+		}
+		if got := histogramCount(t, reg, "store_query_duration_seconds", tt.operation); got != uint64(tt.calls) {
+			t.Errorf("%s: store_query_duration_seconds has %d observations, want %v", tt.operation, got, tt.calls)
+		}
+	}
+}
+
+func TestWithMetricsRegisteredTwice(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	dbtest.NewTestStore(t).WithMetrics(reg)
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a second store's metrics with the same registry didn't panic")
+		}
+	}()
+	dbtest.NewTestStore(t).WithMetrics(reg)
+}
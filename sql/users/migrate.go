@@ -0,0 +1,142 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationsFS holds the schema migrations for every dialect. Each
+// dialect's migrations are in a directory named after the dialect, such as
+// migrations/mysql, in files named after their version number, such as
+// 0001_create_users.sql.
+//
+//go:embed migrations
+var migrationsFS embed.FS
+
+// A migration is a numbered .sql file of statements that changes the
+// database's schema.
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// Migrate applies the migrations for dialect d that haven't been applied
+// to db yet, in order of their version numbers. Applied versions are
+// recorded in a schema_migrations table, so Migrate is safe to run every
+// time an application starts.
+func Migrate(ctx context.Context, db *sql.DB, d Dialect) error {
+	migrations, err := loadMigrations(d)
+	if err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+
+	_, err = db.ExecContext(ctx, "create table if not exists schema_migrations"+
+		" (version integer primary key, applied_at timestamp not null)")
+	if err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+
+	for _, m := range migrations {
+		var applied bool
+		query := "select exists(select 1 from schema_migrations where version = " + Placeholder(d, 1) + ")"
+		if err := db.QueryRowContext(ctx, query, m.version).Scan(&applied); err != nil {
+			return fmt.Errorf("migrate: %w", err)
+		}
+		if applied {
+			continue
+		}
+
+		if err := applyMigration(ctx, db, d, m); err != nil {
+			return fmt.Errorf("migrate: %s: %w", m.name, err)
+		}
+	}
+
+	return nil
+}
+
+// applyMigration runs the statements of m and records it as applied in a
+// single transaction. Note that MySQL commits schema changes implicitly,
+// so on MySQL a migration that fails part way through isn't rolled back.
+func applyMigration(ctx context.Context, db *sql.DB, d Dialect, m migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range splitStatements(m.sql) {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+
+	query := "insert into schema_migrations (version, applied_at) values (" + placeholders(d, 1, 2) + ")"
+	if _, err := tx.ExecContext(ctx, query, m.version, time.Now().UTC()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// loadMigrations returns the migrations for dialect d, sorted by version.
+func loadMigrations(d Dialect) ([]migration, error) {
+	dir := path.Join("migrations", d.String())
+	entries, err := fs.ReadDir(migrationsFS, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []migration
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".sql" {
+			continue
+		}
+
+		prefix, _, _ := strings.Cut(e.Name(), "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has no version number", e.Name())
+		}
+
+		b, err := fs.ReadFile(migrationsFS, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{version: version, name: e.Name(), sql: string(b)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].version == migrations[i-1].version {
+			return nil, fmt.Errorf("migrations %s and %s have the same version",
+				migrations[i-1].name, migrations[i].name)
+		}
+	}
+
+	return migrations, nil
+}
+
+// splitStatements splits the contents of a migration file into its
+// statements, which are separated by semicolons. Drivers such as the
+// mysql driver only run one statement per Exec by default. Semicolons
+// must therefore not be used within a statement, such as in a string.
+func splitStatements(sql string) []string {
+	var stmts []string
+	for _, stmt := range strings.Split(sql, ";") {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+	}
+	return stmts
+}
@@ -0,0 +1,45 @@
+package users_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+func TestMigrate(t *testing.T) {
+	db := dbtest.NewTestDB(t)
+	ctx := context.Background()
+
+	// NewTestDB has already applied every migration, so running them
+	// again changes nothing.
+	var before int
+	if err := db.QueryRowContext(ctx, "select count(*) from schema_migrations").Scan(&before); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Migrate(ctx, db, users.SQLite); err != nil {
+		t.Fatal(err)
+	}
+	var after, latest int
+	if err := db.QueryRowContext(ctx, "select count(*), max(version) from schema_migrations").Scan(&after, &latest); err != nil {
+		t.Fatal(err)
+	}
+	if after != before {
+		t.Errorf("second Migrate recorded %d migrations, want none", after-before)
+	}
+	if latest < 14 {
+		t.Errorf("latest version = %d, want at least 14", latest)
+	}
+
+	// The columns added by the migrations are all there.
+	_, err := db.ExecContext(ctx, "select id, username, email, password, role, version, created_at, updated_at,"+
+		" deleted_at, last_login_at, failed_login_count, locked_until, needs_rehash, tenant_id, metadata from users")
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = db.ExecContext(ctx, "select table_name, tenant_id, idempotency_key, user_id, created_at from idempotency_keys")
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,9 @@
+create table if not exists users (
+	id         int auto_increment primary key,
+	username   varchar(255) collate utf8mb4_bin not null unique,
+	email      varchar(255) not null unique,
+	password   varchar(255) not null,
+	created_at datetime(6) not null,
+	updated_at datetime(6) not null,
+	deleted_at datetime(6) null
+);
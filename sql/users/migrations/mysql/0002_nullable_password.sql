@@ -0,0 +1 @@
+alter table users modify password varchar(255) null;
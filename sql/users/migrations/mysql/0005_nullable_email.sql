@@ -0,0 +1 @@
+alter table users modify email varchar(255) null;
@@ -0,0 +1 @@
+alter table users add column last_login_at datetime(6) null;
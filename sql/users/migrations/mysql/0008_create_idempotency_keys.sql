@@ -0,0 +1,5 @@
+create table if not exists idempotency_keys (
+	idempotency_key varchar(255) primary key,
+	user_id         int not null,
+	created_at      datetime(6) not null
+);
@@ -0,0 +1 @@
+create fulltext index users_search_idx on users (username, email);
@@ -0,0 +1,8 @@
+-- Idempotency keys are scoped to the table and tenant of the store that
+-- recorded them. Keys recorded before are for the default users table,
+-- and stores without a tenant record theirs with tenant 0.
+alter table idempotency_keys
+	add column table_name varchar(255) not null default 'users',
+	add column tenant_id bigint not null default 0,
+	drop primary key,
+	add primary key (table_name, tenant_id, idempotency_key);
@@ -0,0 +1,9 @@
+create table if not exists users (
+	id         serial primary key,
+	username   varchar(255) not null unique,
+	email      varchar(255) not null unique,
+	password   varchar(255) not null,
+	created_at timestamptz not null,
+	updated_at timestamptz not null,
+	deleted_at timestamptz null
+);
@@ -0,0 +1 @@
+alter table users alter column password drop not null;
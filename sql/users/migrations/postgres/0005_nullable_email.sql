@@ -0,0 +1 @@
+alter table users alter column email drop not null;
@@ -0,0 +1,5 @@
+create table if not exists idempotency_keys (
+	idempotency_key varchar(255) primary key,
+	user_id         integer not null,
+	created_at      timestamptz not null
+);
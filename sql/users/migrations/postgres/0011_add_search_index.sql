@@ -0,0 +1 @@
+create index users_search_idx on users using gin (to_tsvector('simple', username || ' ' || coalesce(email, '')));
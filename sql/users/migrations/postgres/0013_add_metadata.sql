@@ -0,0 +1 @@
+alter table users add column metadata jsonb null;
@@ -0,0 +1,9 @@
+create table if not exists users (
+	id         integer primary key autoincrement,
+	username   text not null unique,
+	email      text not null unique,
+	password   text not null,
+	created_at timestamp not null,
+	updated_at timestamp not null,
+	deleted_at timestamp null
+);
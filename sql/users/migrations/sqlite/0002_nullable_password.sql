@@ -0,0 +1,15 @@
+-- SQLite can't drop a column's not null constraint, so the users table is
+-- rebuilt without it.
+create table users_new (
+	id         integer primary key autoincrement,
+	username   text not null unique,
+	email      text not null unique,
+	password   text null,
+	created_at timestamp not null,
+	updated_at timestamp not null,
+	deleted_at timestamp null
+);
+insert into users_new (id, username, email, password, created_at, updated_at, deleted_at)
+	select id, username, email, password, created_at, updated_at, deleted_at from users;
+drop table users;
+alter table users_new rename to users;
@@ -0,0 +1 @@
+alter table users add column version integer not null default 1;
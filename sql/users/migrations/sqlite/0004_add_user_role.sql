@@ -0,0 +1,2 @@
+alter table users add column role text not null default 'user';
+create index users_role_idx on users (role);
@@ -0,0 +1,18 @@
+-- SQLite can't drop a column's not null constraint, so the users table is
+-- rebuilt without it, and its index recreated.
+create table users_new (
+	id         integer primary key autoincrement,
+	username   text not null unique,
+	email      text null unique,
+	password   text null,
+	role       text not null default 'user',
+	created_at timestamp not null,
+	updated_at timestamp not null,
+	deleted_at timestamp null,
+	version    integer not null default 1
+);
+insert into users_new (id, username, email, password, role, created_at, updated_at, deleted_at, version)
+	select id, username, email, password, role, created_at, updated_at, deleted_at, version from users;
+drop table users;
+alter table users_new rename to users;
+create index users_role_idx on users (role);
@@ -0,0 +1,2 @@
+alter table users add column failed_login_count integer not null default 0;
+alter table users add column locked_until timestamp null;
@@ -0,0 +1,5 @@
+create table if not exists idempotency_keys (
+	idempotency_key text primary key,
+	user_id         integer not null,
+	created_at      timestamp not null
+);
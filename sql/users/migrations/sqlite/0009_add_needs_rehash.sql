@@ -0,0 +1 @@
+alter table users add column needs_rehash boolean not null default false;
@@ -0,0 +1,2 @@
+alter table users add column tenant_id integer null;
+create index users_tenant_id_idx on users (tenant_id);
@@ -0,0 +1,6 @@
+create table if not exists reset_tokens (
+	token_hash text primary key,
+	user_id    integer not null,
+	expires_at timestamp not null
+);
+create index reset_tokens_user_id_idx on reset_tokens (user_id);
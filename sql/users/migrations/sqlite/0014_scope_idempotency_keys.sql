@@ -0,0 +1,16 @@
+-- Idempotency keys are scoped to the table and tenant of the store that
+-- recorded them. Keys recorded before are for the default users table,
+-- and stores without a tenant record theirs with tenant 0. SQLite can't
+-- change a table's primary key, so the table is rebuilt.
+create table idempotency_keys_new (
+	table_name      text not null,
+	tenant_id       integer not null,
+	idempotency_key text not null,
+	user_id         integer not null,
+	created_at      timestamp not null,
+	primary key (table_name, tenant_id, idempotency_key)
+);
+insert into idempotency_keys_new (table_name, tenant_id, idempotency_key, user_id, created_at)
+	select 'users', 0, idempotency_key, user_id, created_at from idempotency_keys;
+drop table idempotency_keys;
+alter table idempotency_keys_new rename to idempotency_keys;
@@ -0,0 +1,83 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// NamedExec runs query with ExecContext after replacing each :name in it
+// with a placeholder for the store's dialect, whose argument is arg's
+// value for name. A name can be used more than once. It's an error for
+// query to use a name that isn't in arg.
+//
+// Names in quoted strings and Postgres :: casts are left alone.
+func (s *Store) NamedExec(ctx context.Context, query string, arg map[string]interface{}) (res sql.Result, err error) {
+	ctx, op, err := s.startOp(ctx, "NamedExec")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { op.end(err, 0) }()
+
+	query, args, err := bindNamed(s.dialect, query, arg)
+	if err != nil {
+		return nil, fmt.Errorf("named exec: %w", err)
+	}
+	res, err = s.execContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("named exec: %w", err)
+	}
+	return res, nil
+}
+
+// bindNamed rewrites the :name parameters in query into placeholders for
+// dialect d, and returns the rewritten query along with the values from
+// arg for each placeholder in order.
+func bindNamed(d Dialect, query string, arg map[string]interface{}) (string, []interface{}, error) {
+	var (
+		b     strings.Builder
+		args  []interface{}
+		quote byte // the quote character of the string being read, if any
+	)
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == ':' && i+1 < len(query) && query[i+1] == ':':
+			// A Postgres cast such as id::text.
+			b.WriteString("::")
+			i++
+			continue
+		case c == ':' && i+1 < len(query) && isNameStart(query[i+1]):
+			j := i + 1
+			for j < len(query) && isNamePart(query[j]) {
+				j++
+			}
+			name := query[i+1 : j]
+			v, ok := arg[name]
+			if !ok {
+				return "", nil, fmt.Errorf("missing value for parameter %q", name)
+			}
+			args = append(args, v)
+			b.WriteString(Placeholder(d, len(args)))
+			i = j - 1
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), args, nil
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isNamePart(c byte) bool {
+	return isNameStart(c) || '0' <= c && c <= '9'
+}
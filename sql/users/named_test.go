@@ -0,0 +1,95 @@
+package users
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestBindNamed(t *testing.T) {
+	arg := map[string]interface{}{"id": 1, "name": "alice", "role_2": RoleAdmin}
+	tests := []struct {
+		query    string
+		want     [3]string // for MySQL, Postgres and SQLite
+		wantArgs []interface{}
+	}{
+		{
+			"update users set username = :name where id = :id",
+			[3]string{
+				"update users set username = ? where id = ?",
+				"update users set username = $1 where id = $2",
+				"update users set username = ? where id = ?",
+			},
+			[]interface{}{"alice", 1},
+		},
+		{
+			"select * from users where username = :name or email = :name and role = :role_2",
+			[3]string{
+				"select * from users where username = ? or email = ? and role = ?",
+				"select * from users where username = $1 or email = $2 and role = $3",
+				"select * from users where username = ? or email = ? and role = ?",
+			},
+			[]interface{}{"alice", "alice", RoleAdmin},
+		},
+		{
+			`select ':id', ":id", id::text from users where id = :id`,
+			[3]string{
+				`select ':id', ":id", id::text from users where id = ?`,
+				`select ':id', ":id", id::text from users where id = $1`,
+				`select ':id', ":id", id::text from users where id = ?`,
+			},
+			[]interface{}{1},
+		},
+		{"select 1", [3]string{"select 1", "select 1", "select 1"}, nil},
+	}
+	for _, tt := range tests {
+		for i, d := range []Dialect{MySQL, Postgres, SQLite} {
+			got, args, err := bindNamed(d, tt.query, arg)
+			if err != nil {
+				t.Errorf("bindNamed(%v, %q): %v", d, tt.query, err)
+				continue
+			}
+			if got != tt.want[i] || !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("bindNamed(%v, %q) = %q, %v; want %q, %v", d, tt.query, got, args, tt.want[i], tt.wantArgs)
+			}
+		}
+	}
+
+	if _, _, err := bindNamed(MySQL, "select * from users where id = :missing", arg); err == nil {
+		t.Error("bindNamed with a missing parameter succeeded")
+	}
+}
+
+func TestNamedExec(t *testing.T) {
+	ctx := context.Background()
+	for _, d := range []Dialect{MySQL, Postgres, SQLite} {
+		t.Run(d.String(), func(t *testing.T) {
+			// Queries in every dialect are run on SQLite, which accepts
+			// both ? and $1 placeholders.
+			s := NewStore(newTestDB(t), d)
+			if _, err := s.CreateUser(ctx, &User{Username: "alice", Password: "password123"}); err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := s.NamedExec(ctx, "update users set role = :role where username = :name and role != :role",
+				map[string]interface{}{"name": "alice", "role": RoleAdmin})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n, err := res.RowsAffected(); err != nil || n != 1 {
+				t.Errorf("RowsAffected = %d, %v; want 1, nil", n, err)
+			}
+			u, err := s.GetUserByUsername(ctx, "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.Role != RoleAdmin {
+				t.Errorf("role = %q, want %q", u.Role, RoleAdmin)
+			}
+
+			if _, err := s.NamedExec(ctx, "delete from users where id = :id", nil); err == nil {
+				t.Error("NamedExec with a missing parameter succeeded")
+			}
+		})
+	}
+}
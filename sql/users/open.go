@@ -0,0 +1,184 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Default connection pool settings used by Open for zero-valued Config
+// fields.
+const (
+	defaultMaxOpenConns    = 25
+	defaultMaxIdleConns    = 25
+	defaultConnMaxLifetime = 5 * time.Minute
+	defaultConnMaxIdleTime = 5 * time.Minute
+	defaultPingAttempts    = 5
+	defaultPingDelay       = 200 * time.Millisecond
+)
+
+// A Config configures the database opened by Open. Zero-valued fields
+// are replaced with sensible defaults.
+type Config struct {
+	// Dialect selects the driver used to open the database. The zero
+	// value is MySQL.
+	Dialect Dialect
+
+	// MaxOpenConns is the maximum number of open connections to the
+	// database.
+	MaxOpenConns int
+
+	// MaxIdleConns is the maximum number of connections kept in the
+	// idle connection pool.
+	MaxIdleConns int
+
+	// ConnMaxLifetime is the maximum amount of time a connection may
+	// be reused.
+	ConnMaxLifetime time.Duration
+
+	// ConnMaxIdleTime is the maximum amount of time a connection may
+	// be idle before it's closed.
+	ConnMaxIdleTime time.Duration
+
+	// PingAttempts is the number of times Open pings the database before
+	// giving up, which gives a database that's still starting up time to
+	// become ready.
+	PingAttempts int
+
+	// PingDelay is how long Open waits before retrying its first failed
+	// ping. The delay doubles after every failed attempt.
+	PingDelay time.Duration
+}
+
+// withDefaults returns a copy of cfg with its zero-valued fields set to
+// their defaults.
+func (cfg Config) withDefaults() Config {
+	if cfg.MaxOpenConns == 0 {
+		cfg.MaxOpenConns = defaultMaxOpenConns
+	}
+	if cfg.MaxIdleConns == 0 {
+		cfg.MaxIdleConns = defaultMaxIdleConns
+	}
+	if cfg.ConnMaxLifetime == 0 {
+		cfg.ConnMaxLifetime = defaultConnMaxLifetime
+	}
+	if cfg.ConnMaxIdleTime == 0 {
+		cfg.ConnMaxIdleTime = defaultConnMaxIdleTime
+	}
+	if cfg.PingAttempts == 0 {
+		cfg.PingAttempts = defaultPingAttempts
+	}
+	if cfg.PingDelay == 0 {
+		cfg.PingDelay = defaultPingDelay
+	}
+	return cfg
+}
+
+// Open opens the database specified by dsn using cfg's dialect, applies
+// cfg's connection pool settings and pings the database with
+// PingWithRetry to verify that the connection is valid, since the
+// database isn't actually connected to until it's first used. If the
+// database can't be reached, the returned error matches ErrCannotConnect
+// when checked with errors.Is, and if it rejects the DSN's credentials,
+// ErrAuthFailed.
+func Open(dsn string, cfg Config) (*sql.DB, error) {
+	return openContext(context.Background(), dsn, cfg)
+}
+
+// openContext is like Open, but gives up pinging the database once ctx
+// is done.
+func openContext(ctx context.Context, dsn string, cfg Config) (*sql.DB, error) {
+	cfg = cfg.withDefaults()
+
+	// Open opens a database specified by its database driver name and a
+	// driver-specific data source name, usually consisting of at least a
+	// database name and connection information.
+	db, err := sql.Open(cfg.Dialect.DriverName(), dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+
+	// SetMaxOpenConns sets the maximum number of open connections to the
+	// database.
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+
+	// SetMaxIdleConns sets the maximum number of connections in the idle
+	// connection pool. If MaxOpenConns is greater than 0 but less than the
+	// new MaxIdleConns, then the new MaxIdleConns will be reduced to match
+	// the MaxOpenConns limit.
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+
+	// SetConnMaxLifetime sets the maximum amount of time a connection may
+	// be reused.
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	// SetConnMaxIdleTime sets the maximum amount of time a connection may
+	// be idle.
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	if err := PingWithRetry(ctx, db, cfg.PingAttempts, cfg.PingDelay); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open: %w", classifyConnectError(err))
+	}
+
+	return db, nil
+}
+
+// A pinger is anything that can be pinged, such as a *sql.DB.
+type pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// PingWithRetry pings db up to attempts times, waiting baseDelay before the
+// first retry and doubling the wait after each failed attempt. It returns
+// nil as soon as a ping succeeds, the last ping's error once all attempts
+// have failed, or ctx's error if ctx is done while waiting to retry. db is
+// always pinged at least once. Pings that fail because the database
+// rejected the credentials aren't retried.
+func PingWithRetry(ctx context.Context, db *sql.DB, attempts int, baseDelay time.Duration) error {
+	return pingWithRetry(ctx, db, attempts, baseDelay, sleep)
+}
+
+// pingWithRetry is PingWithRetry, waiting between attempts with sleep so
+// that tests can retry without waiting.
+func pingWithRetry(ctx context.Context, p pinger, attempts int, baseDelay time.Duration, sleep func(context.Context, time.Duration) error) error {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	delay := baseDelay
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			if err := sleep(ctx, delay); err != nil {
+				return err
+			}
+			delay *= 2
+		}
+
+		// PingContext verifies a connection to the database is still alive,
+		// establishing a connection if necessary.
+		if err = p.PingContext(ctx); err == nil {
+			return nil
+		}
+		// Bad credentials won't get any better by trying again.
+		if isAuthFailure(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// sleep waits for d, returning early with ctx's error if ctx is done
+// first.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,128 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// A fakePinger fails the first len(errs) pings with errs, in order, and
+// then succeeds.
+type fakePinger struct {
+	errs  []error
+	pings int
+}
+
+func (p *fakePinger) PingContext(ctx context.Context) error {
+	p.pings++
+	if p.pings <= len(p.errs) {
+		return p.errs[p.pings-1]
+	}
+	return nil
+}
+
+func TestPingWithRetry(t *testing.T) {
+	errDown := errors.New("connection refused")
+	errAuth := &pq.Error{Code: "28P01"}
+	tests := []struct {
+		name      string
+		errs      []error
+		attempts  int
+		wantPings int
+		wantErr   error
+		wantWaits []time.Duration
+	}{
+		{"first ping", nil, 3, 1, nil, nil},
+		{"recovers", []error{errDown, errDown}, 3, 3, nil, []time.Duration{10 * time.Millisecond, 20 * time.Millisecond}},
+		{"gives up", []error{errDown, errDown, errDown}, 3, 3, errDown, []time.Duration{10 * time.Millisecond, 20 * time.Millisecond}},
+		{"no attempts", []error{errDown}, 0, 1, errDown, nil},
+		{"bad credentials", []error{errAuth}, 3, 1, errAuth, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &fakePinger{errs: tt.errs}
+			var waits []time.Duration
+			sleep := func(ctx context.Context, d time.Duration) error {
+				waits = append(waits, d)
+				return nil
+			}
+
+			err := pingWithRetry(context.Background(), p, tt.attempts, 10*time.Millisecond, sleep)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if p.pings != tt.wantPings {
+				t.Errorf("pinged %d times, want %d", p.pings, tt.wantPings)
+			}
+			if !reflect.DeepEqual(waits, tt.wantWaits) {
+				t.Errorf("waited %v, want %v", waits, tt.wantWaits)
+			}
+		})
+	}
+}
+
+func TestPingWithRetryCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p := &fakePinger{errs: []error{errors.New("connection refused")}}
+
+	err := pingWithRetry(ctx, p, 3, time.Hour, sleep)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if p.pings != 1 {
+		t.Errorf("pinged %d times, want 1", p.pings)
+	}
+}
+
+func TestConfigWithDefaults(t *testing.T) {
+	got := Config{}.withDefaults()
+	want := Config{
+		MaxOpenConns:    defaultMaxOpenConns,
+		MaxIdleConns:    defaultMaxIdleConns,
+		ConnMaxLifetime: defaultConnMaxLifetime,
+		ConnMaxIdleTime: defaultConnMaxIdleTime,
+		PingAttempts:    defaultPingAttempts,
+		PingDelay:       defaultPingDelay,
+	}
+	if got != want {
+		t.Errorf("Config{}.withDefaults() = %+v, want %+v", got, want)
+	}
+
+	set := Config{
+		Dialect:         SQLite,
+		MaxOpenConns:    3,
+		MaxIdleConns:    2,
+		ConnMaxLifetime: time.Minute,
+		ConnMaxIdleTime: time.Second,
+		PingAttempts:    1,
+		PingDelay:       time.Millisecond,
+	}
+	if got := set.withDefaults(); got != set {
+		t.Errorf("withDefaults changed the fields that were set: %+v, want %+v", got, set)
+	}
+}
+
+func TestOpenAppliesPoolConfig(t *testing.T) {
+	db, err := Open(":memory:", Config{Dialect: SQLite, MaxOpenConns: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got := db.Stats().MaxOpenConnections; got != 3 {
+		t.Errorf("MaxOpenConnections = %d, want 3", got)
+	}
+
+	db, err = Open(":memory:", Config{Dialect: SQLite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got := db.Stats().MaxOpenConnections; got != defaultMaxOpenConns {
+		t.Errorf("MaxOpenConnections = %d, want the default %d", got, defaultMaxOpenConns)
+	}
+}
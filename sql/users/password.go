@@ -0,0 +1,61 @@
+package users
+
+import (
+	"errors"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	// ErrPasswordTooShort, ErrPasswordNoUpper, ErrPasswordNoDigit and
+	// ErrPasswordNoSymbol are returned by PasswordPolicy.Validate for
+	// passwords that break the policy's rules.
+	ErrPasswordTooShort = errors.New("password is too short")
+	ErrPasswordNoUpper  = errors.New("password must contain an uppercase letter")
+	ErrPasswordNoDigit  = errors.New("password must contain a digit")
+	ErrPasswordNoSymbol = errors.New("password must contain a symbol")
+)
+
+// A PasswordPolicy describes the rules that new passwords must follow.
+// The zero PasswordPolicy allows any password.
+type PasswordPolicy struct {
+	// MinLength is the minimum number of characters in a password.
+	MinLength int
+
+	// RequireUpper, RequireDigit and RequireSymbol require passwords to
+	// contain at least one uppercase letter, digit or symbol respectively.
+	// Symbols include punctuation, such as ! and #.
+	RequireUpper, RequireDigit, RequireSymbol bool
+}
+
+// Validate checks plain against p's rules. It returns all of the rules
+// that plain breaks joined together with errors.Join, so each of them can
+// be checked for with errors.Is.
+func (p PasswordPolicy) Validate(plain string) error {
+	var hasUpper, hasDigit, hasSymbol bool
+	for _, r := range plain {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+
+	var errs []error
+	if utf8.RuneCountInString(plain) < p.MinLength {
+		errs = append(errs, ErrPasswordTooShort)
+	}
+	if p.RequireUpper && !hasUpper {
+		errs = append(errs, ErrPasswordNoUpper)
+	}
+	if p.RequireDigit && !hasDigit {
+		errs = append(errs, ErrPasswordNoDigit)
+	}
+	if p.RequireSymbol && !hasSymbol {
+		errs = append(errs, ErrPasswordNoSymbol)
+	}
+	return errors.Join(errs...)
+}
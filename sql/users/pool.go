@@ -0,0 +1,143 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrPoolExhausted is returned by a Store's methods when the store's
+// AcquireTimeout passes before one of its connections becomes free.
+var ErrPoolExhausted = errors.New("connection pool exhausted")
+
+// reservedConnKey is the context key for the connection reserved for a
+// call by reserveConn.
+type reservedConnKey struct{}
+
+// reserveConn waits up to s.AcquireTimeout for a connection for a call of
+// one of s's methods, and returns a copy of ctx that the call's queries
+// will run on the connection with, along with the connection, which must
+// be closed once the call is done. Holding on to the connection means the
+// call's queries don't have to wait for another one.
+//
+// If s.AcquireTimeout isn't set, s is in a transaction, which already has
+// a connection of its own, or ctx already has a connection reserved, such
+// as when one method calls another, no connection is reserved, and ctx is
+// returned as is with a nil connection.
+func (s *Store) reserveConn(ctx context.Context) (context.Context, *sql.Conn, error) {
+	if s.AcquireTimeout <= 0 || s.tx != nil || reservedConn(ctx) != nil {
+		return ctx, nil, nil
+	}
+
+	acquireCtx, cancel := context.WithTimeout(ctx, s.AcquireTimeout)
+	defer cancel()
+	conn, err := s.conn().Conn(acquireCtx)
+	if err != nil {
+		// Only the acquire timeout firing means the pool is exhausted,
+		// rather than ctx being done.
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			return ctx, nil, ErrPoolExhausted
+		}
+		return ctx, nil, err
+	}
+	return context.WithValue(ctx, reservedConnKey{}, conn), conn, nil
+}
+
+// reservedConn returns the connection reserved by reserveConn for the
+// call that ctx belongs to, or nil if there isn't one.
+func reservedConn(ctx context.Context) *sql.Conn {
+	conn, _ := ctx.Value(reservedConnKey{}).(*sql.Conn)
+	return conn
+}
+
+// Stats returns the connection pool statistics of the store's database.
+func (s *Store) Stats() sql.DBStats {
+	return s.conn().Stats()
+}
+
+// PoolUtilization returns the fraction of the store's maximum number of
+// open connections that are currently in use, from 0 to 1. It returns 0
+// if the number of open connections isn't limited.
+func (s *Store) PoolUtilization() float64 {
+	stats := s.conn().Stats()
+	if stats.MaxOpenConnections <= 0 {
+		return 0
+	}
+	return float64(stats.InUse) / float64(stats.MaxOpenConnections)
+}
+
+// MonitorPool starts a goroutine that calls fn with the store's
+// connection pool statistics every interval, until ctx is done. It
+// returns straight away.
+func (s *Store) MonitorPool(ctx context.Context, interval time.Duration, fn func(sql.DBStats)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				fn(s.conn().Stats())
+			}
+		}
+	}()
+}
+
+// WarmUp opens n of the store's connections at once and pings them, so
+// that the first requests after startup don't have to wait for
+// connections to be established. n is capped at the pool's maximum
+// number of open connections. The connections are then left idle in the
+// pool, though only as many as Config.MaxIdleConns are kept, and they're
+// closed again once they've been idle for Config.ConnMaxIdleTime.
+//
+// Connections that are already open are reused rather than opened again.
+// WarmUp gives up once ctx is done, and returns the errors of every
+// connection that couldn't be opened or pinged joined together.
+func (s *Store) WarmUp(ctx context.Context, n int) error {
+	ctx, cancel := s.withDefaultTimeout(ctx)
+	defer cancel()
+
+	db := s.conn()
+	if max := db.Stats().MaxOpenConnections; max > 0 && n > max {
+		n = max
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	// Every connection is held until all of them have been opened, since
+	// a connection that was returned to the pool would just be handed out
+	// again instead of a new one being opened.
+	conns := make([]*sql.Conn, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := db.Conn(ctx)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			conns[i] = conn
+			errs[i] = conn.PingContext(ctx)
+		}()
+	}
+	wg.Wait()
+
+	for _, conn := range conns {
+		if conn != nil {
+			conn.Close()
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("warm up: %w", err)
+	}
+	return nil
+}
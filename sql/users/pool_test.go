@@ -0,0 +1,136 @@
+package users_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+func TestWarmUp(t *testing.T) {
+	ctx := context.Background()
+	s := openStore(t, users.Config{MaxOpenConns: 4, MaxIdleConns: 4})
+
+	if err := s.WarmUp(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	if stats := s.Stats(); stats.OpenConnections != 3 || stats.Idle != 3 {
+		t.Errorf("after WarmUp(3): %d open, %d idle; want 3, 3", stats.OpenConnections, stats.Idle)
+	}
+
+	// n is capped at MaxOpenConns, and the open connections are reused.
+	if err := s.WarmUp(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	if stats := s.Stats(); stats.OpenConnections != 4 || stats.Idle != 4 {
+		t.Errorf("after WarmUp(10): %d open, %d idle; want 4, 4", stats.OpenConnections, stats.Idle)
+	}
+
+	if err := s.WarmUp(ctx, 0); err != nil {
+		t.Errorf("WarmUp(0) = %v", err)
+	}
+}
+
+func TestWarmUpTestStore(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+
+	if err := s.WarmUp(ctx, 5); err != nil {
+		t.Fatal(err)
+	}
+	if stats := s.Stats(); stats.OpenConnections != 1 {
+		t.Errorf("%d connections open, want the test store's 1", stats.OpenConnections)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := s.WarmUp(canceled, 1); err == nil {
+		t.Error("WarmUp with a canceled context succeeded")
+	}
+}
+
+func TestPoolStats(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+
+	if u := s.PoolUtilization(); u != 0 {
+		t.Errorf("PoolUtilization of an idle pool = %v, want 0", u)
+	}
+	err := s.WithinTx(ctx, func(*users.Store) error {
+		if stats := s.Stats(); stats.InUse != 1 || stats.MaxOpenConnections != 1 {
+			t.Errorf("Stats in a transaction: %d in use of %d, want 1 of 1", stats.InUse, stats.MaxOpenConnections)
+		}
+		if u := s.PoolUtilization(); u != 1 {
+			t.Errorf("PoolUtilization in a transaction = %v, want 1", u)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A pool without a limit is never full.
+	db, err := sql.Open(users.SQLite.DriverName(), ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if u := users.NewStore(db, users.SQLite).PoolUtilization(); u != 0 {
+		t.Errorf("PoolUtilization without a limit = %v, want 0", u)
+	}
+}
+
+func TestMonitorPool(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	got := make(chan sql.DBStats, 1)
+	s.MonitorPool(ctx, time.Millisecond, func(stats sql.DBStats) {
+		select {
+		case got <- stats:
+		default:
+		}
+	})
+	select {
+	case stats := <-got:
+		if stats.MaxOpenConnections != 1 {
+			t.Errorf("MonitorPool reported %d max open connections, want 1", stats.MaxOpenConnections)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("MonitorPool never reported the pool's stats")
+	}
+}
+
+func TestAcquireTimeout(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	s.AcquireTimeout = 20 * time.Millisecond
+
+	// With a free connection, calls go ahead and give it back.
+	createUsers(t, s, "alice")
+	if stats := s.Stats(); stats.InUse != 0 {
+		t.Errorf("%d connections still in use", stats.InUse)
+	}
+
+	release := make(chan struct{})
+	call := startBlockedCall(t, s, release)
+	defer func() {
+		close(release)
+		<-call
+	}()
+
+	if _, err := s.CountUsers(context.Background()); !errors.Is(err, users.ErrPoolExhausted) {
+		t.Errorf("CountUsers with the pool in use = %v, want ErrPoolExhausted", err)
+	}
+
+	// A call whose context has a deadline waits until then instead.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := s.CountUsers(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("CountUsers with a deadline = %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,121 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// ErrNotFound is returned by QueryOne when its query selects no rows.
+var ErrNotFound = errors.New("not found")
+
+// QueryOne runs query with args on db and returns the first row it
+// selects, as scanned by scan. It returns ErrNotFound if the query selects
+// no rows. Any further rows are ignored.
+//
+// scan is called with rows positioned on the row to scan, so it can be
+// used to scan rows into any type, not just User.
+func QueryOne[T any](ctx context.Context, db *sql.DB, scan func(*sql.Rows) (T, error), query string, args ...interface{}) (T, error) {
+	var zero T
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return zero, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return zero, err
+		}
+		return zero, ErrNotFound
+	}
+
+	v, err := scan(rows)
+	if err != nil {
+		return zero, err
+	}
+	// Close reports errors that happened while reading the row, which
+	// Next can't since it's not called again.
+	if err := rows.Close(); err != nil {
+		return zero, err
+	}
+	return v, nil
+}
+
+// QueryMany runs query with args on db and returns every row it selects,
+// as scanned by scan, which is called once per row. It returns an empty
+// slice if the query selects no rows.
+func QueryMany[T any](ctx context.Context, db *sql.DB, scan func(*sql.Rows) (T, error), query string, args ...interface{}) ([]T, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vs := []T{}
+	for rows.Next() {
+		v, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		vs = append(vs, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return vs, nil
+}
+
+// QueryMaps runs query with args on db and returns every row it selects
+// as a map from column names to values, for ad hoc queries such as
+// reports whose rows don't map to a type. Values are as returned by the
+// driver, except that []byte values are converted to strings, since some
+// drivers return text columns as bytes. It returns an empty slice if the
+// query selects no rows.
+func QueryMaps(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return ScanMaps(rows)
+}
+
+// ScanMaps reads every row of rows into a map like QueryMaps does, such
+// as for the rows returned by Store.Query, and closes rows.
+func ScanMaps(rows *sql.Rows) ([]map[string]interface{}, error) {
+	defer rows.Close()
+
+	// Columns returns the column names.
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	ms := []map[string]interface{}{}
+	vals := make([]interface{}, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range vals {
+		dest[i] = &vals[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		m := make(map[string]interface{}, len(cols))
+		for i, col := range cols {
+			// Scan reuses the memory of []byte values on the next call,
+			// but converting them copies them.
+			if b, ok := vals[i].([]byte); ok {
+				m[col] = string(b)
+			} else {
+				m[col] = vals[i]
+			}
+		}
+		ms = append(ms, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ms, nil
+}
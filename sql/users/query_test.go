@@ -0,0 +1,131 @@
+package users_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+// dialects lists every Dialect. The tests that run queries written in
+// each of them run them all on SQLite, which accepts both ? and $1
+// placeholders.
+var dialects = []users.Dialect{users.MySQL, users.Postgres, users.SQLite}
+
+// scanUsername scans the username column of a row.
+func scanUsername(rows *sql.Rows) (string, error) {
+	var username string
+	err := rows.Scan(&username)
+	return username, err
+}
+
+func TestQueryOne(t *testing.T) {
+	db := dbtest.NewTestDB(t)
+	ids := createUsers(t, users.NewStore(db, users.SQLite), "alice", "bob")
+	ctx := context.Background()
+	errScan := errors.New("scan failed")
+
+	for _, d := range dialects {
+		t.Run(d.String(), func(t *testing.T) {
+			tests := []struct {
+				name    string
+				scan    func(*sql.Rows) (string, error)
+				query   string
+				args    []interface{}
+				want    string
+				wantErr error
+			}{
+				{"one row", scanUsername, "select username from users where id = " + users.Placeholder(d, 1), []interface{}{ids[1]}, "bob", nil},
+				{"first of several", scanUsername, "select username from users where id >= " + users.Placeholder(d, 1) + " order by id", []interface{}{ids[0]}, "alice", nil},
+				{"no rows", scanUsername, "select username from users where username = " + users.Placeholder(d, 1), []interface{}{"carol"}, "", users.ErrNotFound},
+				{"scan error", func(*sql.Rows) (string, error) { return "", errScan }, "select username from users", nil, "", errScan},
+			}
+			for _, tt := range tests {
+				got, err := users.QueryOne(ctx, db, tt.scan, tt.query, tt.args...)
+				if !errors.Is(err, tt.wantErr) || got != tt.want {
+					t.Errorf("%s: QueryOne = %q, %v; want %q, %v", tt.name, got, err, tt.want, tt.wantErr)
+				}
+			}
+		})
+	}
+
+	if _, err := users.QueryOne(ctx, db, scanUsername, "select nope from users"); err == nil {
+		t.Error("QueryOne with a bad query succeeded")
+	}
+}
+
+func TestQueryMany(t *testing.T) {
+	db := dbtest.NewTestDB(t)
+	ids := createUsers(t, users.NewStore(db, users.SQLite), "alice", "bob", "carol")
+	ctx := context.Background()
+
+	for _, d := range dialects {
+		t.Run(d.String(), func(t *testing.T) {
+			tests := []struct {
+				name  string
+				query string
+				args  []interface{}
+				want  []string
+			}{
+				{"all rows", "select username from users order by id", nil, []string{"alice", "bob", "carol"}},
+				{"some rows", "select username from users where id > " + users.Placeholder(d, 1) + " and id <= " + users.Placeholder(d, 2) + " order by id",
+					[]interface{}{ids[0], ids[2]}, []string{"bob", "carol"}},
+				{"no rows", "select username from users where username = " + users.Placeholder(d, 1), []interface{}{"dave"}, []string{}},
+			}
+			for _, tt := range tests {
+				got, err := users.QueryMany(ctx, db, scanUsername, tt.query, tt.args...)
+				if err != nil {
+					t.Errorf("%s: %v", tt.name, err)
+					continue
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("%s: QueryMany = %q, want %q", tt.name, got, tt.want)
+				}
+			}
+		})
+	}
+
+	errScan := errors.New("scan failed")
+	scan := func(*sql.Rows) (string, error) { return "", errScan }
+	if got, err := users.QueryMany(ctx, db, scan, "select username from users"); !errors.Is(err, errScan) || got != nil {
+		t.Errorf("QueryMany with a failing scan = %q, %v; want nil, %v", got, err, errScan)
+	}
+}
+
+func TestQueryMaps(t *testing.T) {
+	db := dbtest.NewTestDB(t)
+	s := users.NewStore(db, users.SQLite)
+	ids := createUsers(t, s, "alice", "bob")
+	ctx := context.Background()
+	if err := s.SetRole(ctx, ids[1], users.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := users.QueryMaps(ctx, db, "select id, username, email, role from users order by id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]interface{}{
+		{"id": int64(ids[0]), "username": "alice", "email": nil, "role": users.RoleUser},
+		{"id": int64(ids[1]), "username": "bob", "email": nil, "role": users.RoleAdmin},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("QueryMaps = %v, want %v", got, want)
+	}
+
+	got, err = users.QueryMaps(ctx, db, "select id from users where username = ?", "carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || len(got) != 0 {
+		t.Errorf("QueryMaps with no rows = %#v, want an empty slice", got)
+	}
+
+	if _, err := users.QueryMaps(ctx, db, "select nope from users"); err == nil {
+		t.Error("QueryMaps with a bad query succeeded")
+	}
+}
@@ -0,0 +1,49 @@
+package users
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Rebind returns query, written with ? placeholders, with its
+// placeholders rewritten for the store's dialect, so that the same query
+// can be run on every database. Only Postgres placeholders differ, which
+// become $1, $2 and so on. Question marks in quoted strings and
+// identifiers are left alone.
+//
+// Postgres operators that contain a question mark, such as the jsonb ?
+// operator, can't be told apart from placeholders, so queries that use
+// them can't be rebound.
+func (s *Store) Rebind(query string) string {
+	return rebind(s.dialect, query)
+}
+
+// rebind is Rebind for dialect d.
+func rebind(d Dialect, query string) string {
+	if d != Postgres {
+		return query
+	}
+
+	var (
+		b     strings.Builder
+		n     int
+		quote byte // the quote character of the string being read, if any
+	)
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,44 @@
+package users
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		query string
+		want  [3]string // for MySQL, Postgres and SQLite
+	}{
+		{
+			"select * from users where id = ?",
+			[3]string{
+				"select * from users where id = ?",
+				"select * from users where id = $1",
+				"select * from users where id = ?",
+			},
+		},
+		{
+			"update users set role = ? where id in (?, ?)",
+			[3]string{
+				"update users set role = ? where id in (?, ?)",
+				"update users set role = $1 where id in ($2, $3)",
+				"update users set role = ? where id in (?, ?)",
+			},
+		},
+		{
+			"select '?', \"a?\", `b?` from users where username = ?",
+			[3]string{
+				"select '?', \"a?\", `b?` from users where username = ?",
+				"select '?', \"a?\", `b?` from users where username = $1",
+				"select '?', \"a?\", `b?` from users where username = ?",
+			},
+		},
+		{"select 1", [3]string{"select 1", "select 1", "select 1"}},
+	}
+	for _, tt := range tests {
+		for i, d := range []Dialect{MySQL, Postgres, SQLite} {
+			s := &Store{dialect: d}
+			if got := s.Rebind(tt.query); got != tt.want[i] {
+				t.Errorf("Rebind(%q) with %v = %q, want %q", tt.query, d, got, tt.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrCannotReconnect is returned by Reconnect for stores that weren't
+// opened with OpenStore, which don't know how to open their database.
+var ErrCannotReconnect = errors.New("store wasn't opened with OpenStore")
+
+// OpenStore opens the database specified by dsn with Open and returns a
+// Store that queries it using cfg's dialect. Unlike stores created with
+// NewStore, the returned store remembers dsn and cfg, so it can open the
+// database again with Reconnect.
+func OpenStore(dsn string, cfg Config) (*Store, error) {
+	db, err := Open(dsn, cfg)
+	if err != nil {
+		return nil, err
+	}
+	s := NewStore(db, cfg.Dialect)
+	s.dsn, s.cfg = dsn, cfg
+	return s, nil
+}
+
+// Reconnect replaces the store's connection pool with a new one, opened
+// from the DSN and Config that were given to OpenStore, such as to get
+// rid of connections that went bad during a database failover. The new
+// pool is pinged like Open does, giving up once ctx is done.
+//
+// Operations that are already running are allowed to finish first, while
+// new ones wait until Reconnect is done. If the database can't be opened
+// the store keeps its old pool and the error is returned. Statements
+// prepared with Prepare are prepared again on the new pool.
+func (s *Store) Reconnect(ctx context.Context) error {
+	s = s.root()
+	if s.dsn == "" {
+		return fmt.Errorf("reconnect: %w", ErrCannotReconnect)
+	}
+
+	s.reconnectMu.Lock()
+	defer s.reconnectMu.Unlock()
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrStoreClosed
+	}
+	done := make(chan struct{})
+	s.reconnecting = done
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.reconnecting = nil
+		s.mu.Unlock()
+		close(done)
+	}()
+
+	// Only operations that started before reconnecting was set can be
+	// running, and they're bounded by their own contexts, so this is
+	// where the store's in-flight operations drain.
+	s.inflight.Wait()
+
+	db, err := openContext(ctx, s.dsn, s.cfg)
+	if err != nil {
+		return fmt.Errorf("reconnect: %w", err)
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		// Shutdown ran while the database was being opened, and has
+		// already closed the old pool.
+		s.mu.Unlock()
+		db.Close()
+		return ErrStoreClosed
+	}
+	old, stmts := s.db, s.stmts
+	s.db, s.stmts = db, nil
+	s.mu.Unlock()
+
+	closeStmts(stmts)
+	old.Close()
+
+	if stmts != nil {
+		if err := s.Prepare(ctx); err != nil {
+			return fmt.Errorf("reconnect: %w", err)
+		}
+	}
+	return nil
+}
+
+// conn returns the store's *sql.DB. Operations started with acquire can
+// use s.db directly since Reconnect doesn't replace it while they run,
+// but anything else must use conn.
+func (s *Store) conn() *sql.DB {
+	s = s.root()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.db
+}
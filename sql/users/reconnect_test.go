@@ -0,0 +1,80 @@
+package users_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+// openStore returns a store opened with OpenStore and cfg, using the
+// SQLite dialect, on a migrated database in a temporary file. Unlike the
+// in-memory databases of dbtest, the file can be opened with any number
+// of connections, and opened again by Reconnect.
+func openStore(t *testing.T, cfg users.Config) *users.Store {
+	t.Helper()
+
+	ctx := context.Background()
+	dsn := filepath.Join(t.TempDir(), "users.db")
+	cfg.Dialect = users.SQLite
+	db, err := users.Open(dsn, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = users.Migrate(ctx, db, users.SQLite)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := users.OpenStore(dsn, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Shutdown(ctx) })
+	return s
+}
+
+func TestReconnect(t *testing.T) {
+	ctx := context.Background()
+	s := openStore(t, users.Config{})
+	ids := createUsers(t, s, "alice")
+	if err := s.Prepare(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Reconnect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The new pool opens the same database, and the statements are
+	// prepared on it again.
+	u, err := s.GetUserByID(ctx, ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Username != "alice" {
+		t.Errorf("username = %q, want alice", u.Username)
+	}
+	createUsers(t, s, "bob")
+
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reconnect(ctx); !errors.Is(err, users.ErrStoreClosed) {
+		t.Errorf("Reconnect after Shutdown = %v, want ErrStoreClosed", err)
+	}
+}
+
+func TestReconnectWithoutOpenStore(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	if err := s.Reconnect(context.Background()); !errors.Is(err, users.ErrCannotReconnect) {
+		t.Errorf("err = %v, want ErrCannotReconnect", err)
+	}
+	if _, err := s.CountUsers(context.Background()); err != nil {
+		t.Errorf("store is unusable after a failed Reconnect: %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package users
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// RehashWeakPasswords flags the users whose password hashes have a bcrypt
+// cost below minCost, and returns the number of users it flagged. Hashes
+// can't be recomputed without the plaintext password, so Authenticate
+// hashes a flagged user's password again with s.Hasher the next time they
+// sign in. If that's a BcryptHasher, its cost should be at least minCost
+// by then, or the new hashes will be just as weak.
+//
+// Users that are already flagged aren't counted again, so it's safe to
+// run RehashWeakPasswords repeatedly, such as after every deploy.
+func (s *Store) RehashWeakPasswords(ctx context.Context, minCost int) (rehashed int, err error) {
+	ctx, op, err := s.startOp(ctx, "RehashWeakPasswords")
+	if err != nil {
+		return 0, err
+	}
+	defer func() { op.end(err, rehashed) }()
+
+	if minCost < bcrypt.MinCost || minCost > bcrypt.MaxCost {
+		return 0, fmt.Errorf("rehash weak passwords: invalid bcrypt cost %d", minCost)
+	}
+
+	res, err := s.execRetry(ctx, flagWeakPasswordsQuery(s.dialect, s.table()), fmt.Sprintf("%02d", minCost))
+	if err != nil {
+		return 0, fmt.Errorf("rehash weak passwords: %w", err)
+	}
+	numAffected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("rehash weak passwords: %w", err)
+	}
+
+	// Any of the cached users may have just been flagged.
+	s.invalidateAll()
+	return int(numAffected), nil
+}
+
+// rehashPassword replaces the password hash of u, which was flagged by
+// RehashWeakPasswords, with a new hash of plain. If u's hash has been
+// changed since u was read, such as by ChangePassword, it's left alone.
+func (s *Store) rehashPassword(ctx context.Context, u *User, plain string) error {
+	hash, err := s.hashPassword(plain)
+	if err != nil {
+		return fmt.Errorf("rehash password: %w", err)
+	}
+	_, err = s.execRetry(ctx, rehashPasswordQuery(s.dialect, s.table()), hash, u.Id, u.Password)
+	s.invalidate(u.Id)
+	if err != nil {
+		return fmt.Errorf("rehash password: %w", err)
+	}
+	u.Password, u.NeedsRehash = hash, false
+	return nil
+}
@@ -0,0 +1,60 @@
+package users_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRehashWeakPasswords(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+	ids := createUsers(t, s, "alice", "bob")
+
+	for _, cost := range []int{bcrypt.MinCost - 1, bcrypt.MaxCost + 1} {
+		if _, err := s.RehashWeakPasswords(ctx, cost); err == nil {
+			t.Errorf("RehashWeakPasswords(%d) didn't fail", cost)
+		}
+	}
+
+	// The users' hashes have users.BcryptCost, which TestMain sets to
+	// bcrypt.MinCost.
+	if n, err := s.RehashWeakPasswords(ctx, bcrypt.MinCost); err != nil || n != 0 {
+		t.Errorf("RehashWeakPasswords(MinCost) = %d, %v, want 0, nil", n, err)
+	}
+	if n, err := s.RehashWeakPasswords(ctx, bcrypt.MinCost+1); err != nil || n != 2 {
+		t.Errorf("RehashWeakPasswords = %d, %v, want 2, nil", n, err)
+	}
+	if n, err := s.RehashWeakPasswords(ctx, bcrypt.MinCost+1); err != nil || n != 0 {
+		t.Errorf("RehashWeakPasswords flagged users again: %d, %v", n, err)
+	}
+
+	s.Hasher = users.BcryptHasher{Cost: bcrypt.MinCost + 1}
+	if _, err := s.Authenticate(ctx, "alice", "password123"); err != nil {
+		t.Fatal(err)
+	}
+	for i, wantCost := range []int{bcrypt.MinCost + 1, bcrypt.MinCost} {
+		u, err := s.GetUserByID(ctx, ids[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		cost, err := bcrypt.Cost([]byte(u.Password))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cost != wantCost {
+			t.Errorf("%s's hash has cost %d, want %d", u.Username, cost, wantCost)
+		}
+		if u.NeedsRehash != (i == 1) {
+			t.Errorf("%s: NeedsRehash = %t", u.Username, u.NeedsRehash)
+		}
+	}
+
+	// The new hash still checks the password.
+	if _, err := s.Authenticate(ctx, "alice", "password123"); err != nil {
+		t.Errorf("Authenticate after rehashing: %v", err)
+	}
+}
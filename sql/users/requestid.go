@@ -0,0 +1,21 @@
+package users
+
+import "context"
+
+// requestIDKey is the context key used by ContextWithRequestID.
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a copy of ctx carrying the request id id.
+// The store's slow query logs and tracing spans include the request id of
+// the context a method is called with, so that the queries run for a
+// request can be told apart from the rest.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestIDFromContext returns the request id carried by ctx, or "" if it
+// doesn't carry one.
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,46 @@
+package users_test
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+func TestRequestIDPropagation(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	tr := &recordingTracer{}
+	l := &recordingLogger{}
+	s.Tracer, s.Logger = tr, l
+	ctx := users.ContextWithRequestID(context.Background(), "req-42")
+
+	if _, err := s.CountUsers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(tr.spans) != 1 || tr.spans[0].attrs["request.id"].AsString() != "req-42" {
+		t.Errorf("span doesn't have request.id req-42: %+v", tr.spans)
+	}
+	if len(l.calls) != 1 {
+		t.Fatalf("logged %d calls, want 1", len(l.calls))
+	}
+
+	// Loggers are given the call's context, which StdLogger takes the
+	// request id from.
+	var buf bytes.Buffer
+	users.StdLogger{L: log.New(&buf, "", 0)}.Log(l.calls[0].ctx, "CountUsers", 0, nil)
+	if !strings.Contains(buf.String(), `request_id="req-42"`) {
+		t.Errorf("StdLogger logged %q, want request_id=\"req-42\"", buf.String())
+	}
+
+	// Calls without a request id don't get the attribute.
+	if _, err := s.CountUsers(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tr.spans[1].attrs["request.id"]; ok {
+		t.Error("span of a call without a request id has request.id")
+	}
+}
@@ -0,0 +1,155 @@
+package users
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// defaultResetTokenTTL is how long reset tokens can be used if a Store's
+// ResetTokenTTL isn't set.
+const defaultResetTokenTTL = time.Hour
+
+// resetTokenBytes is the number of random bytes in a reset token.
+const resetTokenBytes = 32
+
+// ErrInvalidResetToken is returned by ResetPassword for a token that
+// wasn't issued by IssueResetToken, has expired or has already been used.
+// The same error is returned in each case so callers can't tell which.
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+// resetTokenTTL returns s.ResetTokenTTL, or defaultResetTokenTTL if it
+// isn't set.
+func (s *Store) resetTokenTTL() time.Duration {
+	if s.ResetTokenTTL <= 0 {
+		return defaultResetTokenTTL
+	}
+	return s.ResetTokenTTL
+}
+
+// hashResetToken returns the hash of token that's stored in the
+// reset_tokens table. The tokens are random, so a fast hash is enough to
+// stop anyone who can read the table from using them.
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueResetToken returns a token for resetting the password of the user
+// with the given email with ResetPassword, such as to send to them in a
+// "forgot password" email. The token can be used once, within
+// s.ResetTokenTTL. Only a hash of the token is stored, so it can't be
+// recovered from the database. It returns ErrUserNotFound if no user has
+// the email, which callers shouldn't reveal to whoever asked for the
+// reset.
+//
+// Issuing a token doesn't invalidate the user's earlier ones, but tokens
+// that have expired are deleted.
+func (s *Store) IssueResetToken(ctx context.Context, email string) (token string, err error) {
+	ctx, op, err := s.startOp(ctx, "IssueResetToken")
+	if err != nil {
+		return "", err
+	}
+	defer func() { op.end(err, 1) }()
+
+	u, err := s.getUserByEmail(ctx, email)
+	if err != nil {
+		return "", fmt.Errorf("issue reset token: %w", err)
+	}
+
+	b := make([]byte, resetTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("issue reset token: %w", err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+
+	now := time.Now().UTC()
+	if _, err := s.execRetry(ctx, deleteExpiredResetTokensQuery(s.dialect), now); err != nil {
+		return "", fmt.Errorf("issue reset token: %w", err)
+	}
+	_, err = s.execRetry(ctx, insertResetTokenQuery(s.dialect), hashResetToken(token), u.Id, now.Add(s.resetTokenTTL()))
+	if err != nil {
+		return "", fmt.Errorf("issue reset token: %w", err)
+	}
+	return token, nil
+}
+
+// ResetPassword sets the password of the user that token was issued for
+// by IssueResetToken to newPlain, which must satisfy s.PasswordPolicy. It
+// returns ErrInvalidResetToken if token is unknown, has expired or has
+// already been used. Once the password is reset, token and every other
+// token issued for the user can no longer be used.
+//
+// A token that's rejected because newPlain doesn't satisfy the policy can
+// still be used again with a better password.
+func (s *Store) ResetPassword(ctx context.Context, token, newPlain string) (err error) {
+	ctx, op, err := s.startOp(ctx, "ResetPassword")
+	if err != nil {
+		return err
+	}
+	defer func() { op.end(err, 1) }()
+
+	if newPlain == "" {
+		return fmt.Errorf("reset password: %w", ErrEmptyPassword)
+	}
+	if err := s.PasswordPolicy.Validate(newPlain); err != nil {
+		return fmt.Errorf("reset password: %w", err)
+	}
+	hash, err := s.hashPassword(newPlain)
+	if err != nil {
+		return fmt.Errorf("reset password: %w", err)
+	}
+
+	var id int
+	now := time.Now().UTC()
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		var expiresAt time.Time
+		err := tx.QueryRowContext(ctx, selectResetTokenQuery(s.dialect), hashResetToken(token)).Scan(&id, &expiresAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidResetToken
+		}
+		if err != nil {
+			return fmt.Errorf("reset password: %w", err)
+		}
+		if !now.Before(expiresAt) {
+			return ErrInvalidResetToken
+		}
+
+		// Deleting the token is what makes it single use: of two resets
+		// that read it concurrently, only one gets to delete it.
+		res, err := tx.ExecContext(ctx, deleteResetTokenQuery(s.dialect), hashResetToken(token))
+		if err != nil {
+			return fmt.Errorf("reset password: %w", err)
+		}
+		numAffected, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("reset password: %w", err)
+		}
+		if numAffected == 0 {
+			return ErrInvalidResetToken
+		}
+
+		res, err = tx.ExecContext(ctx, updatePasswordQuery(s.dialect, s.table()), hash, now, id)
+		if err != nil {
+			return fmt.Errorf("reset password: %w", err)
+		}
+		if err := checkUserAffected("reset password", res); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, deleteUserResetTokensQuery(s.dialect), id); err != nil {
+			return fmt.Errorf("reset password: %w", err)
+		}
+		return nil
+	})
+	s.invalidate(id)
+	if err != nil {
+		return err
+	}
+	return s.runHooks(ctx, hookUpdate, &User{Id: id, UpdatedAt: now})
+}
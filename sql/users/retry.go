@@ -0,0 +1,86 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// maxRetries is the number of times withRetry retries an operation that
+// failed with a transient error, and retryBaseDelay is how long it waits
+// before the first retry. The delay doubles for each later retry.
+const (
+	maxRetries     = 3
+	retryBaseDelay = 10 * time.Millisecond
+)
+
+// isTransient reports whether err is an error that's safe to retry,
+// because the database rolled back the statement or transaction that
+// caused it.
+func isTransient(err error) bool {
+	// MySQL reports deadlocks with error 1213 (ER_LOCK_DEADLOCK) and lock
+	// wait timeouts with 1205 (ER_LOCK_WAIT_TIMEOUT).
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return myErr.Number == 1213 || myErr.Number == 1205
+	}
+
+	// Postgres reports serialization failures with SQLSTATE 40001 and
+	// deadlocks with 40P01.
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "40001" || pqErr.Code == "40P01"
+	}
+
+	return false
+}
+
+// withRetry runs fn, retrying it up to maxRetries times if it fails with
+// a transient error such as a deadlock. Retries are delayed by an
+// exponential backoff with jitter, so that the transactions that
+// deadlocked don't collide again straight away. Any other error is
+// returned immediately, as is ctx's error if it's done while waiting.
+// Nothing is retried by stores passed to the function given to WithinTx.
+func (s *Store) withRetry(ctx context.Context, fn func() error) error {
+	// Once a statement in a transaction has failed, the transaction has
+	// to be rolled back, so there's no point retrying it.
+	if s.tx != nil {
+		return fn()
+	}
+
+	delay := retryBaseDelay
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt == maxRetries || !isTransient(err) {
+			return err
+		}
+
+		// Wait for somewhere between half of and the full delay.
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+// execRetry is execContext run with withRetry, for statements that write
+// to the database.
+func (s *Store) execRetry(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	var res sql.Result
+	err := s.withRetry(ctx, func() error {
+		var err error
+		res, err = s.execContext(ctx, query, args...)
+		return err
+	})
+	return res, err
+}
@@ -0,0 +1,81 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{ErrUserNotFound, false},
+		{&mysql.MySQLError{Number: 1213}, true},
+		{fmt.Errorf("update user: %w", &mysql.MySQLError{Number: 1205}), true},
+		{&mysql.MySQLError{Number: 1062}, false},
+		{&pq.Error{Code: "40001"}, true},
+		{&pq.Error{Code: "40P01"}, true},
+		{&pq.Error{Code: "23505"}, false},
+	}
+	for _, tt := range tests {
+		if got := isTransient(tt.err); got != tt.want {
+			t.Errorf("isTransient(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	deadlock := &mysql.MySQLError{Number: 1213}
+	errOther := errors.New("syntax error")
+	tests := []struct {
+		name      string
+		errs      []error // returned by each call in turn, then nil
+		inTx      bool
+		wantCalls int
+		wantErr   error
+	}{
+		{"succeeds", nil, false, 1, nil},
+		{"retries deadlocks", []error{deadlock, deadlock}, false, 3, nil},
+		{"gives up", []error{deadlock, deadlock, deadlock, deadlock, deadlock}, false, maxRetries + 1, deadlock},
+		{"other error", []error{errOther}, false, 1, errOther},
+		{"in a transaction", []error{deadlock}, true, 1, deadlock},
+	}
+	for _, tt := range tests {
+		s := &Store{}
+		if tt.inTx {
+			s.tx = new(sql.Tx)
+		}
+		calls := 0
+		err := s.withRetry(context.Background(), func() error {
+			calls++
+			if calls <= len(tt.errs) {
+				return tt.errs[calls-1]
+			}
+			return nil
+		})
+		if !errors.Is(err, tt.wantErr) || calls != tt.wantCalls {
+			t.Errorf("%s: err = %v after %d calls, want %v after %d", tt.name, err, calls, tt.wantErr, tt.wantCalls)
+		}
+	}
+}
+
+func TestWithRetryCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls := 0
+	err := (&Store{}).withRetry(ctx, func() error {
+		calls++
+		return &pq.Error{Code: "40P01"}
+	})
+	if !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Errorf("err = %v after %d calls, want context.Canceled after 1", err, calls)
+	}
+}
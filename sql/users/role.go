@@ -0,0 +1,174 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// The roles a user can have. Users have RoleUser unless they're given
+// another role.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// roles is the allow-list of valid roles.
+var roles = map[string]bool{
+	RoleUser:  true,
+	RoleAdmin: true,
+}
+
+// ListUsersByRole is like ListUsers, but only lists users with the given
+// role. It returns an error matching ErrInvalidRole if role isn't a valid
+// role.
+func (s *Store) ListUsersByRole(ctx context.Context, role string, opts ListOptions) (users []*User, err error) {
+	if !roles[role] {
+		return nil, fmt.Errorf("list users by role: %w", ErrInvalidRole)
+	}
+
+	// Add the role condition to a copy of any filter in opts, so that the
+	// caller's filter isn't changed.
+	filter := s.NewBuilder()
+	if opts.Filter != nil {
+		filter.conds = append(filter.conds, opts.Filter.conds...)
+		filter.err = opts.Filter.err
+	}
+	opts.Filter = filter.Where("role", "=", role)
+
+	return s.ListUsers(ctx, opts)
+}
+
+// SetRole gives the user with the given id the given role, and sets its
+// updated_at time to the current time. It returns an error matching
+// ErrInvalidRole if role isn't a valid role, and ErrUserNotFound if no
+// such user exists.
+func (s *Store) SetRole(ctx context.Context, id int, role string) (err error) {
+	ctx, op, err := s.startOp(ctx, "SetRole")
+	if err != nil {
+		return err
+	}
+	defer func() { op.end(err, 1) }()
+
+	if !roles[role] {
+		return fmt.Errorf("set role: %w", ErrInvalidRole)
+	}
+
+	now := time.Now().UTC()
+	res, err := s.execRetry(ctx, updateRoleQuery(s.dialect, s.table()), role, now, id)
+	s.invalidate(id)
+	if err != nil {
+		return fmt.Errorf("set role: %w", err)
+	}
+	if err := checkUserAffected("set role", res); err != nil {
+		return err
+	}
+	return s.runHooks(ctx, hookUpdate, &User{Id: id, Role: role, UpdatedAt: now})
+}
+
+// roleBatchSize is the number of users whose roles are set by each
+// statement run by BulkSetRoles. Each user takes three placeholders.
+const roleBatchSize = 1000
+
+// BulkSetRoles gives each user in userRoles, which maps user ids to
+// roles, their role, and sets their updated_at time to the current time,
+// like SetRole but with a single statement for up to roleBatchSize users.
+// It returns an error matching ErrInvalidRole, without changing any
+// users, if any of the roles isn't a valid role. Ids that don't belong to
+// a user, or belong to a deleted one, are skipped.
+//
+// The statements are run in a single transaction, which is retried if it
+// fails with a transient error, so either every user's role is set or
+// none are. Once it commits, the hooks are told about each user whose
+// role was set, for which, if s has any hooks, each statement is preceded
+// by one that selects and locks the users it updates.
+func (s *Store) BulkSetRoles(ctx context.Context, userRoles map[int]string) (err error) {
+	ctx, op, err := s.startOp(ctx, "BulkSetRoles")
+	if err != nil {
+		return err
+	}
+	var updated int
+	defer func() { op.end(err, updated) }()
+
+	ids := make([]int, 0, len(userRoles))
+	for id, role := range userRoles {
+		if !roles[role] {
+			return fmt.Errorf("bulk set roles: %w: %q", ErrInvalidRole, role)
+		}
+		ids = append(ids, id)
+	}
+	// Sorting the ids makes the statements the same for the same users,
+	// and has concurrent calls lock the users' rows in the same order.
+	sort.Ints(ids)
+
+	now := time.Now().UTC()
+	var changed []int
+	err = s.withRetry(ctx, func() error {
+		updated = 0
+		changed = nil
+		return s.withTx(ctx, func(tx *sql.Tx) error {
+			return s.updateRoles(ctx, tx, ids, userRoles, now, &updated, &changed)
+		})
+	})
+	s.invalidate(ids...)
+	if err != nil {
+		return err
+	}
+
+	changedUsers := make([]*User, len(changed))
+	for i, id := range changed {
+		changedUsers[i] = &User{Id: id, Role: userRoles[id], UpdatedAt: now}
+	}
+	return s.runHooksForEach(ctx, hookUpdate, changedUsers)
+}
+
+// updateRoles runs the updates for BulkSetRoles in tx, adding the number
+// of users updated to updated. If s has hooks, only the users that
+// lockUserIDsQuery selects are updated, and their ids are appended to
+// changed.
+func (s *Store) updateRoles(ctx context.Context, tx *sql.Tx, ids []int, userRoles map[int]string, now time.Time, updated *int, changed *[]int) error {
+	for start := 0; start < len(ids); start += roleBatchSize {
+		end := start + roleBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batch := ids[start:end]
+
+		if len(s.Hooks) > 0 {
+			lockArgs := make([]interface{}, len(batch))
+			for i, id := range batch {
+				lockArgs[i] = id
+			}
+			locked, err := queryIDs(ctx, tx, lockUserIDsQuery(s.dialect, s.table(), len(batch)), lockArgs...)
+			if err != nil {
+				return fmt.Errorf("bulk set roles: %w", err)
+			}
+			if len(locked) == 0 {
+				continue
+			}
+			batch = locked
+			*changed = append(*changed, locked...)
+		}
+
+		args := make([]interface{}, 0, 1+3*len(batch))
+		for _, id := range batch {
+			args = append(args, id, userRoles[id])
+		}
+		args = append(args, now)
+		for _, id := range batch {
+			args = append(args, id)
+		}
+		res, err := tx.ExecContext(ctx, updateRolesQuery(s.dialect, s.table(), len(batch)), args...)
+		if err != nil {
+			return fmt.Errorf("bulk set roles: %w", err)
+		}
+		numAffected, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("bulk set roles: %w", err)
+		}
+		*updated += int(numAffected)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package users
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// A structField is a field of a struct that scanInto scans a column into,
+// as described by the field's db tag. The tag is the column's name,
+// optionally followed by comma separated options:
+//
+//   - json: the column holds JSON, which is decoded into the field. NULL
+//     and the JSON null leave the field at its zero value, except that
+//     maps are made empty rather than nil.
+//   - nullzero: NULL is read as the field's zero value, for columns that
+//     can be NULL whose fields aren't pointers or sql.Null types, such as
+//     a string that's empty when NULL.
+//
+// Fields without a db tag, or whose tag is "-", aren't scanned into.
+type structField struct {
+	index    []int
+	json     bool
+	nullZero bool
+}
+
+// structFieldsCache caches the result of structFields for each type, since
+// the same few types are scanned into over and over.
+var structFieldsCache sync.Map // map[reflect.Type]map[string]structField
+
+// structFields returns the fields of struct type t that columns are
+// scanned into, keyed by column name. The fields of embedded structs
+// without db tags are included as if they were t's own.
+func structFields(t reflect.Type) map[string]structField {
+	if fields, ok := structFieldsCache.Load(t); ok {
+		return fields.(map[string]structField)
+	}
+
+	fields := make(map[string]structField)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, ok := f.Tag.Lookup("db")
+		if !ok && f.Anonymous && f.Type.Kind() == reflect.Struct {
+			for col, ef := range structFields(f.Type) {
+				ef.index = append([]int{i}, ef.index...)
+				fields[col] = ef
+			}
+			continue
+		}
+		if !ok || tag == "-" || !f.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		sf := structField{index: []int{i}}
+		for _, opt := range strings.Split(opts, ",") {
+			switch opt {
+			case "json":
+				sf.json = true
+			case "nullzero":
+				sf.nullZero = true
+			}
+		}
+		fields[name] = sf
+	}
+
+	structFieldsCache.Store(t, fields)
+	return fields
+}
+
+// scanInto scans the current row of rows into the fields of the struct
+// that dest points to, matching the row's columns to the fields by the
+// names in their db tags, so that the columns can be selected in any
+// order. It's an error for the row to have a column that none of the
+// fields are tagged with. Fields whose columns aren't in the row are left
+// as they are.
+func scanInto(rows *sql.Rows, dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("scan into %T: not a pointer to a struct", dest)
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	return scanColumns(rows, cols, v.Elem())
+}
+
+// scanColumns is scanInto for a row whose columns are cols, scanning into
+// the struct v, which must be addressable.
+func scanColumns(row rowScanner, cols []string, v reflect.Value) error {
+	fields := structFields(v.Type())
+
+	// NULL can't be scanned into the fields of nullzero columns, so
+	// they're scanned into pointers to their types, which are copied to
+	// the fields afterwards.
+	type nullZeroField struct{ field, ptr reflect.Value }
+	var nullZeros []nullZeroField
+
+	// Scan copies the columns in the current row into the values pointed
+	// at by dest. The number of values in dest must be the same as the
+	// number of columns in Rows.
+	dest := make([]interface{}, len(cols))
+	for i, col := range cols {
+		f, ok := fields[col]
+		if !ok {
+			return fmt.Errorf("no field of %s for column %q", v.Type(), col)
+		}
+		fv := v.FieldByIndex(f.index)
+		switch {
+		case f.json:
+			dest[i] = jsonField{fv}
+		case f.nullZero:
+			ptr := reflect.New(reflect.PointerTo(fv.Type()))
+			nullZeros = append(nullZeros, nullZeroField{fv, ptr})
+			dest[i] = ptr.Interface()
+		default:
+			dest[i] = fv.Addr().Interface()
+		}
+	}
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+
+	for _, nz := range nullZeros {
+		if p := nz.ptr.Elem(); p.IsNil() {
+			nz.field.SetZero()
+		} else {
+			nz.field.Set(p.Elem())
+		}
+	}
+	return nil
+}
+
+// A jsonField is a sql.Scanner that decodes a JSON column into the field
+// of a struct tagged with the json option.
+type jsonField struct{ v reflect.Value }
+
+// Scan implements sql.Scanner. Drivers return JSON columns as []byte or
+// string depending on the database.
+func (f jsonField) Scan(src interface{}) error {
+	var b []byte
+	switch src := src.(type) {
+	case nil:
+		b = []byte("null")
+	case []byte:
+		b = src
+	case string:
+		b = []byte(src)
+	default:
+		return fmt.Errorf("decode json: unsupported type %T", src)
+	}
+
+	ptr := reflect.New(f.v.Type())
+	if err := json.Unmarshal(b, ptr.Interface()); err != nil {
+		return fmt.Errorf("decode json: %w", err)
+	}
+	if ptr.Elem().Kind() == reflect.Map && ptr.Elem().IsNil() {
+		ptr.Elem().Set(reflect.MakeMap(f.v.Type()))
+	}
+	f.v.Set(ptr.Elem())
+	return nil
+}
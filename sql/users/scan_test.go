@@ -0,0 +1,142 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestDB returns a migrated in-memory SQLite database, like
+// dbtest.NewTestDB, which tests within the package can't import.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open(SQLite.DriverName(), ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxIdleTime(0)
+	t.Cleanup(func() { db.Close() })
+	if err := Migrate(context.Background(), db, SQLite); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// queryRows runs query on db and returns its rows, positioned on the
+// first one. Since db has a single connection, the rows must be closed
+// before db is queried again.
+func queryRows(t *testing.T, db *sql.DB, query string) *sql.Rows {
+	t.Helper()
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rows.Close() })
+	if !rows.Next() {
+		t.Fatalf("%s selected no rows: %v", query, rows.Err())
+	}
+	return rows
+}
+
+func TestScanUser(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	_, err := db.Exec("insert into users (username, email, password, role, created_at, updated_at, last_login_at, metadata)"+
+		" values (?, ?, ?, ?, ?, ?, ?, ?), (?, ?, ?, ?, ?, ?, ?, ?)",
+		"alice", "alice@example.com", "hash", RoleAdmin, now, now, now, `{"theme":"dark"}`,
+		"bob", nil, nil, RoleUser, now, now, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice, err := scanUser(db.QueryRow("select " + userColumns + " from users where username = 'alice'"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.Username != "alice" || alice.Email == nil || *alice.Email != "alice@example.com" || alice.Password != "hash" ||
+		alice.Role != RoleAdmin || alice.Version != 1 || !alice.CreatedAt.Equal(now) || alice.LastLoginAt == nil ||
+		alice.Metadata["theme"] != "dark" {
+		t.Errorf("scanned alice as %+v", alice)
+	}
+
+	// Null columns leave their fields empty.
+	bob, err := scanUser(db.QueryRow("select " + userColumns + " from users where username = 'bob'"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bob.Email != nil || bob.Password != "" || bob.LastLoginAt != nil || bob.LockedUntil != nil || len(bob.Metadata) != 0 {
+		t.Errorf("scanned bob as %+v", bob)
+	}
+
+	if _, err := scanUser(db.QueryRow("select " + userColumns + " from users where username = 'carol'")); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("scanning no rows = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestScanInto(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	_, err := db.Exec("insert into users (username, email, password, role, created_at, updated_at, metadata)"+
+		" values (?, ?, ?, ?, ?, ?, ?)", "alice", "alice@example.com", nil, RoleAdmin, now, now, `{"theme":"dark"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The columns are in a different order from userColumns, and some of
+	// them aren't selected at all.
+	rows := queryRows(t, db, "select metadata, role, password, email, username, id from users")
+	var u User
+	u.Version = 7
+	if err := scanInto(rows, &u); err != nil {
+		t.Fatal(err)
+	}
+	want := User{
+		Id:       1,
+		Username: "alice",
+		Email:    func() *string { s := "alice@example.com"; return &s }(),
+		Role:     RoleAdmin,
+		Version:  7,
+		Metadata: map[string]interface{}{"theme": "dark"},
+	}
+	if !reflect.DeepEqual(u, want) {
+		t.Errorf("scanned %+v, want %+v", u, want)
+	}
+	rows.Close()
+
+	// Embedded structs' fields are scanned into as if they were the outer
+	// struct's own.
+	var wrapped struct {
+		User
+		Extra string `db:"extra"`
+	}
+	rows = queryRows(t, db, "select 'x' as extra, username, created_at from users")
+	if err := scanInto(rows, &wrapped); err != nil {
+		t.Fatal(err)
+	}
+	if wrapped.Extra != "x" || wrapped.Username != "alice" || !wrapped.CreatedAt.Equal(now) {
+		t.Errorf("scanned %+v", wrapped)
+	}
+}
+
+func TestScanIntoErrors(t *testing.T) {
+	db := newTestDB(t)
+	db.Exec("insert into users (username, role, created_at, updated_at) values ('alice', 'user', 0, 0)")
+
+	rows := queryRows(t, db, "select id, username, 1 as unknown from users")
+	var u User
+	if err := scanInto(rows, &u); err == nil || !strings.Contains(err.Error(), `"unknown"`) {
+		t.Errorf("scanInto with an unknown column = %v, want an error naming it", err)
+	}
+	if err := scanInto(rows, u); err == nil {
+		t.Error("scanInto a struct rather than a pointer to one didn't fail")
+	}
+	var n int
+	if err := scanInto(rows, &n); err == nil {
+		t.Error("scanInto a pointer to an int didn't fail")
+	}
+}
@@ -0,0 +1,89 @@
+package users
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// defaultSearchLimit is the number of users SearchUsersByPrefix returns
+// when it's given a non-positive limit.
+const defaultSearchLimit = 20
+
+// SearchUsersByPrefix returns up to limit users whose usernames start with
+// prefix, ordered by username, such as for autocompleting usernames. If
+// limit is not positive, defaultSearchLimit is used instead.
+//
+// Any % or _ characters in prefix are matched literally rather than being
+// treated as like wildcards.
+func (s *Store) SearchUsersByPrefix(ctx context.Context, prefix string, limit int) (users []*User, err error) {
+	ctx, op, err := s.startOp(ctx, "SearchUsersByPrefix")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { op.end(err, len(users)) }()
+
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+
+	pattern := escapeLike(prefix) + "%"
+	users, err = s.queryUsers(ctx, searchUsersByPrefixQuery(s.dialect, s.table()), pattern, limit)
+	if err != nil {
+		return nil, fmt.Errorf("search users by prefix: %w", err)
+	}
+	return users, nil
+}
+
+// Search returns the users whose usernames or emails match term, paged,
+// ordered and filtered by opts like ListUsers. An empty term matches no
+// users.
+//
+// On MySQL and Postgres, Search uses the database's full-text search, so
+// term matches whole words, such as the parts of an email, rather than
+// any substring. It needs the full-text index created by the migrations:
+//
+//	-- MySQL
+//	create fulltext index users_search_idx on users (username, email);
+//	-- Postgres
+//	create index users_search_idx on users using gin
+//	    (to_tsvector('simple', username || ' ' || coalesce(email, '')));
+//
+// MySQL refuses to run the search without the index, while Postgres scans
+// the whole table. Tables other than users, as set by TableName, need an
+// index of their own. MySQL also ignores words shorter than its
+// innodb_ft_min_token_size, which is 3 by default.
+//
+// On SQLite, Search matches term anywhere in the username or email, with
+// any % or _ characters in term matched literally.
+func (s *Store) Search(ctx context.Context, term string, opts ListOptions) (users []*User, err error) {
+	ctx, op, err := s.startOp(ctx, "Search")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { op.end(err, len(users)) }()
+
+	if err := opts.validate(); err != nil {
+		return nil, fmt.Errorf("search: %w", err)
+	}
+	if strings.TrimSpace(term) == "" {
+		return nil, nil
+	}
+
+	where, args := searchCondition(s.dialect, term)
+	if opts.Filter != nil {
+		filter, filterArgs := opts.Filter.where(s.dialect, len(args)+1)
+		where += " and " + filter
+		args = append(args, filterArgs...)
+	} else {
+		where += " and deleted_at is null"
+	}
+
+	cols := opts.columns()
+	query := listFilteredUsersQuery(s.dialect, s.table(), strings.Join(cols, ", "), where, len(args), opts.orderBy())
+	users, err = s.queryUsers(ctx, query, append(args, opts.limit(), opts.Offset)...)
+	if err != nil {
+		return nil, fmt.Errorf("search: %w", err)
+	}
+	return users, nil
+}
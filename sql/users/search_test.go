@@ -0,0 +1,96 @@
+package users_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+func TestSearchUsersByPrefix(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+	createUsers(t, s, "alex", "al_ice", "alfred", "bob", "albert")
+
+	tests := []struct {
+		prefix string
+		limit  int
+		want   string
+	}{
+		{"al", 0, "al_ice albert alex alfred"},
+		{"al", 2, "al_ice albert"},
+		{"al_", 0, "al_ice"},
+		{"%", 0, ""},
+		{"b", 0, "bob"},
+	}
+	for _, tt := range tests {
+		list, err := s.SearchUsersByPrefix(ctx, tt.prefix, tt.limit)
+		if err != nil {
+			t.Errorf("SearchUsersByPrefix(%q, %d): %v", tt.prefix, tt.limit, err)
+			continue
+		}
+		if got := usernames(list); got != tt.want {
+			t.Errorf("SearchUsersByPrefix(%q, %d) = %q, want %q", tt.prefix, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+	for _, u := range []*users.User{
+		{Username: "alice", Email: strptr("alice@example.com")},
+		{Username: "bob", Email: strptr("bob@corp.example")},
+		{Username: "carol"},
+		{Username: "dave_corp"},
+	} {
+		u.Password = "password123"
+		if _, err := s.CreateUser(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sorted := users.ListOptions{SortBy: users.SortByUsername}
+	tests := []struct {
+		term string
+		opts users.ListOptions
+		want string
+	}{
+		{"corp", sorted, "bob dave_corp"},
+		{"EXAMPLE", sorted, "alice bob"},
+		{"example", users.ListOptions{SortBy: users.SortByUsername, Limit: 1, Offset: 1}, "bob"},
+		{"_", sorted, "dave_corp"},
+		{"  ", sorted, ""},
+		{"nobody", sorted, ""},
+	}
+	for _, tt := range tests {
+		list, err := s.Search(ctx, tt.term, tt.opts)
+		if err != nil {
+			t.Errorf("Search(%q): %v", tt.term, err)
+			continue
+		}
+		if got := usernames(list); got != tt.want {
+			t.Errorf("Search(%q) = %q, want %q", tt.term, got, tt.want)
+		}
+	}
+
+	u, err := s.GetUserByUsername(ctx, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteUser(ctx, u.Id); err != nil {
+		t.Fatal(err)
+	}
+	list, err := s.Search(ctx, "corp", sorted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := usernames(list); got != "dave_corp" {
+		t.Errorf("Search found deleted users: %q", got)
+	}
+
+	if _, err := s.Search(ctx, "corp", users.ListOptions{SortBy: 99}); err == nil {
+		t.Error("Search with invalid options didn't fail")
+	}
+}
@@ -0,0 +1,71 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// seedPassword is the password of every user created by Seed.
+const seedPassword = "password"
+
+// Seed creates n users for development, named user1 to userN with emails
+// such as user1@example.com and the password "password". Users that
+// already exist are skipped, so Seed can safely be run more than once.
+// All of the users are created in a single transaction, and once it
+// commits, s's hooks are told about each user that was created, without
+// its id.
+func Seed(ctx context.Context, s *Store, n int) error {
+	// Every seeded user has the same password, so it only needs to be
+	// hashed once.
+	hash, err := s.hashPassword(seedPassword)
+	if err != nil {
+		return fmt.Errorf("seed: %w", err)
+	}
+
+	now := time.Now().UTC()
+	query := insertUserIfNotExistsQuery(s.dialect, s.table())
+
+	var created []*User
+	err = s.WithTx(ctx, func(tx *sql.Tx) error {
+		created = nil
+		// Prepare the insert once since it's run for every user.
+		stmt, err := tx.PrepareContext(ctx, query)
+		if err != nil {
+			return fmt.Errorf("seed: %w", err)
+		}
+		defer stmt.Close()
+
+		for i := 1; i <= n; i++ {
+			username := "user" + strconv.Itoa(i)
+			email := username + "@example.com"
+			res, err := stmt.ExecContext(ctx, username, email, hash, RoleUser, now, now, nil)
+			if err != nil {
+				return fmt.Errorf("seed: %s: %w", username, err)
+			}
+			// Users that already exist aren't inserted.
+			numAffected, err := res.RowsAffected()
+			if err != nil {
+				return fmt.Errorf("seed: %s: %w", username, err)
+			}
+			if numAffected == 1 {
+				created = append(created, &User{
+					Username:  username,
+					Email:     &email,
+					Password:  hash,
+					Role:      RoleUser,
+					CreatedAt: now,
+					UpdatedAt: now,
+					Version:   1,
+				})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.runHooksForEach(ctx, hookCreate, created)
+}
@@ -0,0 +1,85 @@
+package users
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrStoreClosed is returned by a Store's methods once the store has been
+// shut down with Shutdown.
+var ErrStoreClosed = errors.New("store is closed")
+
+// acquire registers the start of an operation, so that Shutdown and
+// Reconnect wait for it to finish. If s is reconnecting, acquire waits
+// until it's done, or until ctx is done, in which case ctx's error is
+// returned. It returns ErrStoreClosed if s has been shut down. release
+// must be called once the operation is done.
+func (s *Store) acquire(ctx context.Context) error {
+	s = s.root()
+	for {
+		// Holding the read lock while adding to inflight means that
+		// Shutdown and Reconnect, which set closed and reconnecting with
+		// the write lock held, can't start waiting on inflight until any
+		// concurrent adds are done.
+		s.mu.RLock()
+		if s.closed {
+			s.mu.RUnlock()
+			return ErrStoreClosed
+		}
+		reconnecting := s.reconnecting
+		if reconnecting == nil {
+			s.inflight.Add(1)
+			s.mu.RUnlock()
+			return nil
+		}
+		s.mu.RUnlock()
+
+		// Operations don't start until Reconnect has replaced the
+		// database they'd run against.
+		select {
+		case <-reconnecting:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release registers the end of an operation started with acquire.
+func (s *Store) release() {
+	s = s.root()
+	s.inflight.Done()
+}
+
+// Shutdown gracefully shuts down s. New operations are refused with
+// ErrStoreClosed straight away, while operations that are already running
+// are given until ctx is done to finish. The prepared statements and the
+// underlying *sql.DB are then closed, even if ctx is done first, in which
+// case ctx's error is returned.
+func (s *Store) Shutdown(ctx context.Context) error {
+	s = s.root()
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(drained)
+	}()
+
+	var ctxErr error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		ctxErr = ctx.Err()
+	}
+
+	closeErr := s.Close()
+	if err := s.conn().Close(); err != nil && closeErr == nil {
+		closeErr = err
+	}
+	if ctxErr != nil {
+		return ctxErr
+	}
+	return closeErr
+}
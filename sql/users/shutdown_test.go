@@ -0,0 +1,90 @@
+package users_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+// startBlockedCall starts a call of s's methods that runs until release
+// is closed, and returns once it's running, along with a channel that
+// gets the call's error.
+func startBlockedCall(t *testing.T, s *users.Store, release <-chan struct{}) <-chan error {
+	t.Helper()
+	running := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- s.WithinTx(context.Background(), func(ts *users.Store) error {
+			close(running)
+			<-release
+			_, err := ts.CreateUser(context.Background(), &users.User{Username: "alice", Password: "password123"})
+			return err
+		})
+	}()
+	<-running
+	return done
+}
+
+// waitClosed waits until s refuses new calls with ErrStoreClosed. Until
+// then, the calls it tries wait for the connection held by the blocked
+// call, so they're given a short timeout.
+func waitClosed(t *testing.T, s *users.Store) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		_, err := s.CountUsers(ctx)
+		cancel()
+		if errors.Is(err, users.ErrStoreClosed) {
+			return
+		}
+	}
+	t.Fatal("store never refused new calls")
+}
+
+func TestShutdownDrains(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	release := make(chan struct{})
+	call := startBlockedCall(t, s, release)
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.Shutdown(context.Background()) }()
+	waitClosed(t, s)
+
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned %v while a call was running", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The running call is allowed to finish before the database is
+	// closed.
+	close(release)
+	if err := <-call; err != nil {
+		t.Errorf("running call failed: %v", err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("Shutdown = %v", err)
+	}
+}
+
+func TestShutdownGivesUp(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	release := make(chan struct{})
+	call := startBlockedCall(t, s, release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown = %v, want context.DeadlineExceeded", err)
+	}
+
+	if _, err := s.CountUsers(context.Background()); !errors.Is(err, users.ErrStoreClosed) {
+		t.Errorf("CountUsers after Shutdown = %v, want ErrStoreClosed", err)
+	}
+	close(release)
+	<-call
+}
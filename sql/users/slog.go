@@ -0,0 +1,38 @@
+package users
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// WithSlog makes s log every call of its methods to logger: successful
+// calls at debug level and failed ones at error level. Each record has
+// the method's name, how long the call took, the number of rows it read
+// or wrote and any error as attributes, along with the request id set on
+// the call's context with ContextWithRequestID, if there is one. Records
+// are logged with the call's context, so handlers can pick up its trace.
+// A nil logger stops s from logging. It returns s so that it can be
+// chained onto NewStore.
+func (s *Store) WithSlog(logger *slog.Logger) *Store {
+	s.slog = logger
+	return s
+}
+
+// logOp logs a call of the method called op to logger, for WithSlog.
+func logOp(ctx context.Context, logger *slog.Logger, op string, dur time.Duration, rows int, err error) {
+	attrs := []slog.Attr{
+		slog.String("operation", op),
+		slog.Duration("duration", dur),
+	}
+	if id := requestIDFromContext(ctx); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+		logger.LogAttrs(ctx, slog.LevelError, "store operation failed", attrs...)
+		return
+	}
+	attrs = append(attrs, slog.Int("rows", rows))
+	logger.LogAttrs(ctx, slog.LevelDebug, "store operation", attrs...)
+}
@@ -0,0 +1,85 @@
+package users_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+// A ctxKey is the key of a context value that tests check handlers see.
+type ctxKey struct{}
+
+// A ctxHandler is a slog handler that records the value of ctxKey in the
+// context of each record it handles.
+type ctxHandler struct {
+	slog.Handler
+	values *[]interface{}
+}
+
+func (h ctxHandler) Handle(ctx context.Context, r slog.Record) error {
+	*h.values = append(*h.values, ctx.Value(ctxKey{}))
+	return h.Handler.Handle(ctx, r)
+}
+
+func TestWithSlog(t *testing.T) {
+	var buf bytes.Buffer
+	var values []interface{}
+	h := ctxHandler{slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}), &values}
+	s := dbtest.NewTestStore(t).WithSlog(slog.New(h))
+	ctx := context.WithValue(users.ContextWithRequestID(context.Background(), "req-7"), ctxKey{}, "traced")
+
+	id, err := s.CreateUser(ctx, &users.User{Username: "alice", Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetUserByID(ctx, int(id)+1); !errors.Is(err, users.ErrUserNotFound) {
+		t.Fatalf("err = %v, want ErrUserNotFound", err)
+	}
+
+	var records []map[string]interface{}
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var r map[string]interface{}
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, r)
+	}
+	if len(records) != 2 {
+		t.Fatalf("logged %d records, want 2", len(records))
+	}
+
+	created, failed := records[0], records[1]
+	if created["level"] != "DEBUG" || created["operation"] != "CreateUser" || created["rows"] != 1.0 ||
+		created["request_id"] != "req-7" || created["duration"] == nil {
+		t.Errorf("CreateUser record = %v", created)
+	}
+	if failed["level"] != "ERROR" || failed["operation"] != "GetUserByID" || failed["error"] != users.ErrUserNotFound.Error() {
+		t.Errorf("GetUserByID record = %v", failed)
+	}
+	if _, ok := failed["rows"]; ok {
+		t.Errorf("failed call's record has rows: %v", failed)
+	}
+
+	// Records are handled with the call's context.
+	for _, v := range values {
+		if v != "traced" {
+			t.Errorf("handler saw context value %v, want the call's", v)
+		}
+	}
+
+	buf.Reset()
+	s.WithSlog(nil)
+	if _, err := s.CountUsers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("logged %q after WithSlog(nil)", buf.String())
+	}
+}
@@ -0,0 +1,117 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Prepare prepares the statements for the store's most frequently run
+// queries, so that the database doesn't have to parse them again every
+// time they're run. Queries that haven't been prepared are still run,
+// just without a prepared statement.
+//
+// Close should be called to release the prepared statements once the
+// store is no longer needed.
+func (s *Store) Prepare(ctx context.Context) error {
+	s = s.root()
+	if err := s.checkTable(); err != nil {
+		return fmt.Errorf("prepare: %w", err)
+	}
+
+	queries := []string{
+		insertUserQuery(s.dialect, s.table()),
+		selectUserByIDQuery(s.dialect, s.table()),
+		selectUserByUsernameQuery(s.dialect, s.table()),
+		selectUserByEmailQuery(s.dialect, s.table()),
+		updateUserQuery(s.dialect, s.table(), true),
+		updateUserQuery(s.dialect, s.table(), false),
+		deleteUserQuery(s.dialect, s.table()),
+		listUsersQuery(s.dialect, s.table(), userColumns, ListOptions{}.orderBy()),
+	}
+
+	db := s.conn()
+	stmts := make(map[string]*sql.Stmt, len(queries))
+	for _, query := range queries {
+		// PrepareContext creates a prepared statement for later queries or
+		// executions. Multiple queries or executions may be run concurrently
+		// from the returned statement. The caller must call the statement's
+		// Close method when the statement is no longer needed.
+		stmt, err := db.PrepareContext(ctx, query)
+		if err != nil {
+			closeStmts(stmts)
+			return fmt.Errorf("prepare: %w", err)
+		}
+		stmts[query] = stmt
+	}
+
+	s.mu.Lock()
+	old := s.stmts
+	s.stmts = stmts
+	s.mu.Unlock()
+	closeStmts(old)
+
+	return nil
+}
+
+// Close closes the statements prepared by Prepare. It doesn't close the
+// store's underlying *sql.DB.
+func (s *Store) Close() error {
+	s = s.root()
+	s.mu.Lock()
+	stmts := s.stmts
+	s.stmts = nil
+	s.mu.Unlock()
+
+	return closeStmts(stmts)
+}
+
+// closeStmts closes all of stmts, returning the first error encountered.
+func closeStmts(stmts map[string]*sql.Stmt) error {
+	var firstErr error
+	for _, stmt := range stmts {
+		if err := stmt.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// stmt returns the prepared statement for query, or nil if query hasn't
+// been prepared, or the call that ctx belongs to has a connection
+// reserved, since prepared statements run on a connection of their own.
+func (s *Store) stmt(ctx context.Context, query string) *sql.Stmt {
+	if reservedConn(ctx) != nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.stmts[query]
+}
+
+// execContext runs query with ExecContext, using its prepared statement
+// if there is one.
+func (s *Store) execContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if stmt := s.stmt(ctx, query); stmt != nil {
+		return stmt.ExecContext(ctx, args...)
+	}
+	return s.querier(ctx).ExecContext(ctx, query, args...)
+}
+
+// queryContext runs query with QueryContext, using its prepared statement
+// if there is one.
+func (s *Store) queryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if stmt := s.stmt(ctx, query); stmt != nil {
+		return stmt.QueryContext(ctx, args...)
+	}
+	return s.querier(ctx).QueryContext(ctx, query, args...)
+}
+
+// queryRowContext runs query with QueryRowContext, using its prepared
+// statement if there is one.
+func (s *Store) queryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	if stmt := s.stmt(ctx, query); stmt != nil {
+		return stmt.QueryRowContext(ctx, args...)
+	}
+	return s.querier(ctx).QueryRowContext(ctx, query, args...)
+}
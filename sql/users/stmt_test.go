@@ -0,0 +1,117 @@
+package users_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+func TestPrepare(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+	if err := s.Prepare(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The store's methods work the same with their statements prepared.
+	id := createUsers(t, s, "alice")[0]
+	u, err := s.GetUserByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Role = users.RoleAdmin
+	if err := s.UpdateUser(ctx, u); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetUserByUsername(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Preparing again replaces the statements, and closing them goes
+	// back to running the queries unprepared.
+	if err := s.Prepare(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteUser(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// BenchmarkCreateUser compares inserting users with and without the
+// prepared insert statement. Passwords aren't hashed, so that the time
+// spent on the statement isn't drowned out by bcrypt.
+func BenchmarkCreateUser(b *testing.B) {
+	for _, prepared := range []bool{false, true} {
+		name := "Unprepared"
+		if prepared {
+			name = "Prepared"
+		}
+		b.Run(name, func(b *testing.B) {
+			s := dbtest.NewTestStore(b)
+			s.Hasher = plainHasher{}
+			ctx := context.Background()
+			if prepared {
+				if err := s.Prepare(ctx); err != nil {
+					b.Fatal(err)
+				}
+				defer s.Close()
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				u := &users.User{Username: fmt.Sprintf("user%d", i), Password: "password123"}
+				if _, err := s.CreateUser(ctx, u); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGetUserByID(b *testing.B) {
+	for _, prepared := range []bool{false, true} {
+		name := "Unprepared"
+		if prepared {
+			name = "Prepared"
+		}
+		b.Run(name, func(b *testing.B) {
+			s := dbtest.NewTestStore(b)
+			ctx := context.Background()
+			id, err := s.CreateUser(ctx, &users.User{Username: "alice", Password: "password123"})
+			if err != nil {
+				b.Fatal(err)
+			}
+			if prepared {
+				if err := s.Prepare(ctx); err != nil {
+					b.Fatal(err)
+				}
+				defer s.Close()
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := s.GetUserByID(ctx, int(id)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// A plainHasher is a Hasher that doesn't hash, for benchmarks that would
+// otherwise mostly measure hashing.
+type plainHasher struct{}
+
+func (plainHasher) Hash(plain string) (string, error) {
+	return "plain:" + plain, nil
+}
+
+func (plainHasher) Verify(hash, plain string) (bool, error) {
+	return hash == "plain:"+plain, nil
+}
@@ -0,0 +1,879 @@
+// Package users stores users in a MySQL, PostgreSQL or SQLite database,
+// through a Store that renders its queries for the database's dialect.
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// A Store provides access to the users stored in a database, rendering
+// its queries for the database's dialect.
+type Store struct {
+	// Tracer, if set, is used to create a span for every call of the
+	// store's methods, named after the method, such as
+	// Store.GetUserByID.
+	Tracer trace.Tracer
+
+	// RedactPasswords makes the store's read methods clear the Password
+	// of the users they return, so that password hashes can't leak by
+	// accident, such as when a user is encoded as JSON. Authenticate
+	// still works since it checks passwords before they're cleared, but
+	// callers can no longer check passwords themselves with CheckPassword.
+	RedactPasswords bool
+
+	// Logger, if set, is told about every call of the store's methods
+	// that takes longer than SlowThreshold. A nil Logger disables slow
+	// query logging.
+	Logger        Logger
+	SlowThreshold time.Duration
+
+	// DefaultTimeout, if set, limits how long each call of the store's
+	// methods can take when it's given a context without a deadline, so
+	// that a hung query can't hold on to a connection forever. Contexts
+	// that already have a deadline keep it.
+	DefaultTimeout time.Duration
+
+	// Hooks are told about every user the store creates, updates or
+	// deletes, once the change is committed. Errors from hooks are
+	// logged, and only returned by the method that made the change if
+	// FailOnHookError is set, in which case the change has still been
+	// made.
+	Hooks           []Hook
+	FailOnHookError bool
+
+	// Hasher hashes the passwords of the users the store creates and
+	// updates, and is a BcryptHasher if it isn't set. Passwords are
+	// checked with the built-in Hasher that made their hash, whatever
+	// Hasher is, so it can be changed without locking anyone out, and
+	// Authenticate replaces hashes made by the other built-in Hasher
+	// when users sign in.
+	Hasher Hasher
+
+	// CaseInsensitiveUsernames makes usernames that differ only in case,
+	// such as Alice and alice, the same username. Usernames are put in
+	// lower case when users are created or updated, so that the unique
+	// index on username stops them colliding, and are looked up with
+	// lower(username), so users created before the setting was turned on
+	// are still found whatever the case of their usernames. This is
+	// needed on MySQL too, since the migrations give the username column
+	// the case-sensitive utf8mb4_bin collation.
+	//
+	// The lookups can't use the index on username, so an index on
+	// lower(username) should be created to match, such as with "create
+	// unique index users_username_lower_idx on users (lower(username))",
+	// or on MySQL, which needs an extra pair of parentheses around the
+	// expression, "on users ((lower(username)))". Being unique, it also
+	// stops new usernames colliding with existing ones that have upper
+	// case letters.
+	CaseInsensitiveUsernames bool
+
+	// Timeouts, if set, limit how long reads and writes can take, on top
+	// of any deadline the caller's context already has.
+	Timeouts Timeouts
+
+	// AcquireTimeout, if set, limits how long each call of the store's
+	// methods waits for a free connection when it's given a context
+	// without a deadline. Calls that time out waiting fail with
+	// ErrPoolExhausted, rather than waiting behind slow queries for as
+	// long as DefaultTimeout allows.
+	AcquireTimeout time.Duration
+
+	// SkipRecordLogin stops Authenticate from recording the time of each
+	// successful login with RecordLogin, which saves a write per login.
+	SkipRecordLogin bool
+
+	// MaxFailedLogins is the number of failed logins in a row after which
+	// Authenticate locks a user's account for LockoutDuration, or 15
+	// minutes if LockoutDuration isn't set. Accounts are never locked if
+	// MaxFailedLogins isn't set.
+	MaxFailedLogins int
+	LockoutDuration time.Duration
+
+	// DryRun makes the store's destructive methods, such as DeleteUser
+	// and HardDeleteUser, log the statements they would run instead of
+	// running them. The rows the statements would affect are counted
+	// first, so the methods still report ErrUserNotFound as usual.
+	DryRun bool
+
+	// PasswordPolicy is the policy that plaintext passwords given to the
+	// store are checked against before they're hashed. The zero policy
+	// allows any password.
+	PasswordPolicy PasswordPolicy
+
+	// CacheTTL, if set, makes GetUserByID cache the users it reads for
+	// CacheTTL, so that repeated reads of the same user within that time
+	// don't query the database. The store's writes remove the users they
+	// change from the cache, but changes made elsewhere, such as by other
+	// processes or with NamedExec, can go unseen until the TTL runs out.
+	CacheTTL time.Duration
+
+	// FetchSize, if set, limits how many rows the store's methods that
+	// read every user, such as StreamUsers and ExportCSV, hold in memory
+	// at once on Postgres, by reading them through a cursor FetchSize
+	// rows at a time. The cursor needs a transaction, which is held open
+	// until the read is done.
+	FetchSize int
+
+	// IdempotencyWindow is how long CreateUserIdempotent remembers the
+	// user created for an idempotency key, or 24 hours if it isn't set.
+	IdempotencyWindow time.Duration
+
+	// ResetTokenTTL is how long the tokens issued by IssueResetToken can
+	// be used to reset a password, or an hour if it isn't set.
+	ResetTokenTTL time.Duration
+
+	// TableName is the name of the table that users are stored in, which
+	// is users if TableName isn't set. It may be qualified by a schema
+	// name, as in app.users. Since the name is put into queries as is,
+	// the store refuses to run any queries if it isn't a valid table
+	// name; NewStoreWithTable checks the name up front.
+	TableName string
+
+	// RequireTenant makes the store refuse to run any queries unless it
+	// was created with ForTenant, returning ErrTenantRequired instead,
+	// so that code that forgets to scope a store to a tenant can't read
+	// or change every tenant's users.
+	RequireTenant bool
+
+	db      *sql.DB
+	dialect Dialect
+	metrics *metrics     // set by WithMetrics
+	slog    *slog.Logger // set by WithSlog
+	breaker *breaker     // set by WithCircuitBreaker
+	cache   userCache    // used if CacheTTL is set
+
+	mu     sync.RWMutex
+	stmts  map[string]*sql.Stmt // prepared statements keyed by query
+	closed bool                 // set by Shutdown
+
+	inflight sync.WaitGroup // operations that haven't finished yet
+
+	// dsn and cfg are what the store's database was opened with, if it
+	// was opened by OpenStore, so that Reconnect can open it again.
+	dsn string
+	cfg Config
+
+	reconnectMu  sync.Mutex    // held for the whole of Reconnect
+	reconnecting chan struct{} // closed once a running Reconnect is done
+
+	tx *sql.Tx // set for stores passed to the function given to WithinTx
+
+	// savepoints is how many savepoints are open in tx, shared by every
+	// store that runs its queries in tx, so that each savepoint nested in
+	// another can be given a name of its own.
+	savepoints *atomic.Int32
+
+	// tenantID is the tenant that the store's queries are scoped to, if
+	// hasTenant is set, and base is the store that ForTenant was called
+	// on, whose database and state the store shares.
+	tenantID  int64
+	hasTenant bool
+	base      *Store
+
+	pendingHooks []pendingHook // changes made within tx, guarded by mu
+}
+
+// NewStore returns a Store that queries db using dialect d.
+func NewStore(db *sql.DB, d Dialect) *Store {
+	return &Store{db: db, dialect: d}
+}
+
+// NewStoreWithTable is like NewStore, but the returned Store keeps its
+// users in the table called table. It returns ErrInvalidTableName if
+// table isn't a valid table name.
+func NewStoreWithTable(db *sql.DB, d Dialect, table string) (*Store, error) {
+	if !validTableName(table) {
+		return nil, fmt.Errorf("new store: %w: %q", ErrInvalidTableName, table)
+	}
+	return &Store{db: db, dialect: d, TableName: table}, nil
+}
+
+// CreateUser inserts u into the users table and returns the id that the
+// database generated for it. u.Password is expected to be the plaintext
+// password, which is hashed with s.Hasher before it's stored.
+//
+// u.Id, u.Password, u.CreatedAt and u.UpdatedAt are set to the values
+// that were stored so callers don't have to fetch the user again.
+//
+// u is checked with Validate and its password with s.PasswordPolicy
+// before it's inserted. If the username is already taken, the returned
+// error matches ErrDuplicateUsername when checked with errors.Is, and
+// similarly ErrDuplicateEmail if the email is already taken. The email is
+// stored in lowercase.
+func (s *Store) CreateUser(ctx context.Context, u *User) (id int64, err error) {
+	ctx, op, err := s.startOp(ctx, "CreateUser")
+	if err != nil {
+		return 0, err
+	}
+	defer func() { op.end(err, 1) }()
+
+	id, err = s.createUser(ctx, "create user", u)
+	if err != nil {
+		return 0, err
+	}
+	return id, s.runHooks(ctx, hookCreate, u)
+}
+
+// createUser is CreateUser without the instrumentation, for the store's
+// methods that create users. Errors are prefixed with op.
+func (s *Store) createUser(ctx context.Context, op string, u *User) (int64, error) {
+	s.normalize(u)
+	if err := u.Validate(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := s.PasswordPolicy.Validate(u.Password); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	hash, err := s.hashPassword(u.Password)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := time.Now().UTC()
+	id, err := s.insertUser(ctx, u.Username, u.Email, hash, u.Role, now, now, jsonMap(u.Metadata))
+	if err != nil {
+		if dupErr := uniqueViolation(op, err); dupErr != nil {
+			return 0, dupErr
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	u.Id = int(id)
+	u.Password = hash
+	u.CreatedAt = now
+	u.UpdatedAt = now
+	u.Version = 1
+
+	return id, nil
+}
+
+// updateOrInsertUser updates the user with u's username for UpsertUser,
+// or inserts u if there's no such user, using s, which runs its queries in
+// the call's transaction. It returns the user's id, and whether u was
+// inserted.
+func (s *Store) updateOrInsertUser(ctx context.Context, u *User, hash string, now time.Time) (int64, bool, error) {
+	res, err := s.execContext(ctx, updateUserByUsernameQuery(s.dialect, s.table()), u.Email, hash, u.Role, jsonMap(u.Metadata), now, u.Username)
+	if err != nil {
+		return 0, false, err
+	}
+	numAffected, err := res.RowsAffected()
+	if err != nil {
+		return 0, false, err
+	}
+	if numAffected == 1 {
+		var id int64
+		err := s.queryRowContext(ctx, selectUserIDByUsernameQuery(s.dialect, s.table()), u.Username).Scan(&id)
+		return id, false, err
+	}
+	id, err := s.insertUser(ctx, u.Username, u.Email, hash, u.Role, now, now, jsonMap(u.Metadata))
+	return id, true, err
+}
+
+// insertUser inserts a user whose insertUserColumns are given in args,
+// and returns the id that the database generated for it.
+func (s *Store) insertUser(ctx context.Context, args ...interface{}) (int64, error) {
+	query := insertUserQuery(s.dialect, s.table())
+
+	// Postgres doesn't support LastInsertId, so the insert returns the id
+	// as a row instead.
+	if s.dialect == Postgres {
+		var id int64
+		err := s.withRetry(ctx, func() error {
+			return s.queryRowContext(ctx, query, args...).Scan(&id)
+		})
+		return id, err
+	}
+
+	// Exec executes a query without returning any rows.
+	// The args are for any placeholder parameters in the query.
+	res, err := s.execRetry(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	// RowsAffected returns the number of rows affected by an
+	// update, insert, or delete. Not every database or database
+	// driver may support this.
+	numAffected, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if numAffected != 1 {
+		return 0, fmt.Errorf("expected 1 row to be affected, got %d", numAffected)
+	}
+
+	// LastInsertId returns the integer generated by the database
+	// in response to a command. Typically this will be from an
+	// "auto increment" column when inserting a new row. Not all
+	// databases support this feature, and the syntax of such
+	// statements varies.
+	return res.LastInsertId()
+}
+
+// GetUserByID returns the user with the given id, or ErrUserNotFound if
+// no such user exists.
+func (s *Store) GetUserByID(ctx context.Context, id int) (u *User, err error) {
+	ctx, op, err := s.startOp(ctx, "GetUserByID")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { op.end(err, 1) }()
+
+	if s.CacheTTL > 0 {
+		if u, ok := s.cache.get(id, time.Now()); ok {
+			s.redact(u)
+			return u, nil
+		}
+	}
+
+	u, err = s.getUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if s.CacheTTL > 0 {
+		s.cache.put(u, time.Now().Add(s.CacheTTL))
+	}
+	s.redact(u)
+	return u, nil
+}
+
+// getUserByID is like GetUserByID, but never clears the returned user's
+// password.
+func (s *Store) getUserByID(ctx context.Context, id int) (*User, error) {
+	// QueryRow executes a query that is expected to return at most one row.
+	// QueryRow always returns a non-nil value. Errors are deferred until
+	// Row's Scan method is called.
+	query := selectUserByIDQuery(s.dialect, s.table())
+	u, err := scanUser(s.queryRowContext(ctx, query, id))
+	if err != nil {
+		// If the query selects no rows, Scan will return ErrNoRows.
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("get user by id: %w", err)
+	}
+
+	return u, nil
+}
+
+// GetUserByUsername returns the user with the given username, or
+// ErrUserNotFound if no such user exists.
+//
+// Usernames are matched case-sensitively, so "Alice" and "alice" are
+// different users. On MySQL this relies on the username column using a
+// case-sensitive collation such as utf8mb4_bin, since MySQL's default
+// collations compare strings case-insensitively.
+func (s *Store) GetUserByUsername(ctx context.Context, username string) (u *User, err error) {
+	ctx, op, err := s.startOp(ctx, "GetUserByUsername")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { op.end(err, 1) }()
+
+	u, err = s.getUserByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	s.redact(u)
+	return u, nil
+}
+
+// getUserByUsername is like GetUserByUsername, but never clears the
+// returned user's password.
+func (s *Store) getUserByUsername(ctx context.Context, username string) (*User, error) {
+	query := selectUserByUsernameQuery(s.dialect, s.table())
+	u, err := scanUser(s.queryRowContext(ctx, query, username))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("get user by username: %w", err)
+	}
+
+	return u, nil
+}
+
+// GetUserByEmail returns the user with the given email address, or
+// ErrUserNotFound if no such user exists. Emails are stored in lowercase,
+// so email is matched case-insensitively. An empty email is an error
+// matching ErrEmptyEmail rather than a lookup of users without an email.
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (u *User, err error) {
+	ctx, op, err := s.startOp(ctx, "GetUserByEmail")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { op.end(err, 1) }()
+
+	u, err = s.getUserByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	s.redact(u)
+
+	return u, nil
+}
+
+// getUserByEmail is like GetUserByEmail, but never clears the returned
+// user's password.
+func (s *Store) getUserByEmail(ctx context.Context, email string) (*User, error) {
+	// An empty email must not be looked up, since that could be mistaken
+	// for looking up the users without an email.
+	email = normalizeEmail(email)
+	if email == "" {
+		return nil, fmt.Errorf("get user by email: %w", ErrEmptyEmail)
+	}
+
+	query := selectUserByEmailQuery(s.dialect, s.table())
+	u, err := scanUser(s.queryRowContext(ctx, query, email))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("get user by email: %w", err)
+	}
+	return u, nil
+}
+
+// GetUsersByIDs returns the users with the given ids, keyed by id, using
+// a single query for every lookupBatchSize ids. Ids that don't belong to
+// a user are left out of the map rather than causing an error.
+func (s *Store) GetUsersByIDs(ctx context.Context, ids []int) (users map[int]*User, err error) {
+	ctx, op, err := s.startOp(ctx, "GetUsersByIDs")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { op.end(err, len(users)) }()
+
+	users = make(map[int]*User, len(ids))
+	for start := 0; start < len(ids); start += lookupBatchSize {
+		end := start + lookupBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batch := ids[start:end]
+		args := make([]interface{}, len(batch))
+		for i, id := range batch {
+			args[i] = id
+		}
+
+		list, err := s.queryUsers(ctx, selectUsersByIDsQuery(s.dialect, s.table(), len(batch)), args...)
+		if err != nil {
+			return nil, fmt.Errorf("get users by ids: %w", err)
+		}
+		for _, u := range list {
+			users[u.Id] = u
+		}
+	}
+	return users, nil
+}
+
+// UpdateUser saves the username, email, password, role and metadata of u
+// to the row with u's id and sets its updated_at time to the current
+// time. It returns ErrUserNotFound if no row has that id, and an error
+// matching ErrDuplicateUsername or ErrDuplicateEmail if another user
+// already has u's username or email.
+//
+// The row is only updated if its version still matches u.Version, so that
+// concurrent updates can't silently overwrite each other. If it doesn't,
+// the returned error matches ErrVersionConflict, and the user should be
+// read again before retrying. On success, the version and u.Version go up
+// by one.
+//
+// Unlike CreateUser, UpdateUser stores u.Password as is, so a new password
+// must be hashed before calling it, such as with s.Hasher or HashPassword.
+// An empty password leaves the stored password as it is, so that users
+// read with RedactPasswords set can be updated without locking them out;
+// RemovePassword removes a user's password.
+func (s *Store) UpdateUser(ctx context.Context, u *User) (err error) {
+	ctx, op, err := s.startOp(ctx, "UpdateUser")
+	if err != nil {
+		return err
+	}
+	defer func() { op.end(err, 1) }()
+
+	if u.Id == 0 {
+		return fmt.Errorf("update user: %w", ErrMissingUserID)
+	}
+	s.normalize(u)
+	if err := u.validate(false); err != nil {
+		return fmt.Errorf("update user: %w", err)
+	}
+
+	now := time.Now().UTC()
+	args := []interface{}{u.Username, u.Email}
+	if u.Password != "" {
+		args = append(args, u.Password)
+	}
+	args = append(args, u.Role, jsonMap(u.Metadata), now, u.Id, u.Version)
+	res, err := s.execRetry(ctx, updateUserQuery(s.dialect, s.table(), u.Password != ""), args...)
+	s.invalidate(u.Id)
+	if err != nil {
+		if dupErr := uniqueViolation("update user", err); dupErr != nil {
+			return dupErr
+		}
+		return fmt.Errorf("update user: %w", err)
+	}
+
+	// Since the version always changes, MySQL reports the row as affected
+	// even if none of the other fields changed. No affected rows means
+	// either the user doesn't exist or its version has moved on.
+	if err := checkUserAffected("update user", res); err != nil {
+		if !errors.Is(err, ErrUserNotFound) {
+			return err
+		}
+		var n int
+		err := s.queryRowContext(ctx, countUserByIDQuery(s.dialect, s.table(), false), u.Id).Scan(&n)
+		if err != nil {
+			return fmt.Errorf("update user: %w", err)
+		}
+		if n == 0 {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("update user: %w", ErrVersionConflict)
+	}
+	u.UpdatedAt = now
+	u.Version++
+
+	return s.runHooks(ctx, hookUpdate, u)
+}
+
+// DeleteUser soft deletes the user with the given id by setting its
+// deleted_at time, after which the user is skipped by the store's read
+// methods until it's restored with RestoreUser. It returns
+// ErrUserNotFound if no user with that id exists or it's already deleted.
+func (s *Store) DeleteUser(ctx context.Context, id int) (err error) {
+	ctx, op, err := s.startOp(ctx, "DeleteUser")
+	if err != nil {
+		return err
+	}
+	defer func() { op.end(err, 1) }()
+
+	now := time.Now().UTC()
+	res, err := s.execDestructive(ctx, "DeleteUser",
+		deleteUserQuery(s.dialect, s.table()), []interface{}{now, id},
+		countUserByIDQuery(s.dialect, s.table(), false), id)
+	s.invalidate(id)
+	if err != nil {
+		return fmt.Errorf("delete user: %w", err)
+	}
+	if err := checkUserAffected("delete user", res); err != nil {
+		return err
+	}
+	if s.DryRun {
+		return nil
+	}
+	return s.runHooks(ctx, hookDelete, &User{Id: id})
+}
+
+// HardDeleteUser permanently deletes the user with the given id, whether
+// or not it has been soft deleted. It returns ErrUserNotFound if no user
+// with that id exists.
+func (s *Store) HardDeleteUser(ctx context.Context, id int) (err error) {
+	ctx, op, err := s.startOp(ctx, "HardDeleteUser")
+	if err != nil {
+		return err
+	}
+	defer func() { op.end(err, 1) }()
+
+	res, err := s.execDestructive(ctx, "HardDeleteUser",
+		hardDeleteUserQuery(s.dialect, s.table()), []interface{}{id},
+		countUserByIDQuery(s.dialect, s.table(), true), id)
+	s.invalidate(id)
+	if err != nil {
+		return fmt.Errorf("hard delete user: %w", err)
+	}
+	if err := checkUserAffected("hard delete user", res); err != nil {
+		return err
+	}
+	if s.DryRun {
+		return nil
+	}
+	return s.runHooks(ctx, hookDelete, &User{Id: id})
+}
+
+// RestoreUser restores the soft deleted user with the given id. It
+// returns ErrUserNotFound if no deleted user with that id exists.
+func (s *Store) RestoreUser(ctx context.Context, id int) (err error) {
+	ctx, op, err := s.startOp(ctx, "RestoreUser")
+	if err != nil {
+		return err
+	}
+	defer func() { op.end(err, 1) }()
+
+	res, err := s.execRetry(ctx, restoreUserQuery(s.dialect, s.table()), id)
+	if err != nil {
+		return fmt.Errorf("restore user: %w", err)
+	}
+	if err := checkUserAffected("restore user", res); err != nil {
+		return err
+	}
+	return s.runHooks(ctx, hookUpdate, &User{Id: id})
+}
+
+// redact clears u's password if s.RedactPasswords is set.
+func (s *Store) redact(u *User) {
+	if s.RedactPasswords {
+		u.Password = ""
+	}
+}
+
+// checkUserAffected returns ErrUserNotFound if res affected no rows.
+func checkUserAffected(op string, res sql.Result) error {
+	numAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if numAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// ListUsers returns a page of users, ordered and paginated as described
+// by opts.
+func (s *Store) ListUsers(ctx context.Context, opts ListOptions) (users []*User, err error) {
+	ctx, op, err := s.startOp(ctx, "ListUsers")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { op.end(err, len(users)) }()
+
+	if err := opts.validate(); err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+
+	cols := opts.columns()
+	if opts.Filter != nil {
+		where, args := opts.Filter.where(s.dialect, 1)
+		query := listFilteredUsersQuery(s.dialect, s.table(), strings.Join(cols, ", "), where, len(args), opts.orderBy())
+		users, err = s.queryUsers(ctx, query, append(args, opts.limit(), opts.Offset)...)
+		if err != nil {
+			return nil, fmt.Errorf("list users: %w", err)
+		}
+		return users, nil
+	}
+
+	query := listUsersQuery(s.dialect, s.table(), strings.Join(cols, ", "), opts.orderBy())
+	users, err = s.queryUsers(ctx, query, opts.limit(), opts.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	return users, nil
+}
+
+// queryUsers runs query, which must select some or all of the
+// userColumns, in any order, and returns the users it selects. The fields
+// of the columns it doesn't select are left at their zero values.
+func (s *Store) queryUsers(ctx context.Context, query string, args ...interface{}) ([]*User, error) {
+	// Query executes a query that returns rows, typically a SELECT.
+	// The args are for any placeholder parameters in the query.
+	rows, err := s.queryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	// Close the rows when they are no longer needed.
+	//
+	// Close closes the Rows, preventing further enumeration. If Next returns
+	// false, the Rows are closed automatically and it will suffice to check the
+	// result of Err. Close is idempotent and does not affect the result of Err.
+	defer rows.Close()
+
+	var users []*User
+
+	// Iterate over all of the rows returned from the database.
+	//
+	// Next prepares the next result row for reading with the Scan method. It
+	// returns true on success, or false if there is no next result row or an error
+	// happened while preparing it. Err should be consulted to distinguish between
+	// the two cases.
+	//
+	// Every call to Scan, even the first one, must be preceded by a call to Next.
+	for rows.Next() {
+		// Scan in the user's information from the row.
+		u := new(User)
+		if err := scanInto(rows, u); err != nil {
+			return nil, err
+		}
+		s.redact(u)
+
+		users = append(users, u)
+	}
+
+	// Make sure there were no errors whilst scanning in the users
+	// from the database.
+	//
+	// Err returns the error, if any, that was encountered during iteration.
+	// Err may be called after an explicit or implicit Close.
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// UpsertUser inserts u, or if a user with u's username already exists,
+// updates that user's email, password, role and metadata instead. Like
+// CreateUser, it validates u, and u.Password is expected to be the
+// plaintext password and is checked against s.PasswordPolicy and hashed
+// before it's stored.
+//
+// Only the user with u's username is ever updated. If u's email belongs to
+// another user, nothing is changed, and the returned error matches
+// ErrDuplicateEmail.
+//
+// It reports whether a new row was inserted, and sets u.Id and u.Password
+// to the row's id and the stored hash.
+func (s *Store) UpsertUser(ctx context.Context, u *User) (inserted bool, err error) {
+	ctx, op, err := s.startOp(ctx, "UpsertUser")
+	if err != nil {
+		return false, err
+	}
+	defer func() { op.end(err, 1) }()
+
+	s.normalize(u)
+	if err := u.Validate(); err != nil {
+		return false, fmt.Errorf("upsert user: %w", err)
+	}
+	if err := s.PasswordPolicy.Validate(u.Password); err != nil {
+		return false, fmt.Errorf("upsert user: %w", err)
+	}
+	hash, err := s.hashPassword(u.Password)
+	if err != nil {
+		return false, fmt.Errorf("upsert user: %w", err)
+	}
+
+	now := time.Now().UTC()
+
+	var id int64
+	switch {
+	case s.hasTenant || s.dialect == MySQL:
+		// With a tenant, the upserts below would update the user with the
+		// username even if it belongs to another tenant, and MySQL's only
+		// upsert would update the user with u's email if it's another
+		// user's. So the user with the username is updated instead, and a
+		// user is only inserted if there's none.
+		//
+		// If a concurrent call inserts the username first, the insert
+		// fails, and the user it inserted is updated by trying again.
+		for attempt := 0; ; attempt++ {
+			inserted = false
+			err = s.withTx(ctx, func(tx *sql.Tx) error {
+				var err error
+				id, inserted, err = s.txStore(tx).updateOrInsertUser(ctx, u, hash, now)
+				return err
+			})
+			if dupErr := uniqueViolation("upsert user", err); dupErr != nil {
+				if attempt == 0 && errors.Is(dupErr, ErrDuplicateUsername) {
+					continue
+				}
+				return false, dupErr
+			}
+			if err != nil {
+				return false, fmt.Errorf("upsert user: %w", err)
+			}
+			break
+		}
+	case s.dialect == Postgres:
+		err := s.withRetry(ctx, func() error {
+			return s.queryRowContext(ctx, upsertUserQuery(s.dialect, s.table()), u.Username, u.Email, hash, u.Role, now, now, jsonMap(u.Metadata)).Scan(&id, &inserted)
+		})
+		if err != nil {
+			if dupErr := uniqueViolation("upsert user", err); dupErr != nil {
+				return false, dupErr
+			}
+			return false, fmt.Errorf("upsert user: %w", err)
+		}
+	default:
+		// SQLite has no way to tell an insert apart from an update in a
+		// single statement, so try the insert first and fall back to an
+		// update within the same transaction.
+		err := s.withTx(ctx, func(tx *sql.Tx) error {
+			res, err := tx.ExecContext(ctx, upsertUserQuery(s.dialect, s.table()), u.Username, u.Email, hash, u.Role, now, now, jsonMap(u.Metadata))
+			if err != nil {
+				return err
+			}
+			numAffected, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if numAffected == 1 {
+				inserted = true
+				id, err = res.LastInsertId()
+				return err
+			}
+			_, err = tx.ExecContext(ctx, updateUserByUsernameQuery(s.dialect, s.table()), u.Email, hash, u.Role, jsonMap(u.Metadata), now, u.Username)
+			if err != nil {
+				return err
+			}
+			return tx.QueryRowContext(ctx, selectUserIDByUsernameQuery(s.dialect, s.table()), u.Username).Scan(&id)
+		})
+		if err != nil {
+			if dupErr := uniqueViolation("upsert user", err); dupErr != nil {
+				return false, dupErr
+			}
+			return false, fmt.Errorf("upsert user: %w", err)
+		}
+	}
+
+	s.invalidate(int(id))
+
+	// Not every dialect can return the row's version from the upsert, so
+	// it's read back separately.
+	if err := s.queryRowContext(ctx, selectUserVersionQuery(s.dialect, s.table()), id).Scan(&u.Version); err != nil {
+		return false, fmt.Errorf("upsert user: %w", err)
+	}
+
+	u.Id = int(id)
+	u.Password = hash
+	u.UpdatedAt = now
+	if inserted {
+		u.CreatedAt = now
+		return true, s.runHooks(ctx, hookCreate, u)
+	}
+	return false, s.runHooks(ctx, hookUpdate, u)
+}
+
+// CountUsers returns the total number of users that haven't been soft
+// deleted. Together with ListUsers it can be used to work out how many
+// pages of users there are.
+func (s *Store) CountUsers(ctx context.Context) (n int, err error) {
+	ctx, op, err := s.startOp(ctx, "CountUsers")
+	if err != nil {
+		return 0, err
+	}
+	defer func() { op.end(err, 1) }()
+
+	t := s.table()
+	if err := s.queryRowContext(ctx, "select count(*) from "+t.name+t.where()+"deleted_at is null").Scan(&n); err != nil {
+		return 0, fmt.Errorf("count users: %w", err)
+	}
+	return n, nil
+}
+
+// UserExists reports whether a user with the given username exists,
+// without fetching the user's row. Soft deleted users are included, since
+// their usernames are still taken.
+func (s *Store) UserExists(ctx context.Context, username string) (exists bool, err error) {
+	ctx, op, err := s.startOp(ctx, "UserExists")
+	if err != nil {
+		return false, err
+	}
+	defer func() { op.end(err, 1) }()
+
+	err = s.queryRowContext(ctx, userExistsQuery(s.dialect, s.table()), username).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("user exists: %w", err)
+	}
+	return exists, nil
+}
@@ -0,0 +1,301 @@
+package users_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+// createUsers creates users with the given usernames in s, and returns
+// their ids.
+func createUsers(t *testing.T, s *users.Store, usernames ...string) []int {
+	t.Helper()
+	ids := make([]int, len(usernames))
+	for i, username := range usernames {
+		id, err := s.CreateUser(context.Background(), &users.User{Username: username, Password: "password123"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = int(id)
+	}
+	return ids
+}
+
+func TestCreateAndGetUser(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+
+	u := &users.User{Username: "alice", Email: strptr("Alice@Example.com"), Password: "password123"}
+	id, err := s.CreateUser(ctx, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(u.Id) != id || u.Version != 1 || u.CreatedAt.IsZero() || u.Role != users.RoleUser {
+		t.Errorf("CreateUser didn't fill in u: %+v", u)
+	}
+	if !users.CheckPassword(u.Password, "password123") {
+		t.Error("u.Password isn't the hash of the password")
+	}
+
+	byID, err := s.GetUserByID(ctx, int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	byUsername, err := s.GetUserByUsername(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byEmail, err := s.GetUserByEmail(ctx, "ALICE@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, got := range []*users.User{byID, byUsername, byEmail} {
+		if got.Id != int(id) || got.Username != "alice" || *got.Email != "alice@example.com" {
+			t.Errorf("got %+v, want alice with id %d", got, id)
+		}
+		if !got.CreatedAt.Equal(u.CreatedAt) {
+			t.Errorf("CreatedAt = %v, want %v", got.CreatedAt, u.CreatedAt)
+		}
+	}
+
+	if _, err := s.GetUserByID(ctx, 1000); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("unknown id: err = %v, want ErrUserNotFound", err)
+	}
+	if _, err := s.GetUserByUsername(ctx, "bob"); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("unknown username: err = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestCreateUserErrors(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+	createUsers(t, s, "alice")
+	if _, err := s.CreateUser(ctx, &users.User{Username: "carol", Email: strptr("carol@example.com"), Password: "password123"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := s.CreateUser(ctx, &users.User{Username: "alice", Password: "password123"})
+	if !errors.Is(err, users.ErrDuplicateUsername) {
+		t.Errorf("taken username: err = %v, want ErrDuplicateUsername", err)
+	}
+	_, err = s.CreateUser(ctx, &users.User{Username: "bob", Email: strptr("CAROL@example.com"), Password: "password123"})
+	if !errors.Is(err, users.ErrDuplicateEmail) {
+		t.Errorf("taken email: err = %v, want ErrDuplicateEmail", err)
+	}
+
+	_, err = s.CreateUser(ctx, &users.User{Email: strptr(""), Role: "root"})
+	var ve *users.ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("invalid user: err = %v, want a *ValidationError", err)
+	}
+	for _, field := range []string{"username", "email", "password", "role"} {
+		if _, ok := ve.Fields[field]; !ok {
+			t.Errorf("ValidationError.Fields has no %q: %v", field, ve.Fields)
+		}
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+	ids := createUsers(t, s, "alice", "bob")
+
+	u, err := s.GetUserByID(ctx, ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Username = "alicia"
+	u.Email = strptr("alicia@example.com")
+	if err := s.UpdateUser(ctx, u); err != nil {
+		t.Fatal(err)
+	}
+	if u.Version != 2 {
+		t.Errorf("Version = %d, want 2", u.Version)
+	}
+	got, err := s.GetUserByUsername(ctx, "alicia")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != 2 || got.UpdatedAt.Before(got.CreatedAt) {
+		t.Errorf("got version %d, updated at %v", got.Version, got.UpdatedAt)
+	}
+
+	// u still has version 2, so an update made from a stale copy fails.
+	stale := *got
+	stale.Version = 1
+	if err := s.UpdateUser(ctx, &stale); !errors.Is(err, users.ErrVersionConflict) {
+		t.Errorf("stale version: err = %v, want ErrVersionConflict", err)
+	}
+
+	u.Username = "bob"
+	if err := s.UpdateUser(ctx, u); !errors.Is(err, users.ErrDuplicateUsername) {
+		t.Errorf("taken username: err = %v, want ErrDuplicateUsername", err)
+	}
+
+	// An empty password leaves the stored one alone.
+	u.Username = "alicia"
+	u.Password = ""
+	if err := s.UpdateUser(ctx, u); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Authenticate(ctx, "alicia", "password123"); err != nil {
+		t.Errorf("Authenticate after updating without a password: %v", err)
+	}
+
+	if err := s.UpdateUser(ctx, &users.User{Username: "dave"}); !errors.Is(err, users.ErrMissingUserID) {
+		t.Errorf("no id: err = %v, want ErrMissingUserID", err)
+	}
+}
+
+func TestDeleteAndRestoreUser(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+	id := createUsers(t, s, "alice")[0]
+
+	if err := s.DeleteUser(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetUserByID(ctx, id); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("deleted user: err = %v, want ErrUserNotFound", err)
+	}
+	if err := s.DeleteUser(ctx, id); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("second delete: err = %v, want ErrUserNotFound", err)
+	}
+	// The deleted user keeps its username.
+	if exists, err := s.UserExists(ctx, "alice"); err != nil || !exists {
+		t.Errorf("UserExists(deleted) = %v, %v; want true, nil", exists, err)
+	}
+	if _, err := s.CreateUser(ctx, &users.User{Username: "alice", Password: "password123"}); !errors.Is(err, users.ErrDuplicateUsername) {
+		t.Errorf("reusing a deleted username: err = %v, want ErrDuplicateUsername", err)
+	}
+
+	if err := s.RestoreUser(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetUserByID(ctx, id); err != nil {
+		t.Errorf("restored user: %v", err)
+	}
+
+	if err := s.HardDeleteUser(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RestoreUser(ctx, id); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("restoring a hard deleted user: err = %v, want ErrUserNotFound", err)
+	}
+	if n, err := s.CountUsers(ctx); err != nil || n != 0 {
+		t.Errorf("CountUsers = %d, %v; want 0, nil", n, err)
+	}
+}
+
+func TestGetUsersByIDs(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+	ids := createUsers(t, s, "alice", "bob", "carol")
+	if err := s.DeleteUser(ctx, ids[2]); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := s.GetUsersByIDs(ctx, []int{ids[0], ids[1], ids[2], 1000, ids[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 || found[ids[0]].Username != "alice" || found[ids[1]].Username != "bob" {
+		t.Errorf("GetUsersByIDs = %v, want alice and bob", found)
+	}
+
+	found, err = s.GetUsersByIDs(ctx, nil)
+	if err != nil || len(found) != 0 {
+		t.Errorf("GetUsersByIDs(nil) = %v, %v", found, err)
+	}
+}
+
+func TestRedactPasswords(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	s.RedactPasswords = true
+	ctx := context.Background()
+	id := createUsers(t, s, "alice")[0]
+
+	u, err := s.GetUserByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Password != "" {
+		t.Errorf("Password = %q, want it cleared", u.Password)
+	}
+	list, err := s.ListUsers(ctx, users.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Password != "" {
+		t.Errorf("ListUsers returned a password: %+v", list)
+	}
+}
+
+func TestUpdateUserWithRedactedPassword(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	s.RedactPasswords = true
+	ctx := context.Background()
+	id := createUsers(t, s, "alice")[0]
+
+	u, err := s.GetUserByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Email = strptr("alice@example.com")
+	if err := s.UpdateUser(ctx, u); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Authenticate(ctx, "alice", "password123"); err != nil {
+		t.Errorf("Authenticate after updating a redacted user: %v", err)
+	}
+}
+
+func TestRemovePassword(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+	id := createUsers(t, s, "alice")[0]
+
+	if err := s.RemovePassword(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Authenticate(ctx, "alice", "password123"); !errors.Is(err, users.ErrNoPasswordSet) {
+		t.Errorf("Authenticate without a password: err = %v, want ErrNoPasswordSet", err)
+	}
+	u, err := s.GetUserByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.HasPassword() || u.Version != 2 {
+		t.Errorf("after RemovePassword: HasPassword = %t, Version = %d", u.HasPassword(), u.Version)
+	}
+
+	if err := s.RemovePassword(ctx, 999); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("missing user: err = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestGetUsersByIDsInBatches(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	s.Hasher = plainHasher{}
+	ctx := context.Background()
+
+	// More ids than fit in one query, including some that don't belong to
+	// any user.
+	if _, err := s.CreateUsers(ctx, newUsers("user", 1500)); err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]int, 2500)
+	for i := range ids {
+		ids[i] = i + 1
+	}
+	found, err := s.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1500 || found[1].Username != "user0" || found[1500].Username != "user1499" {
+		t.Errorf("GetUsersByIDs found %d users, want 1500", len(found))
+	}
+}
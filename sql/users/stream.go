@@ -0,0 +1,48 @@
+package users
+
+import "context"
+
+// StreamUsers sends every user on the returned user channel, reading them
+// from the database one row at a time so that the whole table never has
+// to be held in memory.
+//
+// The user channel is closed once every user has been sent, ctx is done or
+// an error occurs. Any error, including ctx's error, is then sent on the
+// error channel, which is closed afterwards, so callers should receive
+// from the error channel once the user channel is closed.
+func (s *Store) StreamUsers(ctx context.Context) (<-chan *User, <-chan error) {
+	users := make(chan *User)
+	errc := make(chan error, 1)
+
+	go func() {
+		ctx, op, err := s.startOp(ctx, "StreamUsers")
+		if err == nil {
+			var sent int
+			err = s.streamUsers(ctx, users, &sent)
+			op.end(err, sent)
+		}
+		if err != nil {
+			errc <- err
+		}
+		close(users)
+		close(errc)
+	}()
+
+	return users, errc
+}
+
+// streamUsers sends every user on users for StreamUsers, counting the
+// users sent in sent.
+func (s *Store) streamUsers(ctx context.Context, users chan<- *User, sent *int) error {
+	return s.eachUser(ctx, "stream users", selectAllUsersQuery(s.dialect, s.table()), func(u *User) error {
+		s.redact(u)
+
+		select {
+		case users <- u:
+			*sent++
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
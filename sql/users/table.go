@@ -0,0 +1,112 @@
+package users
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// defaultTableName is the table a Store keeps its users in if its
+// TableName isn't set, which is the table created by the migrations.
+const defaultTableName = "users"
+
+// ErrInvalidTableName is returned when a Store's table name isn't a
+// valid, unquoted table name.
+var ErrInvalidTableName = errors.New("invalid table name")
+
+// validTableName reports whether name is an identifier as accepted by
+// validIdentifier, optionally qualified by a schema name that's one too.
+// Nothing else is allowed, so that the name can't be used to inject SQL.
+func validTableName(name string) bool {
+	schema, table, ok := strings.Cut(name, ".")
+	if !ok {
+		return validIdentifier(name)
+	}
+	return validIdentifier(schema) && validIdentifier(table)
+}
+
+// A userTable is the table a Store keeps its users in, along with the
+// tenant that the store's queries are scoped to, if any.
+type userTable struct {
+	name string
+
+	// tenant is the tenant id as a SQL integer literal, or empty for
+	// stores that aren't scoped to a tenant. It's put into queries as a
+	// literal rather than as an argument, so that the placeholders of
+	// the query functions keep their numbering.
+	tenant string
+
+	// caseInsensitive makes usernames be compared case-insensitively.
+	caseInsensitive bool
+}
+
+// usernameCond returns a condition comparing the username column to arg
+// with op, such as "username = $1", ignoring case if t's usernames are
+// case-insensitive.
+func (t userTable) usernameCond(op, arg string) string {
+	if !t.caseInsensitive {
+		return "username " + op + " " + arg
+	}
+	return "lower(username) " + op + " lower(" + arg + ")"
+}
+
+// usernameIn returns a condition that the username column is one of n
+// arguments numbered from start, as inClause does. If t's usernames are
+// case-insensitive, the arguments must already be in lower case.
+func (t userTable) usernameIn(d Dialect, start, n int) string {
+	if !t.caseInsensitive {
+		return inClause(d, "username", start, n)
+	}
+	return inClause(d, "lower(username)", start, n)
+}
+
+// where starts a where clause that's scoped to t's tenant, to which the
+// query's own conditions are appended.
+func (t userTable) where() string {
+	if t.tenant == "" {
+		return " where "
+	}
+	return " where tenant_id = " + t.tenant + " and "
+}
+
+// insertColumns returns the columns set when inserting a user into t,
+// which include tenant_id if t is scoped to a tenant.
+func (t userTable) insertColumns() string {
+	if t.tenant == "" {
+		return insertUserColumns
+	}
+	return insertUserColumns + ", tenant_id"
+}
+
+// insertValues returns the values inserted for a user into t, with the
+// insertUserColumns numbered from start, followed by t's tenant.
+func (t userTable) insertValues(d Dialect, start int) string {
+	values := placeholders(d, start, numInsertUserColumns)
+	if t.tenant != "" {
+		values += ", " + t.tenant
+	}
+	return "(" + values + ")"
+}
+
+// table returns the table that s keeps its users in.
+func (s *Store) table() userTable {
+	t := userTable{name: s.TableName}
+	if t.name == "" {
+		t.name = defaultTableName
+	}
+	if s.hasTenant {
+		t.tenant = strconv.FormatInt(s.tenantID, 10)
+	}
+	t.caseInsensitive = s.CaseInsensitiveUsernames
+	return t
+}
+
+// checkTable returns ErrInvalidTableName if s's TableName was set to an
+// invalid table name after the store was created.
+func (s *Store) checkTable() error {
+	if s.TableName != "" && !validTableName(s.TableName) {
+		return fmt.Errorf("%w: %q", ErrInvalidTableName, s.TableName)
+	}
+	return nil
+}
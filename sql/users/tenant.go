@@ -0,0 +1,90 @@
+package users
+
+import "errors"
+
+// ErrTenantRequired is returned by the methods of a Store with
+// RequireTenant set that wasn't created with ForTenant.
+var ErrTenantRequired = errors.New("store isn't scoped to a tenant")
+
+// ForTenant returns a Store that only sees the users of the tenant with
+// the given id, which are those whose tenant_id is tenantID. Every query
+// it runs is limited to those users, and the users it creates are given
+// the tenant's id, so one tenant can't read or change another's users
+// through it. The Store has the same settings as s, except that it
+// doesn't cache users.
+//
+// Usernames and emails are still unique across all tenants, so creating
+// a user can fail with ErrDuplicateUsername even though the tenant can't
+// see the user that has the username. Queries that callers write
+// themselves, such as with NamedExec, Exec or Query, aren't scoped.
+//
+// The Store shares s's database, so shutting it down, reconnecting it or
+// preparing its statements does the same to s, and it's shut down along
+// with s. Its queries don't use the statements prepared with Prepare.
+func (s *Store) ForTenant(tenantID int64) *Store {
+	ts := s.derive()
+	ts.tenantID, ts.hasTenant = tenantID, true
+	ts.base = s.root()
+	return ts
+}
+
+// root returns the store whose database and state s shares, which is the
+// store ForTenant was called on if s was created with ForTenant, and s
+// itself otherwise.
+func (s *Store) root() *Store {
+	if s.base != nil {
+		return s.base
+	}
+	return s
+}
+
+// derive returns a Store with the same settings as s, for the stores
+// created by ForTenant and WithinTx, which set up the rest themselves.
+// CacheTTL isn't copied, since only the store that owns the cache can
+// tell when its entries are stale.
+func (s *Store) derive() *Store {
+	return &Store{
+		Tracer:                   s.Tracer,
+		RedactPasswords:          s.RedactPasswords,
+		Logger:                   s.Logger,
+		SlowThreshold:            s.SlowThreshold,
+		DefaultTimeout:           s.DefaultTimeout,
+		Timeouts:                 s.Timeouts,
+		CaseInsensitiveUsernames: s.CaseInsensitiveUsernames,
+		AcquireTimeout:           s.AcquireTimeout,
+		SkipRecordLogin:          s.SkipRecordLogin,
+		MaxFailedLogins:          s.MaxFailedLogins,
+		LockoutDuration:          s.LockoutDuration,
+		DryRun:                   s.DryRun,
+		PasswordPolicy:           s.PasswordPolicy,
+		FetchSize:                s.FetchSize,
+		IdempotencyWindow:        s.IdempotencyWindow,
+		ResetTokenTTL:            s.ResetTokenTTL,
+		TableName:                s.TableName,
+		RequireTenant:            s.RequireTenant,
+		Hooks:                    s.Hooks,
+		Hasher:                   s.Hasher,
+		FailOnHookError:          s.FailOnHookError,
+
+		dialect:    s.dialect,
+		metrics:    s.metrics,
+		slog:       s.slog,
+		breaker:    s.breaker,
+		tx:         s.tx,
+		savepoints: s.savepoints,
+		tenantID:   s.tenantID,
+		hasTenant:  s.hasTenant,
+	}
+}
+
+// invalidate removes the users with the given ids from the cache of the
+// store that s shares its state with.
+func (s *Store) invalidate(ids ...int) {
+	s.root().cache.invalidate(ids...)
+}
+
+// invalidateAll removes every user from the cache of the store that s
+// shares its state with.
+func (s *Store) invalidateAll() {
+	s.root().cache.invalidateAll()
+}
@@ -0,0 +1,66 @@
+package users_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+func TestForTenant(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+	t1, t2 := s.ForTenant(1), s.ForTenant(2)
+
+	aliceID := createUsers(t, t1, "alice")[0]
+	createUsers(t, t2, "bob")
+
+	if _, err := t2.GetUserByID(ctx, aliceID); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("other tenant's user by id: err = %v, want ErrUserNotFound", err)
+	}
+	if _, err := t2.GetUserByUsername(ctx, "alice"); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("other tenant's user by username: err = %v, want ErrUserNotFound", err)
+	}
+	if err := t2.DeleteUser(ctx, aliceID); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("deleting other tenant's user: err = %v, want ErrUserNotFound", err)
+	}
+	if err := t2.SetRole(ctx, aliceID, users.RoleAdmin); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("setting other tenant's user's role: err = %v, want ErrUserNotFound", err)
+	}
+
+	list, err := t1.ListUsers(ctx, users.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := usernames(list); got != "alice" {
+		t.Errorf("tenant 1 lists %q, want %q", got, "alice")
+	}
+	if n, err := t2.CountUsers(ctx); err != nil || n != 1 {
+		t.Errorf("tenant 2 CountUsers = %d, %v; want 1, nil", n, err)
+	}
+
+	// The unscoped store sees everyone.
+	if n, err := s.CountUsers(ctx); err != nil || n != 2 {
+		t.Errorf("CountUsers = %d, %v; want 2, nil", n, err)
+	}
+
+	// Usernames are unique across tenants.
+	if _, err := t2.CreateUser(ctx, &users.User{Username: "alice", Password: "password123"}); !errors.Is(err, users.ErrDuplicateUsername) {
+		t.Errorf("username of another tenant's user: err = %v, want ErrDuplicateUsername", err)
+	}
+}
+
+func TestRequireTenant(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	s.RequireTenant = true
+	ctx := context.Background()
+
+	if _, err := s.CountUsers(ctx); !errors.Is(err, users.ErrTenantRequired) {
+		t.Errorf("unscoped store: err = %v, want ErrTenantRequired", err)
+	}
+	if _, err := s.ForTenant(1).CountUsers(ctx); err != nil {
+		t.Errorf("scoped store: %v", err)
+	}
+}
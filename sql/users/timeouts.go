@@ -0,0 +1,80 @@
+package users
+
+import (
+	"context"
+	"time"
+)
+
+// Timeouts limit how long the store's reads and writes can take. Unlike
+// DefaultTimeout, they apply even when the caller's context already has a
+// deadline, in which case whichever comes first wins. A zero duration
+// doesn't limit the calls it applies to.
+type Timeouts struct {
+	// Read applies to the methods that read users, such as GetUserByID,
+	// ListUsers and Search.
+	Read time.Duration
+
+	// Write applies to the methods that change users, such as
+	// CreateUser, UpdateUser and DeleteUser, including any reads they
+	// make first.
+	Write time.Duration
+}
+
+// readOps and writeOps are the methods that Timeouts.Read and
+// Timeouts.Write apply to. Methods that read every user, such as
+// StreamUsers and ExportCSV, aren't in either, nor is Authenticate, whose
+// time is mostly spent checking the password. The bulk writes are, so a
+// Write timeout must leave them enough time for the users they change.
+var (
+	readOps = map[string]bool{
+		"CountUsers":          true,
+		"GetUserByEmail":      true,
+		"GetUserByID":         true,
+		"GetUserByUsername":   true,
+		"GetUsersByIDs":       true,
+		"ListUsers":           true,
+		"ListUsersAfter":      true,
+		"Search":              true,
+		"SearchUsersByPrefix": true,
+		"UserExists":          true,
+	}
+	writeOps = map[string]bool{
+		"BulkSetRoles":         true,
+		"ChangePassword":       true,
+		"CreateUser":           true,
+		"CreateUserIdempotent": true,
+		"CreateUsers":          true,
+		"DeleteInactiveUsers":  true,
+		"DeleteUser":           true,
+		"DeleteUsersByIDs":     true,
+		"GetOrCreateUsers":     true,
+		"GetUserForUpdate":     true,
+		"HardDeleteUser":       true,
+		"ImportCSV":            true,
+		"IssueResetToken":      true,
+		"RecordLogin":          true,
+		"RehashWeakPasswords":  true,
+		"RemovePassword":       true,
+		"ResetPassword":        true,
+		"RestoreUser":          true,
+		"SetRole":              true,
+		"UpdateUser":           true,
+		"UpsertUser":           true,
+	}
+)
+
+// withOpTimeout returns a copy of ctx that's cancelled after the timeout
+// in s.Timeouts that applies to the method called name, if there is one.
+func (s *Store) withOpTimeout(ctx context.Context, name string) (context.Context, context.CancelFunc) {
+	var d time.Duration
+	switch {
+	case readOps[name]:
+		d = s.Timeouts.Read
+	case writeOps[name]:
+		d = s.Timeouts.Write
+	}
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
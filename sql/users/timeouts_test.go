@@ -0,0 +1,76 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWithDefaultTimeout(t *testing.T) {
+	s := &Store{DefaultTimeout: time.Minute}
+
+	ctx, cancel := s.withDefaultTimeout(context.Background())
+	deadline, ok := ctx.Deadline()
+	cancel()
+	if !ok || time.Until(deadline) > time.Minute || time.Until(deadline) < 59*time.Second {
+		t.Errorf("deadline %v, %v; want a minute from now", deadline, ok)
+	}
+
+	// A context's own deadline is kept, even when it's later.
+	parent, cancelParent := context.WithTimeout(context.Background(), time.Hour)
+	defer cancelParent()
+	want, _ := parent.Deadline()
+	ctx, cancel = s.withDefaultTimeout(parent)
+	deadline, _ = ctx.Deadline()
+	cancel()
+	if !deadline.Equal(want) {
+		t.Errorf("deadline %v, want the context's own %v", deadline, want)
+	}
+
+	s.DefaultTimeout = 0
+	ctx, cancel = s.withDefaultTimeout(context.Background())
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("got a deadline without a DefaultTimeout")
+	}
+}
+
+func TestDefaultTimeoutStopsCalls(t *testing.T) {
+	db := newTestDB(t)
+	s := NewStore(db, SQLite)
+	s.DefaultTimeout = 20 * time.Millisecond
+
+	// Holding the database's only connection makes calls wait until
+	// they time out.
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	if _, err := s.CountUsers(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("CountUsers = %v, want context.DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("CountUsers took %v to time out", d)
+	}
+}
+
+func TestWithOpTimeout(t *testing.T) {
+	s := &Store{Timeouts: Timeouts{Read: time.Minute, Write: time.Hour}}
+	for _, name := range []string{"ImportCSV", "DeleteInactiveUsers", "RehashWeakPasswords", "GetUserForUpdate", "CreateUser"} {
+		ctx, cancel := s.withOpTimeout(context.Background(), name)
+		deadline, ok := ctx.Deadline()
+		cancel()
+		if !ok || time.Until(deadline) < time.Minute {
+			t.Errorf("%s: deadline %v, %v; want the write timeout", name, deadline, ok)
+		}
+	}
+	ctx, cancel := s.withOpTimeout(context.Background(), "ExportCSV")
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("ExportCSV has a deadline")
+	}
+}
@@ -0,0 +1,243 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+)
+
+// WithTx runs fn inside a transaction. The transaction is committed if fn
+// returns nil and rolled back if fn returns an error or panics. A panic is
+// re-raised once the transaction has been rolled back.
+//
+// The error returned by fn is returned as is, so callers can still
+// inspect it with errors.Is and errors.As.
+func (s *Store) WithTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return s.WithTxOpts(ctx, nil, fn)
+}
+
+// WithTxOpts is like WithTx, but starts the transaction with opts, such
+// as to run it with serializable isolation or make it read-only. A nil
+// opts uses the database's defaults, like WithTx. Note that the SQLite
+// driver ignores ReadOnly, so writes in read-only transactions only fail
+// on MySQL and Postgres. It returns
+// ErrTxOptionsInTx if s is a store passed to the function given to
+// WithinTx and opts isn't nil.
+func (s *Store) WithTxOpts(ctx context.Context, opts *sql.TxOptions, fn func(tx *sql.Tx) error) error {
+	if err := s.acquire(ctx); err != nil {
+		return err
+	}
+	defer s.release()
+
+	ctx, cancel := s.withDefaultTimeout(ctx)
+	defer cancel()
+	return s.withTxOpts(ctx, opts, fn)
+}
+
+// ErrTxOptionsInTx is returned by WithTxOpts when it's given options for
+// a store passed to the function given to WithinTx, whose transaction has
+// already been started with its own isolation level.
+var ErrTxOptionsInTx = errors.New("transaction options can't be changed within a transaction")
+
+// withTx is WithTx without the check that s hasn't been shut down, for
+// the store's own methods, which have already checked. If s is a store
+// passed to the function given to WithinTx, fn is run in a savepoint of
+// s's transaction instead, so that it can still be undone on its own.
+func (s *Store) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return s.withTxOpts(ctx, nil, fn)
+}
+
+// withTxOpts is withTx, starting the transaction with opts.
+func (s *Store) withTxOpts(ctx context.Context, opts *sql.TxOptions, fn func(tx *sql.Tx) error) error {
+	if s.tx != nil {
+		if opts != nil {
+			return fmt.Errorf("begin transaction: %w", ErrTxOptionsInTx)
+		}
+		// MySQL replaces a savepoint when another is made with the same
+		// name, so savepoints are named after how deeply they're nested.
+		depth := s.savepoints.Add(1)
+		defer s.savepoints.Add(-1)
+		name := "store_tx_" + strconv.Itoa(int(depth))
+		return Savepoint(ctx, s.tx, name, func() error { return fn(s.tx) })
+	}
+
+	// BeginTx starts a transaction.
+	//
+	// The provided context is used until the transaction is committed or
+	// rolled back. If the context is canceled, the sql package will roll
+	// back the transaction. Tx.Commit will return an error if the context
+	// provided to BeginTx is canceled.
+	var tx *sql.Tx
+	var err error
+	if conn := reservedConn(ctx); conn != nil {
+		tx, err = conn.BeginTx(ctx, opts)
+	} else {
+		tx, err = s.root().db.BeginTx(ctx, opts)
+	}
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		// Rollback aborts the transaction.
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+
+	// Commit commits the transaction.
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// maxIdentifierLength is the longest identifier validIdentifier accepts,
+// which is MySQL's limit on identifier lengths.
+const maxIdentifierLength = 64
+
+// validIdentifier reports whether name can be used as an identifier, such
+// as a savepoint name, without quoting: it must be a letter or underscore
+// followed by letters, digits and underscores.
+func validIdentifier(name string) bool {
+	if name == "" || len(name) > maxIdentifierLength || !isNameStart(name[0]) {
+		return false
+	}
+	for i := 1; i < len(name); i++ {
+		if !isNamePart(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Savepoint runs fn within a savepoint called name in tx, such as in the
+// function passed to WithTx. If fn returns an error or panics, tx is
+// rolled back to the savepoint, undoing fn's changes while keeping any
+// made earlier in the transaction, and the error is returned or the panic
+// re-raised. Otherwise the savepoint is released.
+//
+// name must be a letter or underscore followed by letters, digits and
+// underscores, since it can't be passed as a query argument.
+func Savepoint(ctx context.Context, tx *sql.Tx, name string, fn func() error) error {
+	if !validIdentifier(name) {
+		return fmt.Errorf("savepoint: invalid name %q", name)
+	}
+
+	if _, err := tx.ExecContext(ctx, "savepoint "+name); err != nil {
+		return fmt.Errorf("savepoint %s: %w", name, err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.ExecContext(ctx, "rollback to savepoint "+name)
+			panic(p)
+		}
+	}()
+
+	if err := fn(); err != nil {
+		if _, rbErr := tx.ExecContext(ctx, "rollback to savepoint "+name); rbErr != nil {
+			return fmt.Errorf("%w (rollback to savepoint %s failed: %v)", err, name, rbErr)
+		}
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "release savepoint "+name); err != nil {
+		return fmt.Errorf("release savepoint %s: %w", name, err)
+	}
+	return nil
+}
+
+// A querier runs queries, like a *sql.DB or a *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// querier returns what s runs the queries of the call that ctx belongs to
+// with: its transaction if s was passed to the function given to
+// WithinTx, the connection reserved for the call if there is one, and its
+// database otherwise.
+func (s *Store) querier(ctx context.Context) querier {
+	if s.tx != nil {
+		return s.tx
+	}
+	if conn := reservedConn(ctx); conn != nil {
+		return conn
+	}
+	return s.root().db
+}
+
+// WithinTx is like WithTx, but passes fn a Store whose methods all run
+// within the transaction, so that several of them can be committed or
+// rolled back together. The Store has the same settings as s, except
+// that it doesn't cache users or retry failed statements, since the
+// transaction can't be retried from within fn. Once fn returns, the Store
+// refuses to run any more queries with ErrStoreClosed.
+//
+// The Store's Hooks are called for the changes it makes once the
+// transaction commits, and not at all if it's rolled back.
+//
+// The Store shares s's database, so it mustn't be shut down or
+// reconnected.
+func (s *Store) WithinTx(ctx context.Context, fn func(txStore *Store) error) error {
+	if err := s.acquire(ctx); err != nil {
+		return err
+	}
+	defer s.release()
+
+	ctx, cancel := s.withDefaultTimeout(ctx)
+	defer cancel()
+	var ts *Store
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		ts = s.txStore(tx)
+		defer func() {
+			ts.mu.Lock()
+			ts.closed = true
+			ts.mu.Unlock()
+		}()
+		return fn(ts)
+	})
+
+	// Users read from outside the transaction while it was running may
+	// have been cached with the values the transaction has since changed.
+	s.invalidateAll()
+	if err != nil {
+		return err
+	}
+
+	// If s itself runs within a transaction, the changes are passed on to
+	// be told about once that one commits instead.
+	if s.tx != nil {
+		r := s.root()
+		r.mu.Lock()
+		r.pendingHooks = append(r.pendingHooks, ts.pendingHooks...)
+		r.mu.Unlock()
+		return nil
+	}
+	return ts.flushHooks(ctx)
+}
+
+// txStore returns a Store with the same settings as s that runs its
+// queries within tx.
+func (s *Store) txStore(tx *sql.Tx) *Store {
+	ts := s.derive()
+	if s.tx != tx {
+		ts.savepoints = new(atomic.Int32)
+	}
+	ts.db, ts.tx = s.root().db, tx
+	return ts
+}
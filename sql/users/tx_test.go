@@ -0,0 +1,190 @@
+package users_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+// insertUser inserts a user named username in tx, bypassing the store.
+func insertUser(ctx context.Context, tx *sql.Tx, username string) error {
+	_, err := tx.ExecContext(ctx, "insert into users (username, password, created_at, updated_at)"+
+		" values (?, 'x', current_timestamp, current_timestamp)", username)
+	return err
+}
+
+func TestWithTx(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+
+	errRollback := errors.New("roll back")
+	err := s.WithTx(ctx, func(tx *sql.Tx) error {
+		if err := insertUser(ctx, tx, "alice"); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Errorf("err = %v, want fn's error", err)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("WithTx didn't re-raise fn's panic")
+			}
+		}()
+		s.WithTx(ctx, func(tx *sql.Tx) error {
+			insertUser(ctx, tx, "bob")
+			panic("boom")
+		})
+	}()
+
+	if n, err := s.CountUsers(ctx); err != nil || n != 0 {
+		t.Fatalf("CountUsers after rollbacks = %d, %v; want 0, nil", n, err)
+	}
+
+	err = s.WithTx(ctx, func(tx *sql.Tx) error {
+		return insertUser(ctx, tx, "carol")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := s.UserExists(ctx, "carol"); err != nil || !exists {
+		t.Errorf("UserExists(carol) = %v, %v; want true, nil", exists, err)
+	}
+}
+
+func TestSavepoint(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+
+	err := s.WithTx(ctx, func(tx *sql.Tx) error {
+		if err := insertUser(ctx, tx, "alice"); err != nil {
+			return err
+		}
+		// The savepoint's failure undoes bob but keeps alice.
+		err := users.Savepoint(ctx, tx, "sp", func() error {
+			if err := insertUser(ctx, tx, "bob"); err != nil {
+				return err
+			}
+			return insertUser(ctx, tx, "alice")
+		})
+		if err == nil {
+			t.Error("Savepoint didn't return the duplicate insert's error")
+		}
+		return users.Savepoint(ctx, tx, "bad name", func() error { return nil })
+	})
+	if err == nil {
+		t.Error("Savepoint accepted an invalid name")
+	}
+
+	err = s.WithTx(ctx, func(tx *sql.Tx) error {
+		if err := insertUser(ctx, tx, "alice"); err != nil {
+			return err
+		}
+		users.Savepoint(ctx, tx, "sp", func() error {
+			insertUser(ctx, tx, "bob")
+			return errors.New("undo bob")
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := s.ListUsers(ctx, users.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := usernames(list); got != "alice" {
+		t.Errorf("users = %q, want %q", got, "alice")
+	}
+}
+
+func TestNestedSavepoints(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+
+	// Each savepoint is named after how deeply it's nested, so rolling
+	// back to store_tx_2 only undoes bob, and rolling back to store_tx_1
+	// undoes alice too.
+	err := s.WithinTx(ctx, func(ts *users.Store) error {
+		return ts.WithTx(ctx, func(tx *sql.Tx) error {
+			if err := insertUser(ctx, tx, "alice"); err != nil {
+				return err
+			}
+			err := ts.WithTx(ctx, func(tx *sql.Tx) error {
+				if err := insertUser(ctx, tx, "bob"); err != nil {
+					return err
+				}
+				if _, err := tx.ExecContext(ctx, "rollback to savepoint store_tx_2"); err != nil {
+					return err
+				}
+				return insertUser(ctx, tx, "carol")
+			})
+			if err != nil {
+				return err
+			}
+			if exists, err := ts.UserExists(ctx, "carol"); err != nil || !exists {
+				t.Errorf("UserExists(carol) = %v, %v; want true, nil", exists, err)
+			}
+			if _, err := tx.ExecContext(ctx, "rollback to savepoint store_tx_1"); err != nil {
+				return err
+			}
+			return insertUser(ctx, tx, "dave")
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := s.ListUsers(ctx, users.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := usernames(list); got != "dave" {
+		t.Errorf("users = %q, want %q", got, "dave")
+	}
+}
+
+func TestWithinTx(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+
+	var saved *users.Store
+	err := s.WithinTx(ctx, func(ts *users.Store) error {
+		saved = ts
+		createUsers(t, ts, "alice")
+
+		// Nested transactions run in a savepoint, so failing one keeps
+		// alice.
+		ts.WithinTx(ctx, func(inner *users.Store) error {
+			createUsers(t, inner, "bob")
+			return errors.New("undo bob")
+		})
+
+		if err := ts.WithTxOpts(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable}, func(*sql.Tx) error { return nil }); !errors.Is(err, users.ErrTxOptionsInTx) {
+			t.Errorf("options within a transaction: err = %v, want ErrTxOptionsInTx", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := s.ListUsers(ctx, users.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := usernames(list); got != "alice" {
+		t.Errorf("users = %q, want %q", got, "alice")
+	}
+
+	if _, err := saved.CountUsers(ctx); !errors.Is(err, users.ErrStoreClosed) {
+		t.Errorf("using the store after WithinTx: err = %v, want ErrStoreClosed", err)
+	}
+}
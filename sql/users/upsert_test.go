@@ -0,0 +1,127 @@
+package users_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gongweijun86/go-packages/sql/dbtest"
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+func TestUpsertUser(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+
+	u := &users.User{Username: "alice", Email: strptr("alice@example.com"), Password: "password123"}
+	inserted, err := s.UpsertUser(ctx, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !inserted {
+		t.Error("first UpsertUser didn't insert")
+	}
+	if u.Version != 1 {
+		t.Errorf("Version after insert = %d, want 1", u.Version)
+	}
+	id := u.Id
+
+	u = &users.User{Username: "alice", Email: strptr("new@example.com"), Password: "password456", Role: users.RoleAdmin}
+	inserted, err = s.UpsertUser(ctx, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inserted {
+		t.Error("second UpsertUser inserted")
+	}
+	if u.Id != id || u.Version != 2 {
+		t.Errorf("Id, Version = %d, %d; want %d, 2", u.Id, u.Version, id)
+	}
+
+	got, err := s.GetUserByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got.Email != "new@example.com" || got.Role != users.RoleAdmin || got.Version != 2 {
+		t.Errorf("got email %q, role %q, version %d", *got.Email, got.Role, got.Version)
+	}
+	if !users.CheckPassword(got.Password, "password456") {
+		t.Error("password wasn't updated")
+	}
+}
+
+func TestUpsertUserOtherUsersEmail(t *testing.T) {
+	for _, tenant := range []bool{false, true} {
+		s := dbtest.NewTestStore(t)
+		if tenant {
+			s = s.ForTenant(1)
+		}
+		ctx := context.Background()
+
+		bob := &users.User{Username: "bob", Email: strptr("bob@example.com"), Password: "password123"}
+		if _, err := s.CreateUser(ctx, bob); err != nil {
+			t.Fatal(err)
+		}
+
+		// Upserting a new username with bob's email mustn't touch bob.
+		_, err := s.UpsertUser(ctx, &users.User{Username: "mallory", Email: strptr("bob@example.com"), Password: "password456", Role: users.RoleAdmin})
+		if !errors.Is(err, users.ErrDuplicateEmail) {
+			t.Errorf("tenant %v: err = %v, want ErrDuplicateEmail", tenant, err)
+		}
+		got, err := s.GetUserByUsername(ctx, "bob")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Role != users.RoleUser || !users.CheckPassword(got.Password, "password123") {
+			t.Errorf("tenant %v: bob was changed: role %q", tenant, got.Role)
+		}
+		if exists, err := s.UserExists(ctx, "mallory"); err != nil || exists {
+			t.Errorf("tenant %v: UserExists(mallory) = %v, %v", tenant, exists, err)
+		}
+	}
+}
+
+func TestUpsertUserValidates(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+
+	_, err := s.UpsertUser(ctx, &users.User{Username: "alice", Password: "password123", Role: "root"})
+	if !errors.Is(err, users.ErrInvalidRole) {
+		t.Errorf("invalid role: err = %v, want ErrInvalidRole", err)
+	}
+	_, err = s.UpsertUser(ctx, &users.User{Username: "alice", Email: strptr(""), Password: "password123"})
+	if !errors.Is(err, users.ErrEmptyEmail) {
+		t.Errorf("empty email: err = %v, want ErrEmptyEmail", err)
+	}
+
+	s.PasswordPolicy = users.PasswordPolicy{MinLength: 12}
+	_, err = s.UpsertUser(ctx, &users.User{Username: "alice", Password: "short"})
+	if !errors.Is(err, users.ErrPasswordTooShort) {
+		t.Errorf("short password: err = %v, want ErrPasswordTooShort", err)
+	}
+	if exists, err := s.UserExists(ctx, "alice"); err != nil || exists {
+		t.Errorf("UserExists(alice) = %v, %v", exists, err)
+	}
+}
+
+func TestUpsertUserForTenant(t *testing.T) {
+	s := dbtest.NewTestStore(t)
+	ctx := context.Background()
+	ts := s.ForTenant(1)
+
+	for i, want := range []bool{true, false, false} {
+		u := &users.User{Username: "alice", Password: "password123"}
+		inserted, err := ts.UpsertUser(ctx, u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inserted != want || u.Version != i+1 {
+			t.Errorf("upsert %d: inserted, Version = %v, %d; want %v, %d", i, inserted, u.Version, want, i+1)
+		}
+	}
+
+	// The user can't be read back through another tenant.
+	if _, err := s.ForTenant(2).GetUserByUsername(ctx, "alice"); !errors.Is(err, users.ErrUserNotFound) {
+		t.Errorf("other tenant: err = %v, want ErrUserNotFound", err)
+	}
+}
@@ -0,0 +1,267 @@
+package users
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrUserNotFound is returned when no user matches a lookup.
+	ErrUserNotFound = errors.New("user not found")
+
+	// ErrVersionConflict is returned by UpdateUser when the user has been
+	// changed since it was read, so that its Version no longer matches.
+	ErrVersionConflict = errors.New("user was changed by someone else")
+
+	// ErrMissingUserID is returned when an operation that needs a
+	// user's id is given a user whose Id hasn't been set.
+	ErrMissingUserID = errors.New("user id is required")
+
+	// ErrEmptyUsername, ErrUsernameTooLong, ErrEmptyEmail,
+	// ErrEmptyPassword and ErrInvalidRole are returned by Validate for
+	// users with invalid fields. Users don't need an email, but one that's
+	// set must not be empty.
+	ErrEmptyUsername   = errors.New("username is required")
+	ErrUsernameTooLong = errors.New("username is too long")
+	ErrEmptyEmail      = errors.New("email is empty")
+	ErrEmptyPassword   = errors.New("password is required")
+	ErrInvalidRole     = errors.New("invalid role")
+)
+
+// maxUsernameLength is the maximum number of characters in a username,
+// matching the size of the username column.
+const maxUsernameLength = 255
+
+// userColumns lists the users columns that are scanned into a User, by
+// the db tags of its fields. Listing them explicitly instead of using
+// select * means that adding columns to the table won't break scanning.
+const userColumns = "id, username, email, password, role, created_at, updated_at, version, last_login_at," +
+	" failed_login_count, locked_until, needs_rehash, metadata"
+
+// userColumnNames is userColumns as a list of column names.
+var userColumnNames = strings.Split(strings.ReplaceAll(userColumns, " ", ""), ",")
+
+// A rowScanner is a *sql.Row or *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// userFields maps each of the users columns to the User field that it's
+// scanned into, going by the fields' db tags.
+var userFields = structFields(reflect.TypeOf(User{}))
+
+// scanUser scans the userColumns of the current row of row into a new
+// User. A *sql.Row can't report its columns, so row must select them in
+// the order of userColumns; rows read with *sql.Rows are scanned with
+// scanInto instead, which matches the columns to the fields by name.
+func scanUser(row rowScanner) (*User, error) {
+	u := new(User)
+	if err := scanColumns(row, userColumnNames, reflect.ValueOf(u).Elem()); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// BcryptCost is the bcrypt cost used by HashPassword. Raising it makes
+// hashes slower to compute, and so slower to brute force.
+var BcryptCost = bcrypt.DefaultCost
+
+// A User describes a user in the database.
+//
+// The users table is created by the migrations in the migrations
+// directory, which are applied by Migrate.
+//
+// Version is used for optimistic locking by UpdateUser. It's stored in the
+// version column, which starts at 1 and goes up by one every time the
+// user is changed.
+//
+// With MySQL, the DSN must include parseTime=true for the driver to scan
+// datetime columns into the time.Time fields.
+//
+// The Password field is never included when a User is encoded as JSON,
+// so users can be written out in API responses without leaking it. It's
+// empty for users without a password, such as users that only sign in
+// with SSO, whose password column is NULL.
+//
+// Email is nil for users without an email address, whose email column is
+// NULL, and is encoded as null in JSON.
+type User struct {
+	Id        int       `json:"id" db:"id"`
+	Username  string    `json:"username" db:"username"`
+	Email     *string   `json:"email" db:"email"`
+	Password  string    `json:"-" db:"password,nullzero"`
+	Role      string    `json:"role" db:"role"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	Version   int       `json:"version" db:"version"`
+
+	// LastLoginAt is when the user last signed in with Authenticate, or
+	// nil if they never have.
+	LastLoginAt *time.Time `json:"last_login_at" db:"last_login_at"`
+
+	// FailedLoginCount is the number of failed logins since the user last
+	// signed in or was locked out, and LockedUntil is when the user's
+	// account is locked until after too many of them, or nil if it has
+	// never been locked.
+	FailedLoginCount int        `json:"-" db:"failed_login_count"`
+	LockedUntil      *time.Time `json:"-" db:"locked_until"`
+
+	// NeedsRehash is set for users whose password hash was flagged by
+	// RehashWeakPasswords, which Authenticate hashes again the next time
+	// they sign in.
+	NeedsRehash bool `json:"-" db:"needs_rehash"`
+
+	// Metadata holds arbitrary data about the user, such as settings of
+	// the application the user belongs to, which is stored as JSON in
+	// the metadata column. Since it goes through JSON, numbers are read
+	// back as float64s, and nested objects as maps. It's empty, but not
+	// nil, for users read from the database without any.
+	Metadata map[string]interface{} `json:"metadata,omitempty" db:"metadata,json"`
+}
+
+// HasPassword reports whether u has a password. Users read by a Store
+// with RedactPasswords set never appear to have one.
+func (u *User) HasPassword() bool {
+	return u.Password != ""
+}
+
+// nullPassword returns password as a sql.NullString that's NULL if
+// password is empty, for writing to the password column.
+func nullPassword(password string) sql.NullString {
+	return sql.NullString{String: password, Valid: password != ""}
+}
+
+// A ValidationError is returned by Validate for a user with invalid
+// fields. Each of the problems it finds can still be checked for with
+// errors.Is, such as ErrEmptyUsername.
+type ValidationError struct {
+	// Fields maps the names of the invalid fields, in lowercase like
+	// username, to a message describing what's wrong with them.
+	Fields map[string]string
+
+	errs []error
+}
+
+// add records err as the problem with field.
+func (e *ValidationError) add(field string, err error) {
+	if e.Fields == nil {
+		e.Fields = make(map[string]string)
+	}
+	e.Fields[field] = err.Error()
+	e.errs = append(e.errs, err)
+}
+
+// Error returns the messages of e's fields, ordered by field name, one
+// per line.
+func (e *ValidationError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for field := range e.Fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	msgs := make([]string, len(fields))
+	for i, field := range fields {
+		msgs[i] = e.Fields[field]
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the errors for each of e's fields, so that errors.Is
+// can find them.
+func (e *ValidationError) Unwrap() []error {
+	return e.errs
+}
+
+// Validate checks that u's fields can be written to the database. If any
+// of them can't, it returns a *ValidationError describing all of the
+// problems it finds.
+func (u *User) Validate() error {
+	return u.validate(true)
+}
+
+// validate is Validate, but only requires u to have a password if
+// requirePassword is set.
+func (u *User) validate(requirePassword bool) error {
+	var e ValidationError
+	if u.Username == "" {
+		e.add("username", ErrEmptyUsername)
+	}
+	if utf8.RuneCountInString(u.Username) > maxUsernameLength {
+		e.add("username", ErrUsernameTooLong)
+	}
+	if u.Email != nil && *u.Email == "" {
+		e.add("email", ErrEmptyEmail)
+	}
+	if requirePassword && u.Password == "" {
+		e.add("password", ErrEmptyPassword)
+	}
+	if u.Role != "" && !roles[u.Role] {
+		e.add("role", ErrInvalidRole)
+	}
+	if len(e.errs) == 0 {
+		return nil
+	}
+	return &e
+}
+
+// normalize puts u's fields in the form they're stored in, lowercasing
+// its email and giving it RoleUser if it has no role.
+func (u *User) normalize() {
+	if u.Email != nil {
+		// The email is copied rather than changed in place, since the
+		// caller may still be using the string it points to.
+		email := normalizeEmail(*u.Email)
+		u.Email = &email
+	}
+	if u.Role == "" {
+		u.Role = RoleUser
+	}
+}
+
+// normalize is u.normalize, also putting u's username in lower case if
+// s.CaseInsensitiveUsernames is set.
+func (s *Store) normalize(u *User) {
+	u.normalize()
+	if s.CaseInsensitiveUsernames {
+		u.Username = strings.ToLower(u.Username)
+	}
+}
+
+// normalizeEmail returns email in the form it's stored and looked up in,
+// so that differently cased spellings of an address match each other.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// HashPassword returns the bcrypt hash of plain, using BcryptCost. Stores
+// hash passwords with their Hasher instead.
+func HashPassword(plain string) (string, error) {
+	// GenerateFromPassword returns the bcrypt hash of the password at the
+	// given cost. If the cost given is less than MinCost, the cost will be
+	// set to DefaultCost, instead.
+	hash, err := bcrypt.GenerateFromPassword([]byte(plain), BcryptCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether plain is the password that hash was
+// generated from by HashPassword or one of the built-in Hashers. It
+// reports false for hashes it doesn't recognize.
+func CheckPassword(hash, plain string) bool {
+	h := hasherFor(hash)
+	if h == nil {
+		return false
+	}
+	ok, err := h.Verify(hash, plain)
+	return ok && err == nil
+}
@@ -0,0 +1,36 @@
+package users_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/gongweijun86/go-packages/sql/users"
+)
+
+func TestUserJSONOmitsPassword(t *testing.T) {
+	hash, err := users.HashPassword("password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &users.User{Id: 1, Username: "alice", Password: hash, Role: users.RoleUser}
+
+	data, err := json.Marshal(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), hash) {
+		t.Errorf("JSON %s contains the password hash", data)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fields["password"]; ok {
+		t.Errorf("JSON %s has a password field", data)
+	}
+	if fields["id"] != 1.0 || fields["username"] != "alice" {
+		t.Errorf("JSON %s is missing the user's id or username", data)
+	}
+}
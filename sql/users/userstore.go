@@ -0,0 +1,26 @@
+package users
+
+import "context"
+
+// A UserStore stores users. Store implements it on top of a database,
+// Cluster on top of a primary database and its replicas, and MemStore
+// implements it in memory, so code that depends on a UserStore can be
+// tested without a database.
+//
+// Implementations report the same errors, such as ErrUserNotFound and
+// ErrDuplicateUsername, which callers should check for with errors.Is.
+type UserStore interface {
+	CreateUser(ctx context.Context, u *User) (int64, error)
+	GetUserByID(ctx context.Context, id int) (*User, error)
+	GetUserByUsername(ctx context.Context, username string) (*User, error)
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	UpdateUser(ctx context.Context, u *User) error
+	DeleteUser(ctx context.Context, id int) error
+	ListUsers(ctx context.Context, opts ListOptions) ([]*User, error)
+}
+
+var (
+	_ UserStore = (*Store)(nil)
+	_ UserStore = (*MemStore)(nil)
+	_ UserStore = (*Cluster)(nil)
+)